@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	githubql "github.com/shurcooL/githubql"
+)
+
+const assetsKeyPrefix = "assets/"
+
+// assetsMaxWait is how long a release is held back for its required assets to be uploaded before giving up on it.
+const assetsMaxWait = 24 * time.Hour
+
+// storedAssets is a release held back until the assets its repository requires were uploaded.
+type storedAssets struct {
+	Since time.Time  `json:"since"`
+	Held  Repository `json:"held"`
+}
+
+func assetsKey(key string) string {
+	return assetsKeyPrefix + key
+}
+
+// validAssetGlob returns true if the glob of a required asset can match asset names.
+func validAssetGlob(glob string) bool {
+	_, err := path.Match(glob, "")
+	return glob != "" && err == nil
+}
+
+// missingAssets returns the globs of the required assets that none of the release's assets matches.
+func missingAssets(release Release, required []string) []string {
+	var missing []string
+	for _, glob := range required {
+		found := false
+		for _, asset := range release.Assets {
+			if ok, _ := path.Match(glob, asset.Name); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, glob)
+		}
+	}
+	return missing
+}
+
+// assetsAttached returns true if the new release of the repository has all the assets the repository requires.
+// A release still missing some is held back instead, replacing an older one held back before, see heldKey and notifyAttached.
+func (c *Checker) assetsAttached(key string, repository *Repository) bool {
+	if c.assets == nil || key != keyRepository(key) {
+		return true
+	}
+	missing := missingAssets(repository.Release, c.assets(key))
+	if len(missing) == 0 {
+		return true
+	}
+
+	level.Debug(c.logger).Log(
+		"msg", "holding back release until its assets were uploaded",
+		"repository", key,
+		"release", repository.Release.TagName,
+		"missing", strings.Join(missing, ","),
+	)
+	held := *repository
+	held.span = nil
+	held.status = nil
+	c.storeAssets(heldKey(key, held), storedAssets{Since: time.Now(), Held: held})
+	return false
+}
+
+// notifyAttached notifies the releases held back whose required assets were uploaded in the meantime,
+// once they are ready to be notified otherwise, see readyToNotify. Releases still missing assets
+// after assetsMaxWait are given up on. Once the cycle's cap is reached with the notified releases,
+// the others stay held back for a later cycle, see maxPerCycle. It returns the releases notified in the cycle.
+func (c *Checker) notifyAttached(ctx context.Context, releases chan<- Repository, notified int) int {
+	if c.store == nil {
+		return notified
+	}
+	keys, err := c.store.Keys(assetsKeyPrefix)
+	if err != nil {
+		level.Warn(c.logger).Log("msg", "failed to load releases waiting for their assets", "err", err)
+		return notified
+	}
+
+	for _, storeKey := range keys {
+		if c.capped(notified) {
+			break
+		}
+		var stored storedAssets
+		if _, err := c.store.Get(storeKey, &stored); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to load release waiting for its assets", "key", storeKey, "err", err)
+			continue
+		}
+		key := keyRepository(strings.TrimPrefix(storeKey, assetsKeyPrefix))
+		stored.Held.caughtUp = storeKey != assetsKey(key)
+
+		release, err := c.queryRelease(ctx, key, stored.Held.Release.TagName)
+		if err != nil {
+			level.Warn(c.logger).Log(
+				"msg", "failed to query the release's assets",
+				"repository", key,
+				"release", stored.Held.Release.TagName,
+				"err", err,
+			)
+			continue
+		}
+		if release != nil {
+			c.queryRemainingAssets(ctx, key, release)
+		}
+		if release == nil {
+			level.Info(c.logger).Log(
+				"msg", "release waiting for its assets disappeared, not notifying",
+				"repository", key,
+				"release", stored.Held.Release.TagName,
+			)
+		} else if missing := missingAssets(*release, c.assets(key)); len(missing) > 0 {
+			if time.Since(stored.Since) < assetsMaxWait {
+				continue
+			}
+			level.Warn(c.logger).Log(
+				"msg", "assets of the release weren't uploaded in time, not notifying",
+				"repository", key,
+				"release", stored.Held.Release.TagName,
+				"missing", strings.Join(missing, ","),
+				"waited", assetsMaxWait,
+			)
+		} else {
+			stored.Held.Release.Assets = release.Assets
+			if c.readyToNotify(ctx, key, &stored.Held) {
+				notified++
+				releases <- stored.Held
+			}
+		}
+		if err := c.store.Delete(storeKey); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to remove release waiting for its assets", "repository", key, "err", err)
+		}
+	}
+	return notified
+}
+
+func (c *Checker) storeAssets(key string, stored storedAssets) {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.Put(assetsKey(key), stored); err != nil {
+		level.Warn(c.logger).Log(
+			"msg", "failed to store release waiting for its assets",
+			"repository", key,
+			"err", err,
+		)
+	}
+}
+
+// queryRelease returns the repository's release of the tag as it is now, nil if it doesn't exist anymore.
+func (c *Checker) queryRelease(ctx context.Context, repoName, tag string) (*Release, error) {
+	owner, name := c.currentName(repoName)
+	if source, ok := c.sources[repoName]; ok {
+		releases, err := source.Releases(ctx, owner, name, releaseLineLookback)
+		if err != nil {
+			return nil, err
+		}
+		for i := range releases {
+			if releases[i].TagName == tag {
+				return &releases[i], nil
+			}
+		}
+		return nil, nil
+	}
+
+	var query struct {
+		Repository struct {
+			Release *releaseNode `graphql:"release(tagName: $tag)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	variables := map[string]interface{}{
+		"owner": githubql.String(owner),
+		"name":  githubql.String(name),
+		"tag":   githubql.String(tag),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout(5*time.Second))
+	defer cancel()
+	if err := c.clientFor(repoName).Query(ctx, &query, variables); err != nil {
+		return nil, err
+	}
+	if query.Repository.Release == nil {
+		return nil, nil
+	}
+	release, err := newRelease(*query.Repository.Release)
+	if err != nil {
+		return nil, fmt.Errorf("release %s: %v", tag, err)
+	}
+	return &release, nil
+}
+
+// queryRemainingAssets adds the assets of a release on GitHub with more of them than queried along with it,
+// so its required assets and downloads take all into account. Failing to query them is logged,
+// the release keeps the assets queried so far.
+func (c *Checker) queryRemainingAssets(ctx context.Context, repoName string, release *Release) {
+	if release.assetsCursor == "" || c.sources[repoName] != nil {
+		return
+	}
+	owner, name := c.currentName(repoName)
+	variables := map[string]interface{}{
+		"owner": githubql.String(owner),
+		"name":  githubql.String(name),
+		"tag":   githubql.String(release.TagName),
+	}
+	for release.assetsCursor != "" {
+		var query struct {
+			Repository struct {
+				Release *struct {
+					ReleaseAssets releaseAssets `graphql:"releaseAssets(first: 100, after: $cursor)"`
+				} `graphql:"release(tagName: $tag)"`
+			} `graphql:"repository(owner: $owner, name: $name)"`
+		}
+		variables["cursor"] = githubql.String(release.assetsCursor)
+
+		queryCtx, cancel := context.WithTimeout(ctx, c.timeout(5*time.Second))
+		err := c.clientFor(repoName).Query(queryCtx, &query, variables)
+		cancel()
+		if err == nil && query.Repository.Release == nil {
+			err = fmt.Errorf("release %s not found", release.TagName)
+		}
+		if err != nil {
+			level.Warn(c.logger).Log(
+				"msg", "failed to query the remaining assets of the release",
+				"repository", repoName,
+				"release", release.TagName,
+				"assets", len(release.Assets),
+				"err", err,
+			)
+			release.assetsCursor = ""
+			return
+		}
+		query.Repository.Release.ReleaseAssets.add(release)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestQueryRemainingAssets(t *testing.T) {
+	// The assets after the first page come in two more pages.
+	pages := map[string][]int{"page-1": {150, 250}, "page-2": {350}}
+	c := newInboxChecker(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables struct{ Cursor, Tag string }
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Variables.Tag != "v1.0.0" {
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+			return
+		}
+		var nodes []interface{}
+		for i, downloads := range pages[body.Variables.Cursor] {
+			nodes = append(nodes, map[string]interface{}{
+				"name":          fmt.Sprintf("%s-%d.tar.gz", body.Variables.Cursor, i),
+				"downloadUrl":   "https://github.com/octocat/hello/releases/download/v1.0.0/asset.tar.gz",
+				"downloadCount": downloads,
+			})
+		}
+		next := body.Variables.Cursor == "page-1"
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"repository": map[string]interface{}{
+			"release": map[string]interface{}{"releaseAssets": map[string]interface{}{
+				"nodes":    nodes,
+				"pageInfo": map[string]interface{}{"endCursor": "page-2", "hasNextPage": next},
+			}},
+		}}})
+	})
+
+	release := Release{TagName: "v1.0.0", Assets: []Asset{{Name: "first.tar.gz", Downloads: 50}}, assetsCursor: "page-1"}
+	c.queryRemainingAssets(context.Background(), "octocat/hello", &release)
+	if len(release.Assets) != 4 || release.Downloads() != 800 {
+		t.Errorf("release has %d assets with %d downloads, want 4 with 800", len(release.Assets), release.Downloads())
+	}
+	if release.assetsCursor != "" {
+		t.Errorf("cursor = %q, want none left", release.assetsCursor)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	githubql "github.com/shurcooL/githubql"
+)
+
+// Since is the start of the window of releases notified when a repository is checked for the first time:
+// either a date like 2024-01-01, or a duration like 720h before the check.
+type Since struct {
+	at   time.Time
+	ago  time.Duration
+	text string
+}
+
+// UnmarshalText parses a date, a time in RFC 3339 or, if it is neither, a duration.
+func (s *Since) UnmarshalText(text []byte) error {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if at, err := time.Parse(layout, string(text)); err == nil {
+			*s = Since{at: at, text: string(text)}
+			return nil
+		}
+	}
+
+	ago, err := time.ParseDuration(string(text))
+	if err != nil || ago <= 0 {
+		return fmt.Errorf("%q is neither a date like 2024-01-01 nor a positive duration like 720h", text)
+	}
+	*s = Since{ago: ago, text: string(text)}
+	return nil
+}
+
+func (s Since) String() string {
+	return s.text
+}
+
+// IsZero returns true if no window was given.
+func (s Since) IsZero() bool {
+	return s.at.IsZero() && s.ago == 0
+}
+
+// Time returns the start of the window for a check at now.
+func (s Since) Time(now time.Time) time.Time {
+	if s.ago > 0 {
+		return now.Add(-s.ago)
+	}
+	return s.at
+}
+
+// backfill returns the releases of the repository published after since, the oldest first,
+// only the ones on its release line if it has one.
+func (c *Checker) backfill(ctx context.Context, owner, name string, since time.Time) ([]Release, error) {
+	repoName := owner + "/" + name
+	currentOwner, currentName := c.currentName(repoName)
+	line, hasLine := c.releaseLines[repoName]
+
+	variables := map[string]interface{}{
+		"owner":  githubql.String(currentOwner),
+		"name":   githubql.String(currentName),
+		"cursor": (*githubql.String)(nil),
+	}
+
+	var releases []Release
+	for {
+		var query struct {
+			Repository struct {
+				Releases struct {
+					Nodes    []releaseNode
+					PageInfo struct {
+						EndCursor   githubql.String
+						HasNextPage githubql.Boolean
+					}
+				} `graphql:"releases(first: 50, after: $cursor, orderBy: {field: CREATED_AT, direction: DESC})"`
+			} `graphql:"repository(owner: $owner, name: $name)"`
+		}
+
+		queryCtx, cancel := context.WithTimeout(ctx, c.timeout(10*time.Second))
+		err := c.clientFor(repoName).Query(queryCtx, &query, variables)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		// Releases are published after they are created, so older ones than since can't be in the window.
+		done := !bool(query.Repository.Releases.PageInfo.HasNextPage)
+		for _, node := range query.Repository.Releases.Nodes {
+			if !node.CreatedAt.Time.After(since) {
+				done = true
+			}
+			if !node.PublishedAt.Time.After(since) {
+				continue
+			}
+			if hasLine {
+				if version, err := ParseVersion(string(node.TagName)); err != nil || !line.Contains(version) {
+					continue
+				}
+			}
+			release, err := newRelease(node)
+			if err != nil {
+				return nil, err
+			}
+			releases = append(releases, release)
+		}
+		if done {
+			break
+		}
+		variables["cursor"] = githubql.NewString(query.Repository.Releases.PageInfo.EndCursor)
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].PublishedAt.Before(releases[j].PublishedAt)
+	})
+	return releases, nil
+}
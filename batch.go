@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	githubql "github.com/shurcooL/githubql"
+)
+
+// DefaultBatchSize is how many repositories are queried in a single request by default.
+const DefaultBatchSize = 20
+
+// batchTimeout bounds a batched query, which takes longer than one of a single repository.
+const batchTimeout = 15 * time.Second
+
+// batchResult is the outcome of querying one repository of a batch.
+type batchResult struct {
+	repository Repository
+	err        error
+}
+
+// nextBatch returns the keys of up to batchSize repositories from the start of keys
+// that can be queried together: checked for their releases and with the same client.
+func (c *Checker) nextBatch(keys []string) []string {
+	client := c.clientFor(keys[0])
+
+	var batch []string
+	for _, key := range keys {
+		if len(batch) == c.batchSize {
+			break
+		}
+		if !c.batched(key) || c.clientFor(key) != client {
+			continue
+		}
+		batch = append(batch, key)
+	}
+	return batch
+}
+
+// batched returns true if the key is queried in batches with others: it is a repository's releases on GitHub
+// and the checker batches queries.
+func (c *Checker) batched(key string) bool {
+	return key == keyRepository(key) && c.batchSize > 1 && c.sources[key] == nil
+}
+
+// queryBatch queries the releases of the repositories in a single request, each one aliased
+// in the query as r0, r1 and so on. A repository failing, e.g. because it doesn't exist anymore,
+// only fails its own result as GitHub still returns the others along with the errors.
+func (c *Checker) queryBatch(ctx context.Context, span *Span, repositories []string) map[string]batchResult {
+	fields := []reflect.StructField{{
+		Name: "RateLimit",
+		Type: reflect.TypeOf(rateLimit{}),
+	}}
+	variables := make(map[string]interface{}, 2*len(repositories))
+	cached := make([]bool, len(repositories))
+	for i, repoName := range repositories {
+		owner, name := c.currentName(repoName)
+		variables[fmt.Sprintf("owner%d", i)] = githubql.String(owner)
+		variables[fmt.Sprintf("name%d", i)] = githubql.String(name)
+
+		count := 1
+		if _, hasLine := c.releaseLines[repoName]; hasLine {
+			count = releaseLineLookback
+		}
+		// The repository's own details are only queried until they are cached.
+		repository := []reflect.StructField{{
+			Name: "Releases",
+			Type: reflect.TypeOf(releaseEdges{}),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"releases(last: %d)"`, count)),
+		}, {
+			Name: "Status",
+			Type: reflect.TypeOf(repositoryStatus{}),
+			Tag:  `graphql:"... on Repository"`,
+		}}
+		if _, cached[i] = c.metadata.Get(repoName); !cached[i] {
+			repository = append(repository, reflect.StructField{
+				Name: "Fields",
+				Type: reflect.TypeOf(repositoryFields{}),
+				Tag:  `graphql:"... on Repository"`,
+			})
+		}
+		// Repositories that failed are null, so they are pointers to tell them apart.
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("R%d", i),
+			Type: reflect.PtrTo(reflect.StructOf(repository)),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"r%d: repository(owner: $owner%d, name: $name%d)"`, i, i, i)),
+		})
+	}
+	query := reflect.New(reflect.StructOf(fields))
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout(batchTimeout))
+	defer cancel()
+	err := c.clientFor(repositories[0]).Query(ctx, query.Interface(), variables)
+
+	span.SetAttribute("batch.size", len(repositories))
+	query.Elem().Field(0).Interface().(rateLimit).record(span)
+
+	results := make(map[string]batchResult, len(repositories))
+	for i, repoName := range repositories {
+		owner, name := splitRepoName(repoName)
+
+		repository := query.Elem().Field(i + 1)
+		if repository.IsNil() {
+			results[repoName] = batchResult{err: batchError(err, repoName)}
+			continue
+		}
+		repository = repository.Elem()
+		releases := repository.Field(0).Interface().(releaseEdges)
+		status := repository.Field(1).Interface().(repositoryStatus)
+
+		metadata, _ := c.metadata.Get(repoName)
+		if !cached[i] {
+			var metadataErr error
+			metadata, metadataErr = newRepositoryMetadata(repository.Field(2).Interface().(repositoryFields))
+			if metadataErr != nil {
+				results[repoName] = batchResult{err: metadataErr}
+				continue
+			}
+			c.metadata.Put(repoName, metadata)
+		}
+
+		var result batchResult
+		result.repository, result.err = c.latestRelease(owner, name, metadata, status, releases)
+		results[repoName] = result
+	}
+	return results
+}
+
+// batchError returns the error of a repository missing from a batch's response:
+// the error about the repository itself if GitHub returned one, otherwise the one of the whole request.
+func batchError(err error, repoName string) error {
+	if err == nil {
+		return fmt.Errorf("no data for %s in the response", repoName)
+	}
+	// The client's type of the errors isn't exported, only that it is a list of them with messages.
+	if list := reflect.ValueOf(err); list.Kind() == reflect.Slice {
+		for i := 0; i < list.Len(); i++ {
+			message := list.Index(i).FieldByName("Message").String()
+			if strings.Contains(strings.ToLower(message), "'"+strings.ToLower(repoName)+"'") {
+				return fmt.Errorf("%s", message)
+			}
+		}
+	}
+	return err
+}
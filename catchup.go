@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// heldKey returns the key a release of the repository's key is held back under, e.g. for its assets.
+// Releases caught up on are held back each on its own, after a # so the key still belongs to the repository,
+// while the latest one replaces the one held back before.
+func heldKey(key string, repository Repository) string {
+	if repository.caughtUp {
+		return key + "#" + repository.Release.TagName
+	}
+	return key
+}
+
+// missedReleases returns the releases published between the last seen release and the latest one, the oldest first,
+// so all releases published since the last check are notified, also the ones published while the notifier was down.
+// Releases that can't be queried are logged and only the latest one is notified.
+// Only the newest of them up to the checker's limit are returned, the older ones are logged.
+func (c *Checker) missedReleases(ctx context.Context, owner, name string, latest, lastSeen Release) []Release {
+	published, err := c.backfill(ctx, owner, name, lastSeen.PublishedAt)
+	if err != nil {
+		level.Warn(c.logger).Log(
+			"msg", "failed to query the releases published since the last seen one, notifying the latest only",
+			"owner", owner,
+			"name", name,
+			"err", err,
+		)
+		return nil
+	}
+
+	var missed []Release
+	for _, release := range published {
+		if release.Key() == latest.Key() || release.Key() == lastSeen.Key() || !c.isNewer(owner+"/"+name, release, lastSeen) {
+			continue
+		}
+		missed = append(missed, release)
+	}
+	if c.catchUpLimit > 0 && len(missed) > c.catchUpLimit {
+		level.Warn(c.logger).Log(
+			"msg", "too many releases published since the last seen one, notifying the newest only",
+			"owner", owner,
+			"name", name,
+			"skipped", len(missed)-c.catchUpLimit,
+			"oldest_notified", missed[len(missed)-c.catchUpLimit].TagName,
+		)
+		missed = missed[len(missed)-c.catchUpLimit:]
+	}
+	return missed
+}
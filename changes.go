@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	githubql "github.com/shurcooL/githubql"
+)
+
+// commitsBetween returns the number of commits from the previous release's tag to the release's,
+// 0 if either tag doesn't exist.
+func (c *Checker) commitsBetween(ctx context.Context, repoName string, release, previous Release) (int, error) {
+	var query struct {
+		Repository struct {
+			Ref *struct {
+				Compare *struct {
+					AheadBy githubql.Int
+				} `graphql:"compare(headRef: $head)"`
+			} `graphql:"ref(qualifiedName: $base)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	owner, name := c.currentName(repoName)
+	variables := map[string]interface{}{
+		"owner": githubql.String(owner),
+		"name":  githubql.String(name),
+		"base":  githubql.String("refs/tags/" + previous.TagName),
+		"head":  githubql.String("refs/tags/" + release.TagName),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout(5*time.Second))
+	defer cancel()
+	if err := c.clientFor(repoName).Query(ctx, &query, variables); err != nil {
+		return 0, err
+	}
+	if ref := query.Repository.Ref; ref != nil && ref.Compare != nil {
+		return int(ref.Compare.AheadBy), nil
+	}
+	return 0, nil
+}
+
+// countCommits sets the number of commits since the repository's previous release, if both have tags
+// on GitHub. Failing to count them is logged, the release is notified without.
+func (c *Checker) countCommits(ctx context.Context, repoName string, repository *Repository) {
+	previous := repository.Previous
+	if previous == nil || previous.TagName == "" || repository.Release.TagName == "" ||
+		previous.TagName == repository.Release.TagName || c.sources[repoName] != nil {
+		return
+	}
+
+	commits, err := c.commitsBetween(ctx, repoName, repository.Release, *previous)
+	if err != nil {
+		level.Warn(c.logger).Log(
+			"msg", "failed to count the commits since the previous release",
+			"repository", repoName,
+			"release", repository.Release.TagName,
+			"previous", previous.TagName,
+			"err", err,
+		)
+		return
+	}
+	repository.Commits = commits
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultChannel is the channel of releases whose tags match none of the configured channels.
+const DefaultChannel = "default"
+
+// Channel is a named stream of releases recognized by their tag prefixes, like nightly-,
+// whose releases only go to the channel's senders.
+type Channel struct {
+	Name        string   `yaml:"name"`
+	TagPrefixes []string `yaml:"tag_prefixes"`
+	// Senders are the channel's senders, all of the repository's if empty.
+	Senders []string `yaml:"senders"`
+}
+
+func (c Channel) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("channel without name")
+	}
+	if len(c.TagPrefixes) == 0 && !strings.EqualFold(c.Name, DefaultChannel) {
+		return fmt.Errorf("channel %s needs tag_prefixes", c.Name)
+	}
+	if err := validateSenders(c.Senders); err != nil {
+		return fmt.Errorf("channel %s: %v", c.Name, err)
+	}
+	return nil
+}
+
+// ChannelFor returns the first channel with a prefix of the release's tag,
+// the channel named default or, if there's none, a default channel without restrictions.
+func (f *FileConfig) ChannelFor(release Release) Channel {
+	tag := release.TagName
+	if tag == "" {
+		tag = release.Name
+	}
+	fallback := Channel{Name: DefaultChannel}
+	for _, channel := range f.Channels {
+		for _, prefix := range channel.TagPrefixes {
+			if strings.HasPrefix(tag, prefix) {
+				return channel
+			}
+		}
+		if strings.EqualFold(channel.Name, DefaultChannel) {
+			fallback = channel
+		}
+	}
+	return fallback
+}
+
+// ChannelSendsTo returns true if the sender gets the releases of the release's channel.
+func (f *FileConfig) ChannelSendsTo(release Release, sender string) bool {
+	senders := f.ChannelFor(release).Senders
+	return len(senders) == 0 || containsFold(senders, sender)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	githubql "github.com/shurcooL/githubql"
+)
+
+// Ways to take the status checks of a release's commit into account, see RepositoryConfig.Checks.
+const (
+	// ChecksWait holds back releases until the checks of their commit passed.
+	ChecksWait = "wait"
+	// ChecksAnnotate notifies releases right away along with the state of their checks.
+	ChecksAnnotate = "annotate"
+)
+
+const checksKeyPrefix = "checks/"
+
+// checksMaxWait is how long a release is held back for its checks to pass before giving up on it.
+const checksMaxWait = 24 * time.Hour
+
+// storedChecks is a release held back until the checks of its commit passed.
+type storedChecks struct {
+	Since time.Time  `json:"since"`
+	Held  Repository `json:"held"`
+}
+
+func checksKey(key string) string {
+	return checksKeyPrefix + key
+}
+
+// checksState returns the combined state of the status checks and check runs of the release's commit,
+// like SUCCESS, PENDING or FAILURE, or an empty string if it has none.
+func (c *Checker) checksState(ctx context.Context, repoName string, release Release) (string, error) {
+	var query struct {
+		Repository struct {
+			Release *struct {
+				TagCommit *struct {
+					StatusCheckRollup *struct {
+						State githubql.String
+					}
+				}
+			} `graphql:"release(tagName: $tag)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	owner, name := c.currentName(repoName)
+	variables := map[string]interface{}{
+		"owner": githubql.String(owner),
+		"name":  githubql.String(name),
+		"tag":   githubql.String(release.TagName),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout(5*time.Second))
+	defer cancel()
+	if err := c.clientFor(repoName).Query(ctx, &query, variables); err != nil {
+		return "", err
+	}
+	if r := query.Repository.Release; r != nil && r.TagCommit != nil && r.TagCommit.StatusCheckRollup != nil {
+		return string(r.TagCommit.StatusCheckRollup.State), nil
+	}
+	return "", nil
+}
+
+// readyToNotify returns true if the new release of the repository is notified now, annotated with
+// the state of its checks if the repository takes them into account. A release waiting for its checks
+// to pass is held back instead, replacing an older one held back before, see heldKey and notifyChecked.
+func (c *Checker) readyToNotify(ctx context.Context, key string, repository *Repository) bool {
+	mode := c.checks(key)
+	// Only releases have a commit to query the checks of by tag, tags and discussions don't,
+	// and only GitHub's checks are known.
+	if mode == "" || key != keyRepository(key) || repository.Release.TagName == "" || c.sources[key] != nil {
+		return true
+	}
+
+	state, err := c.checksState(ctx, key, repository.Release)
+	if err != nil {
+		level.Warn(c.logger).Log(
+			"msg", "failed to query the release's checks",
+			"repository", key,
+			"release", repository.Release.TagName,
+			"err", err,
+		)
+	}
+	repository.Release.Checks = state
+	if mode == ChecksAnnotate || (err == nil && (state == "" || state == "SUCCESS")) {
+		return true
+	}
+
+	level.Debug(c.logger).Log(
+		"msg", "holding back release until its checks passed",
+		"repository", key,
+		"release", repository.Release.TagName,
+		"checks", state,
+	)
+	held := *repository
+	held.span = nil
+	held.status = nil
+	c.storeChecks(heldKey(key, held), storedChecks{Since: time.Now(), Held: held})
+	return false
+}
+
+// notifyChecked notifies the releases held back whose checks passed in the meantime.
+// Releases whose checks failed keep waiting, as the checks may be run again, until checksMaxWait passed.
+// Once the cycle's cap is reached with the notified releases, the others stay held back for a later cycle,
+// see maxPerCycle. It returns the releases notified in the cycle.
+func (c *Checker) notifyChecked(ctx context.Context, releases chan<- Repository, notified int) int {
+	if c.store == nil {
+		return notified
+	}
+	keys, err := c.store.Keys(checksKeyPrefix)
+	if err != nil {
+		level.Warn(c.logger).Log("msg", "failed to load releases waiting for their checks", "err", err)
+		return notified
+	}
+
+	for _, storeKey := range keys {
+		if c.capped(notified) {
+			break
+		}
+		var stored storedChecks
+		if _, err := c.store.Get(storeKey, &stored); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to load release waiting for its checks", "key", storeKey, "err", err)
+			continue
+		}
+		key := keyRepository(strings.TrimPrefix(storeKey, checksKeyPrefix))
+
+		state, err := c.checksState(ctx, key, stored.Held.Release)
+		if err != nil {
+			level.Warn(c.logger).Log(
+				"msg", "failed to query the release's checks",
+				"repository", key,
+				"release", stored.Held.Release.TagName,
+				"err", err,
+			)
+			continue
+		}
+		if state != "" && state != "SUCCESS" {
+			if time.Since(stored.Since) < checksMaxWait {
+				continue
+			}
+			level.Warn(c.logger).Log(
+				"msg", "checks of the release didn't pass in time, not notifying",
+				"repository", key,
+				"release", stored.Held.Release.TagName,
+				"checks", state,
+				"waited", checksMaxWait,
+			)
+		} else {
+			stored.Held.Release.Checks = state
+			notified++
+			releases <- stored.Held
+		}
+		if err := c.store.Delete(storeKey); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to remove release waiting for its checks", "repository", key, "err", err)
+		}
+	}
+	return notified
+}
+
+func (c *Checker) storeChecks(key string, stored storedChecks) {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.Put(checksKey(key), stored); err != nil {
+		level.Warn(c.logger).Log(
+			"msg", "failed to store release waiting for its checks",
+			"repository", key,
+			"err", err,
+		)
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FileConfig is the optional YAML config file given with --config.
+type FileConfig struct {
+	// Credentials are named GitHub tokens. Environment variables like
+	// ${WORK_GITHUB_TOKEN} are expanded, so tokens don't have to be in the file.
+	Credentials map[string]string `yaml:"credentials"`
+	// Owners maps a repository owner to the credential used for all of its repositories.
+	Owners map[string]string `yaml:"owners"`
+	// Senders are the senders used for repositories without senders of their own, all if empty.
+	Senders []string `yaml:"senders"`
+	// InitialNotify notifies about the current release of repositories that aren't in the state yet,
+	// instead of only remembering it.
+	InitialNotify bool `yaml:"initial_notify"`
+	// SlackMentions mention Slack users or groups for matching releases.
+	SlackMentions []MentionRule `yaml:"slack_mentions"`
+	// SlackDestinations are named Slack hooks the releases of the repositories matching SlackRoutes are sent to,
+	// instead of SLACK_HOOK.
+	SlackDestinations map[string]SlackDestination `yaml:"slack_destinations"`
+	SlackRoutes       []SlackRoute                `yaml:"slack_routes"`
+	// Mirrors are groups of repositories publishing the same releases, notified only once.
+	Mirrors []MirrorGroup `yaml:"mirrors"`
+	// Channels route releases to senders by their tag prefixes, in addition to the repositories' senders.
+	Channels     []Channel          `yaml:"channels"`
+	Repositories []RepositoryConfig `yaml:"repositories"`
+}
+
+// senderNames are the names of the senders to give in senders lists.
+var senderNames = []string{"slack", "sqlite", "gitlab", "opsgenie", "desktop", "markdown", "grpc", "webhook", "discord", "teams", "email", "nats"}
+
+// RepositoryConfig holds the settings for a single repository.
+type RepositoryConfig struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	// Discussions is the name of a discussion category, e.g. Announcements,
+	// whose new posts are notified like releases.
+	Discussions string `yaml:"discussions"`
+	// Senders limits the repository's notifications to the given senders, e.g. [slack, gitlab].
+	Senders []string `yaml:"senders"`
+	// InitialNotify overrides the global initial_notify for the repository.
+	InitialNotify *bool `yaml:"initial_notify"`
+	// ReleaseLine limits the releases to a version line like 2.x or 1.4.x,
+	// for projects maintaining several lines at once.
+	ReleaseLine string `yaml:"release_line"`
+	// AssetPattern only notifies releases with a matching asset, e.g. linux_amd64 or glob:*.deb.
+	AssetPattern string `yaml:"asset_pattern"`
+	// RequireAssets holds back releases until assets matching all of the globs were uploaded,
+	// e.g. *_linux_amd64.tar.gz, for projects uploading their binaries after publishing the release.
+	RequireAssets []string `yaml:"require_assets"`
+	// MinIntervalBetweenNotifications like 24h holds back releases until that long after the last notification,
+	// then only the newest one is notified.
+	MinIntervalBetweenNotifications time.Duration `yaml:"min_interval_between_notifications"`
+	// Checks takes the status checks of the commits of releases into account: wait holds back releases
+	// until they passed, annotate notifies the releases right away along with their state.
+	Checks string `yaml:"checks"`
+	// Paths only notifies releases changing any of the files or directories since the previous release.
+	Paths []string `yaml:"paths"`
+	// IgnoreNonstable overrides the global IGNORE_NONSTABLE for the repository.
+	IgnoreNonstable *bool `yaml:"ignore_nonstable"`
+	// TagPattern only notifies releases whose tag matches the regular expression, e.g. ^v[0-9]+\.[0-9]+\.[0-9]+$.
+	TagPattern string `yaml:"tag_pattern"`
+	// SlackChannel sends the repository's notifications in Slack to another channel than the hook's, e.g. #team-a.
+	SlackChannel string `yaml:"slack_channel"`
+	// Interval checks the repository less often than INTERVAL, e.g. 24h for slowly moving projects.
+	Interval time.Duration `yaml:"interval"`
+	// Mode overrides the global MODE for the repository: releases, tags or both.
+	Mode string `yaml:"mode"`
+	// MinVersion only notifies releases of at least this semantic version, e.g. 1.20.
+	MinVersion string `yaml:"min_version"`
+	// MinBump only notifies releases changing at least the major, minor or patch version from the previous release.
+	MinBump string `yaml:"min_bump"`
+	// TagsInclude only notifies releases whose tag matches any of the regular expressions.
+	TagsInclude []string `yaml:"tags_include"`
+	// TagsExclude doesn't notify releases whose tag matches any of the regular expressions, e.g. backport tags.
+	TagsExclude []string `yaml:"tags_exclude"`
+	// Newness overrides the global NEWNESS_STRATEGY for the repository.
+	Newness string `yaml:"newness"`
+}
+
+// LoadFileConfig reads and validates the config file at path.
+func LoadFileConfig(path string) (*FileConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f FileConfig
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("can't read config file %s: %v", path, err)
+	}
+
+	for name, token := range f.Credentials {
+		f.Credentials[name] = os.ExpandEnv(token)
+	}
+	for owner, credential := range f.Owners {
+		if _, ok := f.Credentials[credential]; !ok {
+			return nil, fmt.Errorf("owner %s uses unknown credential %q", owner, credential)
+		}
+	}
+	if err := validateSenders(f.Senders); err != nil {
+		return nil, err
+	}
+	for i := range f.SlackMentions {
+		if err := f.SlackMentions[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.compileSlackRoutes(); err != nil {
+		return nil, err
+	}
+	var mirrorNames, mirrored []string
+	for _, group := range f.Mirrors {
+		if err := group.validate(); err != nil {
+			return nil, err
+		}
+		if containsFold(mirrorNames, group.Name) {
+			return nil, fmt.Errorf("mirror group %s is defined twice", group.Name)
+		}
+		mirrorNames = append(mirrorNames, group.Name)
+		for _, repoName := range group.Repositories {
+			if containsFold(mirrored, repoName) {
+				return nil, fmt.Errorf("repository %s is in more than one mirror group", repoName)
+			}
+			mirrored = append(mirrored, repoName)
+		}
+	}
+	var channelNames []string
+	for _, channel := range f.Channels {
+		if err := channel.validate(); err != nil {
+			return nil, err
+		}
+		if containsFold(channelNames, channel.Name) {
+			return nil, fmt.Errorf("channel %s is defined twice", channel.Name)
+		}
+		channelNames = append(channelNames, channel.Name)
+	}
+	for _, repository := range f.Repositories {
+		if err := validateSenders(repository.Senders); err != nil {
+			return nil, fmt.Errorf("repository %s: %v", repository.Name, err)
+		}
+		if repository.ReleaseLine != "" {
+			if _, err := ParseReleaseLine(repository.ReleaseLine); err != nil {
+				return nil, fmt.Errorf("repository %s: %v", repository.Name, err)
+			}
+		}
+		if repository.AssetPattern != "" {
+			if _, err := ParseAssetPattern(repository.AssetPattern); err != nil {
+				return nil, fmt.Errorf("repository %s: %v", repository.Name, err)
+			}
+		}
+		for _, glob := range repository.RequireAssets {
+			if !validAssetGlob(glob) {
+				return nil, fmt.Errorf("repository %s: invalid require_assets glob %q", repository.Name, glob)
+			}
+		}
+		if repository.MinIntervalBetweenNotifications < 0 {
+			return nil, fmt.Errorf("repository %s: negative min_interval_between_notifications", repository.Name)
+		}
+		if repository.Checks != "" && repository.Checks != ChecksWait && repository.Checks != ChecksAnnotate {
+			return nil, fmt.Errorf("repository %s: unknown checks %q, must be %s or %s", repository.Name, repository.Checks, ChecksWait, ChecksAnnotate)
+		}
+		if repository.TagPattern != "" {
+			if _, err := regexp.Compile(repository.TagPattern); err != nil {
+				return nil, fmt.Errorf("repository %s: invalid tag_pattern: %v", repository.Name, err)
+			}
+		}
+		if repository.Interval < 0 {
+			return nil, fmt.Errorf("repository %s: negative interval", repository.Name)
+		}
+		if repository.Mode != "" && !validMode(repository.Mode) {
+			return nil, fmt.Errorf("repository %s: unknown mode %q, must be %s, %s or %s", repository.Name, repository.Mode, ModeReleases, ModeTags, ModeBoth)
+		}
+		if repository.MinVersion != "" {
+			if _, err := ParseVersion(repository.MinVersion); err != nil {
+				return nil, fmt.Errorf("repository %s: invalid min_version: %v", repository.Name, err)
+			}
+		}
+		switch repository.MinBump {
+		case "", ChangeMajor, ChangeMinor, ChangePatch:
+		default:
+			return nil, fmt.Errorf("repository %s: unknown min_bump %q, must be %s, %s or %s", repository.Name, repository.MinBump, ChangeMajor, ChangeMinor, ChangePatch)
+		}
+		for _, pattern := range append(repository.TagsInclude, repository.TagsExclude...) {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("repository %s: invalid tag pattern %q: %v", repository.Name, pattern, err)
+			}
+		}
+		switch repository.Newness {
+		case "", NewnessPublished, NewnessSemver, NewnessCreated, NewnessCreatedAfterLastSeen:
+		default:
+			return nil, fmt.Errorf("repository %s: unknown newness %q", repository.Name, repository.Newness)
+		}
+		for _, path := range repository.Paths {
+			if path == "" || strings.HasPrefix(path, "/") {
+				return nil, fmt.Errorf("repository %s: path %q must be relative to the repository's root", repository.Name, path)
+			}
+		}
+		if strings.Count(repository.Name, "/") != 1 {
+			return nil, fmt.Errorf("repository %q is not of the form owner/name", repository.Name)
+		}
+		if _, ok := f.Credentials[repository.Token]; repository.Token != "" && !ok {
+			return nil, fmt.Errorf("repository %s uses unknown credential %q", repository.Name, repository.Token)
+		}
+	}
+
+	return &f, nil
+}
+
+func validateSenders(senders []string) error {
+	for _, sender := range senders {
+		if !containsFold(senderNames, sender) {
+			return fmt.Errorf("unknown sender %q, must be one of %s", sender, strings.Join(senderNames, ", "))
+		}
+	}
+	return nil
+}
+
+// RepositoryNames returns the names of all repositories in the config file.
+func (f *FileConfig) RepositoryNames() []string {
+	names := make([]string, 0, len(f.Repositories))
+	for _, repository := range f.Repositories {
+		names = append(names, repository.Name)
+	}
+	return names
+}
+
+// Discussions returns the discussion categories to watch by repository.
+func (f *FileConfig) Discussions() map[string]string {
+	discussions := make(map[string]string)
+	for _, repository := range f.Repositories {
+		if repository.Discussions != "" {
+			discussions[repository.Name] = repository.Discussions
+		}
+	}
+	return discussions
+}
+
+// TokenFor returns the token for the repository given as owner/name:
+// its own credential, else its owner's or an empty string if there is none.
+func (f *FileConfig) TokenFor(repoName string) string {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) && repository.Token != "" {
+			return f.Credentials[repository.Token]
+		}
+	}
+
+	owner := strings.Split(repoName, "/")[0]
+	for name, credential := range f.Owners {
+		if strings.EqualFold(name, owner) {
+			return f.Credentials[credential]
+		}
+	}
+	return ""
+}
+
+// ReleaseLines returns the release lines to watch by repository.
+func (f *FileConfig) ReleaseLines() map[string]ReleaseLine {
+	lines := make(map[string]ReleaseLine)
+	for _, repository := range f.Repositories {
+		if repository.ReleaseLine != "" {
+			// Validated when loading the file.
+			lines[repository.Name], _ = ParseReleaseLine(repository.ReleaseLine)
+		}
+	}
+	return lines
+}
+
+// AssetPatternFor returns the pattern the assets of releases of the repository given as owner/name
+// must match, if it has one.
+func (f *FileConfig) AssetPatternFor(repoName string) (AssetPattern, bool) {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) && repository.AssetPattern != "" {
+			// Validated when loading the file.
+			pattern, _ := ParseAssetPattern(repository.AssetPattern)
+			return pattern, true
+		}
+	}
+	return AssetPattern{}, false
+}
+
+// CooldownFor returns the minimum interval between notifications about the repository given as owner/name,
+// 0 if it has none.
+func (f *FileConfig) CooldownFor(repoName string) time.Duration {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) {
+			return repository.MinIntervalBetweenNotifications
+		}
+	}
+	return 0
+}
+
+// PathsFor returns the paths of the repository given as owner/name whose changes releases are notified for,
+// none if all releases are.
+func (f *FileConfig) PathsFor(repoName string) []string {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) {
+			return repository.Paths
+		}
+	}
+	return nil
+}
+
+// RequiredAssetsFor returns the globs of the assets the releases of the repository given as owner/name
+// are held back for, none if it doesn't wait for assets.
+func (f *FileConfig) RequiredAssetsFor(repoName string) []string {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) {
+			return repository.RequireAssets
+		}
+	}
+	return nil
+}
+
+// ChecksFor returns how the repository given as owner/name takes the status checks of its releases into account,
+// an empty string if it doesn't.
+func (f *FileConfig) ChecksFor(repoName string) string {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) {
+			return repository.Checks
+		}
+	}
+	return ""
+}
+
+// IgnoreNonstableFor returns true if non-stable releases of the repository given as owner/name aren't notified,
+// its own setting if it has one, else the global one.
+func (f *FileConfig) IgnoreNonstableFor(repoName string, global bool) bool {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) && repository.IgnoreNonstable != nil {
+			return *repository.IgnoreNonstable
+		}
+	}
+	return global
+}
+
+// TagPatternFor returns the pattern the tags of releases of the repository given as owner/name must match,
+// nil if it has none.
+func (f *FileConfig) TagPatternFor(repoName string) *regexp.Regexp {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) && repository.TagPattern != "" {
+			// Validated when loading the file.
+			return regexp.MustCompile(repository.TagPattern)
+		}
+	}
+	return nil
+}
+
+// SlackChannelFor returns the Slack channel of the repository given as owner/name,
+// an empty string for the hook's own channel.
+func (f *FileConfig) SlackChannelFor(repoName string) string {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) {
+			return repository.SlackChannel
+		}
+	}
+	return ""
+}
+
+// IntervalFor returns how long to wait between checks of the repository given as owner/name,
+// 0 if it is checked every INTERVAL.
+func (f *FileConfig) IntervalFor(repoName string) time.Duration {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) {
+			return repository.Interval
+		}
+	}
+	return 0
+}
+
+// VersionFilterFor returns the filter of the releases of the repository given as owner/name.
+func (f *FileConfig) VersionFilterFor(repoName string) VersionFilter {
+	var filter VersionFilter
+	for _, repository := range f.Repositories {
+		if !strings.EqualFold(repository.Name, repoName) {
+			continue
+		}
+		// Validated when loading the file.
+		if repository.MinVersion != "" {
+			version, _ := ParseVersion(repository.MinVersion)
+			filter.MinVersion = &version
+		}
+		filter.MinBump = repository.MinBump
+		for _, pattern := range repository.TagsInclude {
+			filter.TagsInclude = append(filter.TagsInclude, regexp.MustCompile(pattern))
+		}
+		for _, pattern := range repository.TagsExclude {
+			filter.TagsExclude = append(filter.TagsExclude, regexp.MustCompile(pattern))
+		}
+		break
+	}
+	return filter
+}
+
+// NewnessFor returns the newness strategy of the repository given as owner/name,
+// newness if it isn't set for the repository.
+func (f *FileConfig) NewnessFor(repoName, newness string) string {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) && repository.Newness != "" {
+			return repository.Newness
+		}
+	}
+	return newness
+}
+
+// ModeFor returns whether the releases, tags or both of the repository given as owner/name are watched,
+// mode if it isn't set for the repository.
+func (f *FileConfig) ModeFor(repoName, mode string) string {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) && repository.Mode != "" {
+			return repository.Mode
+		}
+	}
+	return mode
+}
+
+// InitialNotifyFor returns true if the current release of the repository given as owner/name
+// is notified when it is checked for the first time.
+func (f *FileConfig) InitialNotifyFor(repoName string) bool {
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) && repository.InitialNotify != nil {
+			return *repository.InitialNotify
+		}
+	}
+	return f.InitialNotify
+}
+
+// SendsTo returns true if the repository given as owner/name is notified by the sender:
+// if it is in the repository's senders, else in the default senders or if there are none.
+func (f *FileConfig) SendsTo(repoName, sender string) bool {
+	senders := f.Senders
+	for _, repository := range f.Repositories {
+		if strings.EqualFold(repository.Name, repoName) && len(repository.Senders) > 0 {
+			senders = repository.Senders
+		}
+	}
+	return len(senders) == 0 || containsFold(senders, sender)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+const cooldownKeyPrefix = "cooldown/"
+
+// cooldownCheckInterval is how often releases held back during a cooldown are checked for being due.
+const cooldownCheckInterval = time.Minute
+
+// storedCooldown is what is kept of a repository's cooldown.
+type storedCooldown struct {
+	LastNotified time.Time `json:"last_notified"`
+	// Held is the newest release found during the cooldown, notified when it's over.
+	Held *Repository `json:"held,omitempty"`
+}
+
+// Cooldown caps how often repositories are notified about. After notifying about a repository,
+// its releases are held back until its interval passed, then only the newest one is notified.
+// The state is kept in the store, so the cooldown and held back releases survive restarts.
+type Cooldown struct {
+	store Store
+	// interval returns the repository's interval between notifications, 0 for none.
+	interval func(repoName string) time.Duration
+}
+
+func cooldownKey(repoName string) string {
+	return cooldownKeyPrefix + strings.ToLower(repoName)
+}
+
+// Hold holds back the repository's release, replacing an older one held back before,
+// and returns true if the repository was notified about less than its interval ago.
+// Otherwise the release is about to be notified, which starts a new cooldown.
+func (c *Cooldown) Hold(repository Repository, now time.Time) (bool, error) {
+	repoName := repository.Owner + "/" + repository.Name
+	if c.interval(repoName) <= 0 {
+		return false, nil
+	}
+
+	var stored storedCooldown
+	if _, err := c.store.Get(cooldownKey(repoName), &stored); err != nil {
+		return false, err
+	}
+	if now.Sub(stored.LastNotified) < c.interval(repoName) {
+		stored.Held = &repository
+		return true, c.store.Put(cooldownKey(repoName), stored)
+	}
+	return false, c.store.Put(cooldownKey(repoName), storedCooldown{LastNotified: now})
+}
+
+// Due returns the releases held back whose cooldown is over, starting a new one for their repositories.
+func (c *Cooldown) Due(now time.Time) ([]Repository, error) {
+	keys, err := c.store.Keys(cooldownKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []Repository
+	for _, key := range keys {
+		var stored storedCooldown
+		if _, err := c.store.Get(key, &stored); err != nil {
+			return due, err
+		}
+		if stored.Held == nil || now.Sub(stored.LastNotified) < c.interval(strings.TrimPrefix(key, cooldownKeyPrefix)) {
+			continue
+		}
+		if err := c.store.Put(key, storedCooldown{LastNotified: now}); err != nil {
+			return due, err
+		}
+		due = append(due, *stored.Held)
+	}
+	return due, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+const deliveryKeyPrefix = "delivery/"
+
+// Deliveries of a release failing for some senders are retried every deliveryRetryInterval,
+// up to deliveryMaxAttempts times in all.
+const (
+	deliveryRetryInterval = 5 * time.Minute
+	deliveryMaxAttempts   = 12
+)
+
+// storedDelivery is a release not delivered to all its senders yet.
+type storedDelivery struct {
+	Repository Repository `json:"repository"`
+	// Delivered are the senders that delivered the release, and the destinations of the ones
+	// that delivered it only to some, like slack:team-a.
+	Delivered []string `json:"delivered"`
+	Attempts  int      `json:"attempts"`
+}
+
+// partialDelivery is returned by senders delivering a release to several destinations if some of them failed.
+// Delivered are the ones that didn't, recorded like senders of their own so they aren't sent to again.
+type partialDelivery struct {
+	Delivered []string
+	err       error
+}
+
+func (e *partialDelivery) Error() string {
+	return e.err.Error()
+}
+
+// DeliveryLog keeps which senders delivered a release until all of them did,
+// so retries only go to the senders that failed, also after a restart.
+type DeliveryLog struct {
+	store Store
+}
+
+// deliveryKey is where the delivery of the repository's release is kept, after a # so it still
+// belongs to the repository, see keyRepository.
+func deliveryKey(repository Repository) string {
+	return deliveryKeyPrefix + strings.ToLower(repository.Owner+"/"+repository.Name) + "#" + repository.Release.Key()
+}
+
+// Delivered returns the senders that delivered the repository's release before.
+func (l *DeliveryLog) Delivered(repository Repository) ([]string, error) {
+	var stored storedDelivery
+	_, err := l.store.Get(deliveryKey(repository), &stored)
+	return stored.Delivered, err
+}
+
+// Record adds the senders that delivered the repository's release in an attempt.
+// Once all senders delivered it, the release is forgotten, as it is once it failed too often.
+// It returns true if the release is retried.
+func (l *DeliveryLog) Record(repository Repository, results []SenderResult) (bool, error) {
+	key := deliveryKey(repository)
+	var stored storedDelivery
+	known, err := l.store.Get(key, &stored)
+	if err != nil {
+		return false, err
+	}
+
+	failed := false
+	for _, result := range results {
+		delivered := []string{result.Sender}
+		if result.Err != nil {
+			failed = true
+			delivered = nil
+			if partial, ok := result.Err.(*partialDelivery); ok {
+				delivered = partial.Delivered
+			}
+		}
+		for _, sender := range delivered {
+			if !containsFold(stored.Delivered, sender) {
+				stored.Delivered = append(stored.Delivered, sender)
+			}
+		}
+	}
+	stored.Attempts++
+	if !failed || stored.Attempts >= deliveryMaxAttempts {
+		if !known {
+			return false, nil
+		}
+		return false, l.store.Delete(key)
+	}
+
+	stored.Repository = repository
+	stored.Repository.span = nil
+	stored.Repository.status = nil
+	return true, l.store.Put(key, stored)
+}
+
+// Pending returns the releases to retry delivering.
+func (l *DeliveryLog) Pending() ([]Repository, error) {
+	keys, err := l.store.Keys(deliveryKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Repository
+	for _, key := range keys {
+		var stored storedDelivery
+		if _, err := l.store.Get(key, &stored); err != nil {
+			return pending, err
+		}
+		pending = append(pending, stored.Repository)
+	}
+	return pending, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// desktopWaitLimit is how many notifications wait to be clicked at the same time on Linux,
+// further ones are shown without opening the release when clicked.
+const desktopWaitLimit = 10
+
+// desktopWaitTimeout is how long a notification waits to be clicked before it is given up on.
+const desktopWaitTimeout = time.Hour
+
+// DesktopSender pops up native desktop notifications.
+// Like the SQLite sender it uses the platform's command line tools:
+// notify-send on Linux, terminal-notifier or osascript on macOS.
+type DesktopSender struct {
+	logger   log.Logger
+	Messages Messages
+
+	warnOnce sync.Once
+
+	// mu guards the notifications waiting to be clicked, see waitForAction.
+	mu      sync.Mutex
+	waiting sync.WaitGroup
+	count   int
+	closed  bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// Send shows a notification for the repository's release.
+// Clicking it opens the release in the browser where the platform supports it.
+// Without a desktop to show notifications on, it only logs a warning once.
+func (s *DesktopSender) Send(repository Repository) error {
+	title := fmt.Sprintf("%s/%s", repository.Owner, repository.Name)
+	message := repository.Release.Name + " " + s.Messages.Action(repository)
+	url := repository.Release.URL.String()
+
+	cmd, err := desktopCommand(title, message, url)
+	if err != nil {
+		s.warnOnce.Do(func() {
+			level.Warn(s.logger).Log("msg", "can't show desktop notifications", "err", err)
+		})
+		return nil
+	}
+
+	if runtime.GOOS == "linux" {
+		// notify-send waits for the notification to be clicked or dismissed,
+		// so don't hold up the other notifications meanwhile.
+		if ctx, ok := s.startWaiting(); ok {
+			go s.waitForAction(ctx, cmd, url)
+			return nil
+		}
+		cmd = withoutAction(cmd)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to show desktop notification: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// startWaiting returns the context of a new notification waiting to be clicked,
+// false if too many are waiting already or the sender is closed.
+func (s *DesktopSender) startWaiting() (context.Context, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.count >= desktopWaitLimit {
+		return nil, false
+	}
+	if s.ctx == nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+	s.count++
+	s.waiting.Add(1)
+	return s.ctx, true
+}
+
+func (s *DesktopSender) doneWaiting() {
+	s.mu.Lock()
+	s.count--
+	s.mu.Unlock()
+	s.waiting.Done()
+}
+
+// waitForAction shows the notification and opens the release if it is clicked within desktopWaitTimeout.
+func (s *DesktopSender) waitForAction(ctx context.Context, cmd []string, url string) {
+	defer s.doneWaiting()
+	ctx, cancel := context.WithTimeout(ctx, desktopWaitTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, cmd[0], cmd[1:]...).Output()
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		// notify-send before libnotify 0.7.10 doesn't know about actions.
+		plain := withoutAction(cmd)
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := exec.CommandContext(ctx, plain[0], plain[1:]...).Run(); err != nil {
+			level.Warn(s.logger).Log("msg", "failed to show desktop notification", "err", err)
+		}
+		return
+	}
+	if strings.TrimSpace(string(out)) != "open" {
+		return
+	}
+	ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := exec.CommandContext(ctx, "xdg-open", url).Run(); err != nil {
+		level.Warn(s.logger).Log("msg", "failed to open release", "url", url, "err", err)
+	}
+}
+
+// Close stops waiting for notifications to be clicked and returns once their processes exited.
+func (s *DesktopSender) Close() {
+	s.mu.Lock()
+	s.closed = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+	s.waiting.Wait()
+}
+
+// withoutAction returns the notify-send command of desktopCommand without waiting for the notification to be clicked.
+func withoutAction(cmd []string) []string {
+	return []string{cmd[0], "--app-name=github-releases-notifier", cmd[len(cmd)-2], cmd[len(cmd)-1]}
+}
+
+// desktopCommand returns the command showing a notification on this platform
+// or an error if notifications can't be shown, e.g. on headless systems.
+func desktopCommand(title, message, url string) ([]string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return nil, fmt.Errorf("no display found")
+		}
+		if _, err := exec.LookPath("notify-send"); err != nil {
+			return nil, err
+		}
+		return []string{"notify-send", "--app-name=github-releases-notifier", "--wait", "--action=open=Open release", title, message}, nil
+	case "darwin":
+		if _, err := exec.LookPath("terminal-notifier"); err == nil {
+			return []string{"terminal-notifier", "-title", title, "-message", message, "-open", url}, nil
+		}
+		// osascript notifications can't open the release when clicked.
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptQuote(message), appleScriptQuote(title))
+		return []string{"osascript", "-e", script}, nil
+	default:
+		return nil, fmt.Errorf("desktop notifications aren't supported on %s", runtime.GOOS)
+	}
+}
+
+// appleScriptQuote returns s as an AppleScript string literal.
+func appleScriptQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Diff queries the latest release of every repository and writes it next to the last seen one in the state,
+// with whether a check would notify about it. It neither notifies nor changes the state.
+// It returns the number of releases a check would notify about and an error if not all repositories could be expanded
+// or queried. Entries failing to expand are diffed with their repositories of the last expansion, if there was one.
+func (c *Checker) Diff(repositories []string, w io.Writer) (int, error) {
+	if c.releases == nil {
+		c.releases = make(map[string]Repository)
+	}
+	repositories, expandErr := c.expand(repositories)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tLAST SEEN\tLATEST\tNOTIFY")
+
+	var notify, failed int
+	keys := c.keys(repositories)
+	for _, key := range keys {
+		repoName := keyRepository(key)
+
+		nextRepo, err := c.queryKey(context.Background(), nil, key)
+		if err == errNoReleaseOnLine {
+			fmt.Fprintf(tw, "%s\t-\t-\tno, no release on line %s\n", key, c.releaseLines[repoName])
+			continue
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(tw, "%s\t-\t-\tfailed: %v\n", key, err)
+			continue
+		}
+
+		currRepo, ok, err := c.lastSeen(key)
+		if err != nil {
+			failed++
+			fmt.Fprintf(tw, "%s\t-\t%s\tfailed to load the state: %v\n", key, diffRelease(nextRepo.Release), err)
+			continue
+		}
+
+		var decision string
+		switch {
+		case !ok && !c.backfillSince.IsZero() && key == repoName:
+			notify++
+			decision = "yes, first check, with the releases since " + c.backfillSince.String()
+		case !ok && c.initialNotify != nil && c.initialNotify(repoName):
+			notify++
+			decision = "yes, first check"
+		case !ok:
+			decision = "no, first check"
+		case c.isNewer(repoName, nextRepo.Release, currRepo.Release):
+			notify++
+			decision = "yes"
+		case renamed(nextRepo.Release, currRepo.Release) && c.notifyRenamed && c.strategy(repoName) != NewnessCreatedAfterLastSeen:
+			notify++
+			decision = "yes, renamed"
+		case renamed(nextRepo.Release, currRepo.Release):
+			decision = "no, renamed"
+		default:
+			decision = "no"
+		}
+
+		last := "-"
+		if ok {
+			last = diffRelease(currRepo.Release)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", key, last, diffRelease(nextRepo.Release), decision)
+	}
+	if err := tw.Flush(); err != nil {
+		return notify, err
+	}
+
+	switch {
+	case expandErr != nil && failed > 0:
+		return notify, fmt.Errorf("failed to expand the repositories (%v) and to query %d of %d repositories", expandErr, failed, len(keys))
+	case expandErr != nil:
+		return notify, fmt.Errorf("failed to expand the repositories: %v", expandErr)
+	case failed > 0:
+		return notify, fmt.Errorf("failed to query %d of %d repositories", failed, len(keys))
+	}
+	return notify, nil
+}
+
+// diffRelease returns how the release is shown in a diff, its tag if it has one.
+func diffRelease(release Release) string {
+	if release.TagName != "" {
+		return release.TagName
+	}
+	return release.Name
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const digestKeyPrefix = "digest/"
+
+// DigestSenderNames are the senders that can receive the scheduled digest.
+var DigestSenderNames = []string{"slack", "markdown", "email"}
+
+// ScheduledDigest collects the dispatched releases until the digest listing them is sent
+// at the times of DIGEST_SCHEDULE. They are kept in the state, so a restart doesn't lose them.
+type ScheduledDigest struct {
+	store Store
+}
+
+// digestKey is where the repository's release is kept until the digest, after a # so it still
+// belongs to the repository, see keyRepository.
+func digestKey(repository Repository) string {
+	return digestKeyPrefix + strings.ToLower(repository.Owner+"/"+repository.Name) + "#" + repository.Release.Key()
+}
+
+// Add collects the repository's release for the next digest.
+func (d *ScheduledDigest) Add(repository Repository) error {
+	repository.span = nil
+	repository.status = nil
+	return d.store.Put(digestKey(repository), repository)
+}
+
+// Collected returns the releases collected since the last digest, the earliest published first.
+func (d *ScheduledDigest) Collected() ([]Repository, error) {
+	keys, err := d.store.Keys(digestKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var collected []Repository
+	for _, key := range keys {
+		var repository Repository
+		if _, err := d.store.Get(key, &repository); err != nil {
+			return nil, err
+		}
+		collected = append(collected, repository)
+	}
+	sort.SliceStable(collected, func(i, j int) bool {
+		return collected[i].Release.PublishedAt.Before(collected[j].Release.PublishedAt)
+	})
+	return collected, nil
+}
+
+// Clear forgets the releases once a digest listed them.
+// Releases collected in the meantime are kept for the next one.
+func (d *ScheduledDigest) Clear(repositories []Repository) error {
+	for _, repository := range repositories {
+		if err := d.store.Delete(digestKey(repository)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// discordMaxDescription is the most an embed's description may have, in characters,
+	// which is at most as many as bytes.
+	discordMaxDescription = 4096
+	// discordMaxTitle is the most an embed's title may have.
+	discordMaxTitle = 256
+)
+
+// DiscordSender posts releases to a Discord channel through its webhook.
+type DiscordSender struct {
+	Hook string
+	// Fields of the release to include, its linked name and notes by default.
+	Fields   NotificationFields
+	Messages Messages
+	// Template, if set, renders the embed's description instead of Fields, see MessageData.
+	Template *template.Template
+}
+
+type discordPayload struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	URL         string              `json:"url,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+	Author      *discordEmbedAuthor `json:"author,omitempty"`
+}
+
+type discordEmbedAuthor struct {
+	Name    string `json:"name"`
+	URL     string `json:"url,omitempty"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+// Send posts the repository's release as an embed, linking to the release,
+// with the release notes cut to what fits into it.
+func (s *DiscordSender) Send(repository Repository) error {
+	fields := s.Fields.Or(FieldURL, FieldBody)
+	release := repository.Release
+
+	title := fmt.Sprintf("%s/%s: %s %s", repository.Owner, repository.Name, release.Name, s.Messages.Action(repository))
+	if len(title) > discordMaxTitle {
+		title = title[:discordMaxTitle-3] + "..."
+	}
+	embed := discordEmbed{
+		Title:     title,
+		Timestamp: release.PublishedAt.UTC().Format(time.RFC3339),
+	}
+	if fields.Has(FieldURL) {
+		embed.URL = release.URL.String()
+	}
+
+	description := fields.Details(release, s.Messages)
+	if s.Template != nil {
+		text, err := renderMessage(s.Template, repository, s.Messages)
+		if err != nil {
+			return err
+		}
+		description = []string{truncate(discordMaxDescription, text)}
+	} else if fields.Has(FieldBody) && release.Description != "" {
+		if release.FullDescription != "" {
+			release.Description = release.FullDescription
+		}
+		// The details come first, the notes get what is left, at least the notice that they were cut.
+		limit := discordMaxDescription - len(strings.Join(description, "\n")) - 2
+		if limit < 1 {
+			limit = 1
+		}
+		description = append(description, "", release.Normalized(limit, s.Messages).Description)
+	}
+	embed.Description = strings.TrimSpace(strings.Join(description, "\n"))
+
+	// The author links to their profile, next to their avatar.
+	if fields.Has(FieldAvatar) && release.AuthorURL != "" {
+		embed.Author = &discordEmbedAuthor{Name: release.Author, URL: release.AuthorURL, IconURL: release.AuthorAvatarURL}
+	}
+
+	return postJSON(s.Hook, discordPayload{Username: "GitHub Releases", Embeds: []discordEmbed{embed}})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	githubql "github.com/shurcooL/githubql"
+)
+
+// discussionsSuffix is appended to a repository's name to keep track of
+// its discussions announcements separately from its releases.
+const discussionsSuffix = "#discussions"
+
+// queryDiscussions returns the repository with the latest discussion post
+// in the given category as its release.
+func (c *Checker) queryDiscussions(ctx context.Context, span *Span, owner, name, category string) (Repository, error) {
+	categoryID, err := c.discussionCategory(ctx, owner, name, category)
+	if err != nil {
+		return Repository{}, err
+	}
+
+	var query struct {
+		RateLimit  rateLimit
+		Repository struct {
+			ID          githubql.ID
+			Name        githubql.String
+			Description githubql.String
+			URL         githubql.URI
+
+			Discussions struct {
+				Nodes []struct {
+					ID        githubql.ID
+					Title     githubql.String
+					Body      githubql.String
+					URL       githubql.URI
+					CreatedAt githubql.DateTime
+					Author    *releaseAuthor
+				}
+			} `graphql:"discussions(first: 1, categoryId: $categoryId, orderBy: {field: CREATED_AT, direction: DESC})"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner":      githubql.String(owner),
+		"name":       githubql.String(name),
+		"categoryId": categoryID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout(5*time.Second))
+	defer cancel()
+	if err := c.clientFor(owner+"/"+name).Query(ctx, &query, variables); err != nil {
+		return Repository{}, err
+	}
+	query.RateLimit.record(span)
+
+	repositoryID, ok := query.Repository.ID.(string)
+	if !ok {
+		return Repository{}, fmt.Errorf("can't convert repository id to string: %v", query.Repository.ID)
+	}
+
+	if len(query.Repository.Discussions.Nodes) == 0 {
+		return Repository{}, fmt.Errorf("can't find any discussions in %s for %s/%s", category, owner, name)
+	}
+	latest := query.Repository.Discussions.Nodes[0]
+
+	discussionID, ok := latest.ID.(string)
+	if !ok {
+		return Repository{}, fmt.Errorf("can't convert discussion id to string: %v", latest.ID)
+	}
+
+	// Announcements are published when they are created.
+	release := Release{
+		ID:          discussionID,
+		Name:        string(latest.Title),
+		Description: string(latest.Body),
+		URL:         *latest.URL.URL,
+		PublishedAt: latest.CreatedAt.Time,
+		CreatedAt:   latest.CreatedAt.Time,
+	}
+	latest.Author.set(&release)
+
+	return Repository{
+		ID:          repositoryID,
+		Name:        string(query.Repository.Name),
+		Owner:       owner,
+		Description: string(query.Repository.Description),
+		URL:         *query.Repository.URL.URL,
+		Release:     release,
+	}, nil
+}
+
+// discussionCategory looks up the ID of the repository's discussion category by its name.
+// Found IDs are cached, as categories are hardly ever renamed.
+func (c *Checker) discussionCategory(ctx context.Context, owner, name, category string) (githubql.ID, error) {
+	key := owner + "/" + name + "/" + strings.ToLower(category)
+	c.categoriesMu.Lock()
+	id, ok := c.categories[key]
+	c.categoriesMu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	var query struct {
+		Repository struct {
+			DiscussionCategories struct {
+				Nodes []struct {
+					ID   githubql.ID
+					Name githubql.String
+				}
+			} `graphql:"discussionCategories(first: 100)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner": githubql.String(owner),
+		"name":  githubql.String(name),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout(5*time.Second))
+	defer cancel()
+	if err := c.clientFor(owner+"/"+name).Query(ctx, &query, variables); err != nil {
+		return nil, err
+	}
+
+	for _, node := range query.Repository.DiscussionCategories.Nodes {
+		if strings.EqualFold(string(node.Name), category) {
+			c.categoriesMu.Lock()
+			if c.categories == nil {
+				c.categories = make(map[string]githubql.ID)
+			}
+			c.categories[key] = node.ID
+			c.categoriesMu.Unlock()
+			return node.ID, nil
+		}
+	}
+	return nil, fmt.Errorf("can't find discussion category %q for %s/%s", category, owner, name)
+}
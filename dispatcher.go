@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dispatcher hands releases to the senders.
+// Deliveries for the same repository are serialized and ordered by their
+// publish time while different repositories are delivered in parallel,
+// up to a limit of concurrent deliveries.
+type Dispatcher struct {
+	send     func(Repository)
+	interval time.Duration
+	// slots limits the concurrent deliveries, nil for no limit.
+	slots chan struct{}
+
+	mu     sync.Mutex
+	queues map[string]chan Repository
+	wg     sync.WaitGroup
+	// queued counts the releases not delivered yet, see Drain.
+	queued sync.WaitGroup
+}
+
+// NewDispatcher returns a Dispatcher calling send for every release.
+// Two deliveries for the same repository are at least interval apart
+// and at most concurrency deliveries run at the same time, 0 means no limit.
+func NewDispatcher(interval time.Duration, concurrency int, send func(Repository)) *Dispatcher {
+	d := &Dispatcher{
+		send:     send,
+		interval: interval,
+		queues:   make(map[string]chan Repository),
+	}
+	if concurrency > 0 {
+		d.slots = make(chan struct{}, concurrency)
+	}
+	return d
+}
+
+// Dispatch queues the repository's release for delivery.
+func (d *Dispatcher) Dispatch(repository Repository) {
+	key := repository.Owner + "/" + repository.Name
+
+	d.mu.Lock()
+	queue, ok := d.queues[key]
+	if !ok {
+		queue = make(chan Repository, 100)
+		d.queues[key] = queue
+		d.wg.Add(1)
+		go d.deliver(queue)
+	}
+	d.mu.Unlock()
+
+	d.queued.Add(1)
+	queue <- repository
+}
+
+// Drain waits for the releases queued so far to be delivered, without closing the dispatcher.
+// Releases must not be dispatched in the meantime.
+func (d *Dispatcher) Drain() {
+	d.queued.Wait()
+}
+
+// Close waits for all queued releases to be delivered.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	for key, queue := range d.queues {
+		close(queue)
+		delete(d.queues, key)
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) deliver(queue <-chan Repository) {
+	defer d.wg.Done()
+
+	var pending []Repository
+	for repository := range queue {
+		pending = append(pending[:0], repository)
+
+		// Pick up everything queued in the meantime,
+		// so releases detected out of order are still delivered in order.
+	drain:
+		for {
+			select {
+			case next, ok := <-queue:
+				if !ok {
+					break drain
+				}
+				pending = append(pending, next)
+			default:
+				break drain
+			}
+		}
+
+		sort.SliceStable(pending, func(i, j int) bool {
+			return pending[i].Release.PublishedAt.Before(pending[j].Release.PublishedAt)
+		})
+
+		for _, next := range pending {
+			if d.slots != nil {
+				d.slots <- struct{}{}
+			}
+			d.send(next)
+			if d.slots != nil {
+				<-d.slots
+			}
+			d.queued.Done()
+			if d.interval > 0 {
+				time.Sleep(d.interval)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func dispatched(owner, name, tag string, published time.Time) Repository {
+	return Repository{Owner: owner, Name: name, Release: Release{TagName: tag, PublishedAt: published}}
+}
+
+func TestDispatcherOrdersReleasesPerRepository(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	block := make(chan struct{})
+	d := NewDispatcher(0, 0, func(repository Repository) {
+		if repository.Release.TagName == "v0" {
+			<-block
+		}
+		mu.Lock()
+		sent = append(sent, repository.Release.TagName)
+		mu.Unlock()
+	})
+
+	start := time.Date(2021, 3, 10, 0, 0, 0, 0, time.UTC)
+	d.Dispatch(dispatched("octocat", "hello", "v0", start))
+	// While v0 is being delivered, the others are detected out of order.
+	for _, day := range []int{3, 1, 2} {
+		d.Dispatch(dispatched("octocat", "hello", fmt.Sprintf("v%d", day), start.AddDate(0, 0, day)))
+	}
+	close(block)
+	d.Drain()
+
+	want := []string{"v0", "v1", "v2", "v3"}
+	if len(sent) != len(want) {
+		t.Fatalf("sent %v, want %v", sent, want)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Fatalf("sent %v, want %v", sent, want)
+		}
+	}
+	d.Close()
+}
+
+func TestDispatcherDeliversRepositoriesInParallel(t *testing.T) {
+	block := make(chan struct{})
+	other := make(chan struct{})
+	d := NewDispatcher(0, 0, func(repository Repository) {
+		if repository.Name == "blocked" {
+			<-block
+			return
+		}
+		close(other)
+	})
+	defer d.Close()
+	defer close(block)
+
+	d.Dispatch(dispatched("octocat", "blocked", "v1", time.Now()))
+	d.Dispatch(dispatched("octocat", "other", "v1", time.Now()))
+	select {
+	case <-other:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a blocked repository held up another one")
+	}
+}
+
+func TestDispatcherLimitsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, most := 0, 0
+	d := NewDispatcher(0, 2, func(repository Repository) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		d.Dispatch(dispatched("octocat", name, "v1", time.Now()))
+	}
+	d.Close()
+
+	if most != 2 {
+		t.Errorf("%d deliveries ran at the same time, want 2", most)
+	}
+}
+
+func TestDispatcherSpacesDeliveriesPerRepository(t *testing.T) {
+	interval := 20 * time.Millisecond
+	var times []time.Time
+	d := NewDispatcher(interval, 0, func(Repository) { times = append(times, time.Now()) })
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		d.Dispatch(dispatched("octocat", "hello", "v1", start.Add(time.Duration(i))))
+	}
+	d.Close()
+
+	if len(times) != 3 {
+		t.Fatalf("%d deliveries, want 3", len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < interval {
+			t.Errorf("delivery %d came %v after the previous one, want at least %v", i, gap, interval)
+		}
+	}
+}
+
+func TestDispatcherDrainKeepsItOpen(t *testing.T) {
+	var mu sync.Mutex
+	sent := 0
+	d := NewDispatcher(0, 0, func(Repository) {
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		sent++
+		mu.Unlock()
+	})
+	defer d.Close()
+
+	for round := 1; round <= 2; round++ {
+		for _, name := range []string{"a", "b", "a"} {
+			d.Dispatch(dispatched("octocat", name, "v1", time.Now()))
+		}
+		d.Drain()
+		mu.Lock()
+		got := sent
+		mu.Unlock()
+		if got != 3*round {
+			t.Fatalf("round %d: %d delivered after draining, want %d", round, got, 3*round)
+		}
+	}
+}
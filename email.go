@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SMTPStartTLS upgrades the connection to the SMTP server with STARTTLS, e.g. on port 587.
+	SMTPStartTLS = "starttls"
+	// SMTPTLS connects to the SMTP server with TLS right away, e.g. on port 465.
+	SMTPTLS = "tls"
+	// SMTPPlain sends emails unencrypted, e.g. to a relay on localhost.
+	SMTPPlain = "none"
+)
+
+// defaultEmailTemplate renders the emails without EMAIL_TEMPLATE_FILE.
+const defaultEmailTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2>{{.Title}}</h2>
+{{range .Releases}}
+<h3><a href="{{.URL.String}}">{{.Owner}}/{{.Name}}</a>: <a href="{{.Release.URL.String}}">{{.Release.Name}}</a> {{.Action}}</h3>
+{{if .CompareURL}}<p><a href="{{.CompareURL}}">{{$.Messages.ChangesSince .Repository}}</a></p>{{end}}
+{{if and (not $.Digest) .Release.Description}}<pre style="white-space: pre-wrap; font-family: inherit">{{.Release.Description}}</pre>{{end}}
+{{end}}
+{{if .More}}<p>{{.More}}</p>{{end}}
+</body>
+</html>
+`
+
+// EmailSender sends releases by email through an SMTP server, one email per release or as the scheduled digest.
+type EmailSender struct {
+	Host string
+	Port int
+	// TLS is SMTPStartTLS, SMTPTLS or SMTPPlain.
+	TLS string
+	// Username and Password authenticate with the server if set.
+	Username string
+	Password string
+	From     string
+	To       []string
+	// Template renders the emails' HTML, see EmailData.
+	Template *template.Template
+	Messages Messages
+	// DigestSort and DigestLimit order and cut off the releases of the digest, see Digest.
+	DigestSort  string
+	DigestLimit int
+}
+
+// EmailData is what email templates render: the releases with their repositories, like message templates get them,
+// the email's title, whether it is the digest, the digest's "… and N more" if it was cut off, and the messages
+// in the notification's language, e.g. {{.Messages.Digest}}.
+type EmailData struct {
+	Title    string
+	Digest   bool
+	Releases []MessageData
+	More     string
+	Messages Messages
+}
+
+// LoadEmailTemplate parses the HTML template of the emails from the file at path,
+// the default template if path is empty.
+func LoadEmailTemplate(path string) (*template.Template, error) {
+	text := defaultEmailTemplate
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("email template: %v", err)
+		}
+		text = string(data)
+	}
+	t, err := template.New("email").Funcs(template.FuncMap(templateFuncs)).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("email template: %v", err)
+	}
+	return t, nil
+}
+
+// Send emails the repository's release.
+func (s *EmailSender) Send(repository Repository) error {
+	title := fmt.Sprintf("%s/%s: %s %s", repository.Owner, repository.Name, repository.Release.Name, s.Messages.Action(repository))
+	return s.send(title, EmailData{
+		Title:    title,
+		Releases: []MessageData{{Repository: repository, Action: s.Messages.Action(repository)}},
+		Messages: s.Messages,
+	})
+}
+
+// SendDigest emails the releases collected for the scheduled digest.
+func (s *EmailSender) SendDigest(repositories []Repository) error {
+	listed, more := Digest(repositories, s.DigestSort, s.DigestLimit)
+	data := EmailData{Title: s.Messages.Digest, Digest: true, Messages: s.Messages}
+	for _, repository := range listed {
+		data.Releases = append(data.Releases, MessageData{Repository: repository, Action: s.Messages.Action(repository)})
+	}
+	if more > 0 {
+		data.More = fmt.Sprintf(s.Messages.AndMore, more)
+	}
+	return s.send(data.Title, data)
+}
+
+// send renders the email from the data and sends it with the subject.
+func (s *EmailSender) send(subject string, data EmailData) error {
+	var body bytes.Buffer
+	if err := s.Template.Execute(&body, data); err != nil {
+		return err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", s.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&message)
+	if _, err := qp.Write(body.Bytes()); err != nil {
+		return err
+	}
+	if err := qp.Close(); err != nil {
+		return err
+	}
+
+	return s.deliver(message.Bytes())
+}
+
+// deliver sends the message to all recipients in one session with the server.
+func (s *EmailSender) deliver(message []byte) error {
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	tlsConfig := &tls.Config{ServerName: s.Host}
+
+	var conn net.Conn
+	var err error
+	if s.TLS == SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	// A server that stops answering must not block the delivery forever.
+	if err := conn.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.TLS == SMTPStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS: %v", err)
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("smtp server rejected the credentials, check SMTP_USERNAME and SMTP_PASSWORD: %v", err)
+		}
+	}
+	if err := client.Mail(envelopeAddress(s.From)); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err := client.Rcpt(envelopeAddress(to)); err != nil {
+			return fmt.Errorf("smtp server rejected recipient %s: %v", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// envelopeAddress returns the bare address of an address like "Releases <releases@example.com>".
+func envelopeAddress(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		return parsed.Address
+	}
+	return address
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultGithubAPIURL is the REST API of github.com, whose GraphQL API is at /graphql.
+const DefaultGithubAPIURL = "https://api.github.com"
+
+// GraphQLURL returns the GraphQL endpoint next to the REST API at apiURL:
+// https://api.github.com/graphql for github.com and https://<host>/api/graphql for GitHub Enterprise Server,
+// whose REST API is at https://<host>/api/v3.
+func GraphQLURL(apiURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(apiURL, "/"))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("GitHub API URL %q is not an http(s) URL", apiURL)
+	}
+	if strings.HasSuffix(u.Path, "/v3") {
+		u.Path = strings.TrimSuffix(u.Path, "/v3")
+	}
+	u.Path += "/graphql"
+	return u.String(), nil
+}
+
+// splitHost returns the host of a repository given as host/owner/name, e.g. ghe.example.com/platform/tools,
+// and its owner/name. Repositories of the GitHub of GITHUB_API_URL come without a host.
+func splitHost(entry string) (host, repoName string) {
+	if strings.Contains(entry, ":") || strings.Count(entry, "/") != 2 {
+		return "", entry
+	}
+	i := strings.Index(entry, "/")
+	return entry[:i], entry[i+1:]
+}
+
+// ParseHostTokens parses the tokens of hosts like GitHub Enterprise Servers or GitLab instances, given as host=token.
+func ParseHostTokens(entries []string) (map[string]string, error) {
+	tokens := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		i := strings.Index(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("host token %q is not of the form host=token", strings.SplitN(entry, "=", 2)[0]+"=…")
+		}
+		tokens[strings.ToLower(entry[:i])] = entry[i+1:]
+	}
+	return tokens, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReleaseEventSchemaVersion is the version of the ReleaseEvent schema.
+// It is increased on incompatible changes, like removing or renaming fields,
+// while new fields can be added without increasing it.
+const ReleaseEventSchemaVersion = 1
+
+// ReleaseEvent is the JSON document machine-readable senders send for a release.
+// All of them share it, so consumers only have to know one schema.
+type ReleaseEvent struct {
+	SchemaVersion int                    `json:"schema_version"`
+	DetectedAt    time.Time              `json:"detected_at"`
+	Repository    ReleaseEventRepository `json:"repository"`
+	Release       ReleaseEventRelease    `json:"release"`
+	// Previous is the release seen before, if known.
+	Previous *ReleaseEventRelease `json:"previous,omitempty"`
+	// PromotedFrom is the tag of the pre-release seen before of a stable release's version.
+	PromotedFrom string `json:"promoted_from,omitempty"`
+	// ChangeLevel is the semantic version change from the previous release, major, minor or patch, if known.
+	ChangeLevel string `json:"change_level,omitempty"`
+	// CompareURL links to the changes since the previous release and Commits counts them, if known.
+	CompareURL string `json:"compare_url,omitempty"`
+	Commits    int    `json:"commits,omitempty"`
+}
+
+// ReleaseEventRepository is the repository of a ReleaseEvent.
+type ReleaseEventRepository struct {
+	ID          string `json:"id"`
+	Owner       string `json:"owner"`
+	Name        string `json:"name"`
+	FullName    string `json:"full_name"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+}
+
+// ReleaseEventRelease is a release of a ReleaseEvent.
+type ReleaseEventRelease struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	TagName     string    `json:"tag_name"`
+	URL         string    `json:"url"`
+	Prerelease  bool      `json:"prerelease"`
+	Author      string    `json:"author,omitempty"`
+	Body        string    `json:"body"`
+	Downloads   int       `json:"downloads"`
+	PublishedAt time.Time `json:"published_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Version is the release's semantic version, if it has one.
+	Version *ReleaseEventVersion `json:"version,omitempty"`
+}
+
+// ReleaseEventVersion is the semantic version of a ReleaseEventRelease.
+type ReleaseEventVersion struct {
+	Major      int    `json:"major"`
+	Minor      int    `json:"minor"`
+	Patch      int    `json:"patch"`
+	Prerelease string `json:"prerelease,omitempty"`
+	Build      string `json:"build,omitempty"`
+}
+
+// NewReleaseEvent returns the event for the repository's release.
+func NewReleaseEvent(repository Repository) ReleaseEvent {
+	event := ReleaseEvent{
+		SchemaVersion: ReleaseEventSchemaVersion,
+		DetectedAt:    time.Now().UTC(),
+		Repository: ReleaseEventRepository{
+			ID:          repository.ID,
+			Owner:       repository.Owner,
+			Name:        repository.Name,
+			FullName:    repository.Owner + "/" + repository.Name,
+			Description: repository.Description,
+			URL:         repository.URL.String(),
+		},
+		Release:      newReleaseEventRelease(repository.Release),
+		PromotedFrom: repository.PromotedFrom,
+		ChangeLevel:  repository.ChangeLevel(),
+		CompareURL:   repository.CompareURL(),
+		Commits:      repository.Commits,
+	}
+	if repository.Previous != nil {
+		previous := newReleaseEventRelease(*repository.Previous)
+		event.Previous = &previous
+	}
+	return event
+}
+
+func newReleaseEventRelease(release Release) ReleaseEventRelease {
+	event := ReleaseEventRelease{
+		ID:          release.ID,
+		Name:        release.Name,
+		TagName:     release.TagName,
+		URL:         release.URL.String(),
+		Prerelease:  release.IsPrerelease,
+		Author:      release.Author,
+		Body:        release.Description,
+		Downloads:   release.Downloads(),
+		PublishedAt: release.PublishedAt.UTC(),
+		CreatedAt:   release.CreatedAt.UTC(),
+	}
+	if version, err := release.Version(); err == nil {
+		event.Version = &ReleaseEventVersion{
+			Major:      version.Major,
+			Minor:      version.Minor,
+			Patch:      version.Patch,
+			Prerelease: strings.Join(version.Prerelease, "."),
+			Build:      version.Build,
+		}
+	}
+	return event
+}
+
+// MarshalReleaseEvent returns the JSON encoded event for the repository's release,
+// with its fields renamed by names.
+func MarshalReleaseEvent(repository Repository, names EventFieldNames) ([]byte, error) {
+	data, err := json.Marshal(NewReleaseEvent(repository))
+	if err != nil || len(names) == 0 {
+		return data, err
+	}
+	return names.apply(data)
+}
+
+// EventFieldNames renames fields of JSON encoded release events to adapt them to a consumer's schema.
+// The fields are given by their path in the event, like release.tag_name.
+type EventFieldNames map[string]string
+
+// ParseEventFieldNames parses renames like repository.full_name=repo.
+// The paths must be fields of the event and the new names must not clash with the fields next to them.
+func ParseEventFieldNames(entries []string) (EventFieldNames, error) {
+	names := make(EventFieldNames, len(entries))
+	for _, entry := range entries {
+		i := strings.Index(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("event field name %q is not of the form path=name", entry)
+		}
+		names[entry[:i]] = entry[i+1:]
+	}
+
+	// An event with all optional fields tells the paths there are.
+	previous := Release{Name: "v1", TagName: "v1.0.0", Author: "octocat"}
+	sample, err := json.Marshal(NewReleaseEvent(Repository{
+		Release:      Release{Name: "v2", TagName: "v2.0.0-rc.2+build.1", Author: "octocat"},
+		Previous:     &previous,
+		PromotedFrom: "v2-rc.1",
+		Commits:      1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal(sample, &event); err != nil {
+		return nil, err
+	}
+	paths := eventFieldPaths(event, "")
+	for path := range names {
+		if i := sort.SearchStrings(paths, path); i == len(paths) || paths[i] != path {
+			return nil, fmt.Errorf("unknown event field %q, must be one of %s", path, strings.Join(paths, ", "))
+		}
+	}
+	if _, err := names.apply(sample); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// eventFieldPaths returns the paths of the object's fields and of the fields of objects in it, in order.
+func eventFieldPaths(object map[string]interface{}, prefix string) []string {
+	var paths []string
+	for key, value := range object {
+		paths = append(paths, prefix+key)
+		if nested, ok := value.(map[string]interface{}); ok {
+			paths = append(paths, eventFieldPaths(nested, prefix+key+".")...)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// apply renames the fields of the JSON encoded event.
+func (n EventFieldNames) apply(data []byte) ([]byte, error) {
+	// Numbers are decoded as they are, so they are encoded again unchanged.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var event map[string]interface{}
+	if err := decoder.Decode(&event); err != nil {
+		return nil, err
+	}
+	renamed, err := n.rename(event, "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(renamed)
+}
+
+// rename returns the object with its fields renamed, looking up the fields by their path after prefix.
+func (n EventFieldNames) rename(object map[string]interface{}, prefix string) (map[string]interface{}, error) {
+	renamed := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		path := prefix + key
+		if nested, ok := value.(map[string]interface{}); ok {
+			var err error
+			if value, err = n.rename(nested, path+"."); err != nil {
+				return nil, err
+			}
+		}
+		if name, ok := n[path]; ok {
+			key = name
+		}
+		if _, ok := renamed[key]; ok {
+			return nil, fmt.Errorf("event field %q is renamed to the name of another field next to it", path)
+		}
+		renamed[key] = value
+	}
+	return renamed, nil
+}
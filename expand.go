@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	githubql "github.com/shurcooL/githubql"
+)
+
+const (
+	// starsPrefix expands a user's starred repositories, e.g. stars:octocat or stars:me for the token's user.
+	starsPrefix = "stars:"
+	// searchPrefix expands the repositories found by a search, e.g. search:topic:kubernetes stars:>1000.
+	searchPrefix = "search:"
+	// searchResultLimit is the most results GitHub returns for a search.
+	searchResultLimit = 1000
+)
+
+// isExpansion returns true if the entry stands for a list of repositories rather than a single one.
+func isExpansion(entry string) bool {
+	return strings.HasPrefix(entry, starsPrefix) || strings.HasPrefix(entry, searchPrefix) ||
+		strings.HasPrefix(entry, orgPrefix) || strings.HasPrefix(entry, userPrefix)
+}
+
+// expand replaces entries like stars:octocat or org:kubernetes with the repositories they stand for.
+// If expanding an entry fails, its repositories of the last successful expansion are used
+// and the last error is returned along with them.
+func (c *Checker) expand(entries []string) ([]string, error) {
+	var lastErr error
+	repositories := make([]string, 0, len(entries))
+	add := func(repoName string) {
+		if !containsFold(repositories, repoName) {
+			repositories = append(repositories, repoName)
+		}
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, actionPrefix) {
+			repoName, err := actionRepository(strings.TrimPrefix(entry, actionPrefix))
+			if err != nil {
+				lastErr = err
+				level.Warn(c.logger).Log("msg", "not watching invalid action", "entry", entry, "err", err)
+				continue
+			}
+			add(repoName + tagsSuffix)
+			continue
+		}
+		if !isExpansion(entry) {
+			add(entry)
+			continue
+		}
+
+		var expanded []string
+		var err error
+		switch {
+		case strings.HasPrefix(entry, searchPrefix):
+			expanded, err = c.expandSearch(strings.TrimPrefix(entry, searchPrefix))
+		case strings.HasPrefix(entry, orgPrefix):
+			expanded, err = c.expandOwner(strings.TrimPrefix(entry, orgPrefix), false)
+		case strings.HasPrefix(entry, userPrefix):
+			expanded, err = c.expandOwner(strings.TrimPrefix(entry, userPrefix), true)
+		default:
+			expanded, err = c.expandStars(strings.TrimPrefix(entry, starsPrefix))
+		}
+		if err != nil {
+			lastErr = err
+			level.Warn(c.logger).Log(
+				"msg", "failed to expand repositories, using the last expansion",
+				"entry", entry,
+				"err", err,
+			)
+			expanded = c.expansions[entry]
+		} else {
+			if c.expansions == nil {
+				c.expansions = make(map[string][]string)
+			}
+			c.expansions[entry] = expanded
+		}
+		for _, repoName := range expanded {
+			add(repoName)
+		}
+	}
+	return repositories, lastErr
+}
+
+// expandedRepository is a repository found by an expansion.
+type expandedRepository struct {
+	NameWithOwner githubql.String
+	IsFork        githubql.Boolean
+	IsArchived    githubql.Boolean
+}
+
+type starredRepositories struct {
+	Nodes    []expandedRepository
+	PageInfo struct {
+		EndCursor   githubql.String
+		HasNextPage githubql.Boolean
+	}
+}
+
+// expandStars returns the repositories starred by the user, me being the token's user.
+func (c *Checker) expandStars(login string) ([]string, error) {
+	var repositories []string
+	variables := map[string]interface{}{
+		"cursor": (*githubql.String)(nil),
+	}
+	if login != "me" {
+		variables["login"] = githubql.String(login)
+	}
+
+	for {
+		var viewer struct {
+			Viewer struct {
+				StarredRepositories starredRepositories `graphql:"starredRepositories(first: 100, after: $cursor)"`
+			}
+		}
+		var user struct {
+			User *struct {
+				StarredRepositories starredRepositories `graphql:"starredRepositories(first: 100, after: $cursor)"`
+			} `graphql:"user(login: $login)"`
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var page starredRepositories
+		var err error
+		if login == "me" {
+			err = c.client.Query(ctx, &viewer, variables)
+			page = viewer.Viewer.StarredRepositories
+		} else {
+			err = c.client.Query(ctx, &user, variables)
+			if err == nil && user.User == nil {
+				err = fmt.Errorf("can't find user %s", login)
+			}
+			if user.User != nil {
+				page = user.User.StarredRepositories
+			}
+		}
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range page.Nodes {
+			if c.watchExpanded(node) {
+				repositories = append(repositories, string(node.NameWithOwner))
+			}
+		}
+		if !page.PageInfo.HasNextPage {
+			return repositories, nil
+		}
+		variables["cursor"] = githubql.NewString(page.PageInfo.EndCursor)
+	}
+}
+
+// expandSearch returns the repositories found by the search query,
+// up to the checker's search limit in the order of GitHub's best match.
+func (c *Checker) expandSearch(query string) ([]string, error) {
+	limit := c.searchLimit
+	if limit <= 0 || limit > searchResultLimit {
+		limit = searchResultLimit
+	}
+
+	var repositories []string
+	variables := map[string]interface{}{
+		"query":  githubql.String(query),
+		"cursor": (*githubql.String)(nil),
+	}
+	for {
+		first := limit - len(repositories)
+		if first > 100 {
+			first = 100
+		}
+		variables["first"] = githubql.Int(first)
+
+		var search struct {
+			Search struct {
+				Nodes []struct {
+					Repository expandedRepository `graphql:"... on Repository"`
+				}
+				PageInfo struct {
+					EndCursor   githubql.String
+					HasNextPage githubql.Boolean
+				}
+			} `graphql:"search(query: $query, type: REPOSITORY, first: $first, after: $cursor)"`
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := c.client.Query(ctx, &search, variables)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range search.Search.Nodes {
+			if len(repositories) < limit && c.watchExpanded(node.Repository) {
+				repositories = append(repositories, string(node.Repository.NameWithOwner))
+			}
+		}
+		if !search.Search.PageInfo.HasNextPage || len(repositories) >= limit {
+			return repositories, nil
+		}
+		variables["cursor"] = githubql.NewString(search.Search.PageInfo.EndCursor)
+	}
+}
+
+// watchExpanded returns false for forks unless the checker includes them, for archived repositories
+// if it skips them, and for those its filter doesn't watch.
+// Forks often mirror the releases of their upstream, which is noise when watching many repositories at once.
+func (c *Checker) watchExpanded(repository expandedRepository) bool {
+	if bool(repository.IsFork) && !c.includeForks {
+		return false
+	}
+	if bool(repository.IsArchived) && c.skipArchived {
+		return false
+	}
+	return c.filter.Watches(string(repository.NameWithOwner))
+}
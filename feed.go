@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// atomFeed is an Atom feed (RFC 4287) of releases.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Author    atomAuthor `xml:"author"`
+	Link      *atomLink  `xml:"link"`
+	Content   *atomText  `xml:"content,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Feed returns up to n of the releases in the history, of the repository given as owner/name
+// or of all repositories if it is empty, the most recently published first.
+func (h *History) Feed(repoName string, n int) ([]Repository, error) {
+	var releases []Repository
+	if repoName != "" {
+		if _, err := h.store.Get(historyKey(repoName), &releases); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if releases, err = h.Recent(historyLength); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].Release.PublishedAt.After(releases[j].Release.PublishedAt)
+	})
+	if len(releases) > n {
+		releases = releases[:n]
+	}
+	return releases, nil
+}
+
+// writeFeed writes the releases as Atom feed with the title, its own link being self.
+func writeFeed(w io.Writer, title, self string, releases []Repository, messages Messages) error {
+	feed := atomFeed{
+		ID:      self,
+		Title:   title,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Rel: "self", Href: self}},
+	}
+	if len(releases) > 0 {
+		feed.Updated = feedTime(releases[0].Release).Format(time.RFC3339)
+	}
+	for _, repository := range releases {
+		release := repository.Release
+		entry := atomEntry{
+			ID:      release.URL.String(),
+			Title:   repository.Owner + "/" + repository.Name + ": " + release.Name + " " + messages.Action(repository),
+			Updated: feedTime(release).Format(time.RFC3339),
+			Author:  atomAuthor{Name: release.Author, URI: release.AuthorURL},
+		}
+		if entry.ID != "" {
+			entry.Link = &atomLink{Rel: "alternate", Href: entry.ID}
+		}
+		if !release.PublishedAt.IsZero() {
+			entry.Published = release.PublishedAt.UTC().Format(time.RFC3339)
+		}
+		// Releases without author, like tags, are by their owner as far as the feed goes.
+		if entry.Author.Name == "" {
+			entry.Author = atomAuthor{Name: repository.Owner, URI: repository.URL.String()}
+		}
+		if release.Description != "" {
+			entry.Content = &atomText{Type: "text", Body: release.Description}
+		}
+		if entry.ID == "" {
+			entry.ID = repository.URL.String() + "#" + release.Key()
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(feed)
+}
+
+// feedTime returns when the release was published, when it was created if it wasn't yet.
+func feedTime(release Release) time.Time {
+	if release.PublishedAt.IsZero() {
+		return release.CreatedAt.UTC()
+	}
+	return release.PublishedAt.UTC()
+}
+
+// serveFeed serves the Atom feed of the releases recently dispatched, of all repositories at /feed.xml
+// and of a single one at /feeds/owner/name.xml.
+func (s *Server) serveFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var repoName string
+	title := s.feedTitle
+	if r.URL.Path != "/feed.xml" {
+		repoName = strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/feeds/"), ".xml")
+		if !strings.HasSuffix(r.URL.Path, ".xml") || !strings.Contains(repoName, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		title = repoName
+	}
+
+	releases, err := s.history.Feed(repoName, s.feedLimit)
+	if err != nil {
+		level.Warn(s.logger).Log("msg", "failed to read the history for the feed", "err", err)
+		http.Error(w, "failed to read the history", http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	if err := writeFeed(w, title, scheme+"://"+r.Host+r.URL.Path, releases, s.messages); err != nil {
+		level.Warn(s.logger).Log("msg", "failed to write the feed", "err", err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Release fields that can be given in NOTIFICATION_FIELDS.
+const (
+	FieldTag       = "tag"
+	FieldURL       = "url"
+	FieldAuthor    = "author"
+	FieldBody      = "body"
+	FieldAssets    = "assets"
+	FieldPublished = "published"
+	FieldDownloads = "downloads"
+	// FieldAvatar shows the author's avatar and a link to their profile, where senders can show images.
+	FieldAvatar = "avatar"
+)
+
+var notificationFieldNames = []string{FieldTag, FieldURL, FieldAuthor, FieldBody, FieldAssets, FieldPublished, FieldDownloads, FieldAvatar}
+
+// NotificationFields are the release fields senders include in their notifications,
+// besides the repository and the release's name which are always included.
+type NotificationFields []string
+
+// ParseNotificationFields validates the field names.
+func ParseNotificationFields(fields []string) (NotificationFields, error) {
+	for _, field := range fields {
+		if !containsFold(notificationFieldNames, field) {
+			return nil, fmt.Errorf("unknown notification field %q, must be one of %s", field, strings.Join(notificationFieldNames, ", "))
+		}
+	}
+	return NotificationFields(fields), nil
+}
+
+// Or returns the fields or, if none were given, the sender's defaults.
+func (f NotificationFields) Or(defaults ...string) NotificationFields {
+	if len(f) == 0 {
+		return NotificationFields(defaults)
+	}
+	return f
+}
+
+// Has returns true if the field is included.
+func (f NotificationFields) Has(field string) bool {
+	return containsFold(f, field)
+}
+
+// Details returns a line for each included field other than the URL, body and avatar and for the release's checks,
+// e.g. "Tag: v1.2.3", in the order of notificationFieldNames and labeled in the messages' language.
+func (f NotificationFields) Details(release Release, messages Messages) []string {
+	var lines []string
+	if f.Has(FieldTag) && release.TagName != "" {
+		lines = append(lines, messages.Tag+": "+release.TagName)
+	}
+	if release.Checks != "" {
+		lines = append(lines, messages.Checks+": "+strings.ToLower(release.Checks))
+	}
+	if f.Has(FieldAuthor) && release.Author != "" {
+		lines = append(lines, messages.Author+": "+release.Author)
+	}
+	if f.Has(FieldAssets) {
+		for _, asset := range release.Assets {
+			lines = append(lines, fmt.Sprintf("%s: %s %s", messages.Asset, asset.Name, asset.URL.String()))
+		}
+	}
+	if f.Has(FieldPublished) && !release.PublishedAt.IsZero() {
+		lines = append(lines, messages.Published+": "+release.PublishedAt.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	if f.Has(FieldDownloads) && len(release.Assets) > 0 {
+		lines = append(lines, fmt.Sprintf("%s: %d", messages.Downloads, release.Downloads()))
+	}
+	return lines
+}
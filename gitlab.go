@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GitlabDuplicateSkip keeps an open issue already opened for the release as it is.
+	GitlabDuplicateSkip = "skip"
+	// GitlabDuplicateUpdate updates an open issue already opened for the release with its current content.
+	GitlabDuplicateUpdate = "update"
+)
+
+// GitlabSender opens an issue in a GitLab project for every release.
+type GitlabSender struct {
+	store Store
+
+	URL     string
+	Token   string
+	Project string
+	Labels  []string
+	// ClosePrevious closes the previous release issue of the same repository
+	// when opening a new one, so only the latest one stays open.
+	ClosePrevious bool
+	// Untracked opens issues without remembering them as the repository's latest one
+	// or closing the previous one, e.g. for releases sent again with --replay.
+	Untracked bool
+	// Retries is how often creating an issue is retried on conflicts and server errors.
+	Retries int
+	// OnDuplicate is what happens to an open issue with the same title and labels found before opening one,
+	// GitlabDuplicateSkip or GitlabDuplicateUpdate.
+	OnDuplicate string
+	// Assignees are the usernames or IDs of the users the issues are assigned to,
+	// and Milestone the title of the project's milestone they are added to.
+	Assignees []string
+	Milestone string
+	// NotesLength cuts the release notes in issues to that many bytes if set, see Release.Notes.
+	NotesLength int
+	// Fields of the release to include, its link and notes by default.
+	Fields   NotificationFields
+	Messages Messages
+
+	// mu guards the IDs of the assignees and the milestone, looked up once they were found.
+	mu          sync.Mutex
+	assigneeIDs []int
+	milestoneID int
+}
+
+// gitlabError is returned for unexpected responses of the GitLab API.
+type gitlabError struct {
+	Status string
+	Code   int
+	Body   []byte
+}
+
+func (e *gitlabError) Error() string {
+	switch e.Code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Sprintf("gitlab rejected the token, check GITLAB_TOKEN and its access to the project: %s, %s", e.Status, e.Body)
+	}
+	return fmt.Sprintf("request didn't respond with 200 OK or 201 Created: %s, %s", e.Status, e.Body)
+}
+
+// StatusCode returns the response's HTTP status code.
+func (e *gitlabError) StatusCode() int {
+	return e.Code
+}
+
+// retryable returns true for conflicts, e.g. on a locked resource, and transient server errors.
+func (e *gitlabError) retryable() bool {
+	return e.Code == http.StatusConflict || e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+type gitlabIssue struct {
+	IID    int    `json:"iid"`
+	WebURL string `json:"web_url"`
+}
+
+const gitlabIssueKeyPrefix = "gitlab-issue/"
+
+func gitlabIssueKey(repoName string) string {
+	return gitlabIssueKeyPrefix + repoName
+}
+
+// Send opens an issue for the repository's release.
+func (s *GitlabSender) Send(repository Repository) error {
+	repoName := repository.Owner + "/" + repository.Name
+	fields := s.Fields.Or(FieldURL, FieldBody)
+
+	name := repository.Release.Name
+	if fields.Has(FieldURL) {
+		name = fmt.Sprintf("[%s](%s)", name, repository.Release.URL.String())
+	}
+	description := fmt.Sprintf("[%s](%s): %s %s", repoName, repository.URL.String(), name, s.Messages.Action(repository))
+	if details := fields.Details(repository.Release, s.Messages); len(details) > 0 {
+		description += "\n\n* " + strings.Join(details, "\n* ")
+	}
+	if compare := repository.CompareURL(); compare != "" {
+		description += fmt.Sprintf("\n\n[%s](%s)", s.Messages.ChangesSince(repository), compare)
+	}
+	if fields.Has(FieldBody) && repository.Release.Description != "" {
+		description += "\n\n" + repository.Release.Notes(s.NotesLength, s.Messages)
+	}
+
+	labels := strings.Join(s.labels(repository), ",")
+	payload := map[string]interface{}{
+		"title":       fmt.Sprintf("%s: %s %s", repoName, repository.Release.Name, s.Messages.Action(repository)),
+		"description": description,
+		"labels":      labels,
+	}
+	if err := s.assign(payload); err != nil {
+		return err
+	}
+
+	// The issue may have been opened before, e.g. by a run that crashed before remembering the release.
+	issue, found, err := s.findIssue(payload["title"].(string), labels)
+	if err != nil {
+		return err
+	}
+	switch {
+	case found && s.OnDuplicate == GitlabDuplicateUpdate:
+		if err := s.request(http.MethodPut, fmt.Sprintf("/issues/%d", issue.IID), payload, nil); err != nil {
+			return fmt.Errorf("failed to update existing issue #%d: %v", issue.IID, err)
+		}
+	case !found:
+		if issue, err = s.createIssue(payload); err != nil {
+			return err
+		}
+	}
+	if s.Untracked {
+		return nil
+	}
+
+	var previous int
+	if _, err := s.store.Get(gitlabIssueKey(repoName), &previous); err != nil {
+		return err
+	}
+	if err := s.store.Put(gitlabIssueKey(repoName), issue.IID); err != nil {
+		return err
+	}
+
+	if !s.ClosePrevious || previous == 0 || previous == issue.IID {
+		return nil
+	}
+
+	note := map[string]string{
+		"body": fmt.Sprintf(s.Messages.Superseded, issue.IID, repository.Release.Name),
+	}
+	if err := s.request(http.MethodPost, fmt.Sprintf("/issues/%d/notes", previous), note, nil); err != nil {
+		return fmt.Errorf("failed to link previous issue #%d: %v", previous, err)
+	}
+	closing := map[string]string{"state_event": "close"}
+	if err := s.request(http.MethodPut, fmt.Sprintf("/issues/%d", previous), closing, nil); err != nil {
+		return fmt.Errorf("failed to close previous issue #%d: %v", previous, err)
+	}
+
+	return nil
+}
+
+// labels returns the configured labels along with the ones the repository asks for.
+func (s *GitlabSender) labels(repository Repository) []string {
+	labels := append([]string(nil), s.Labels...)
+	if repository.Overrides != nil {
+		for _, label := range repository.Overrides.Labels {
+			if !containsFold(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
+
+// assign adds the assignees and the milestone to the issue's payload, looking up their IDs the first time.
+func (s *GitlabSender) assign(payload map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.Assignees) > 0 && s.assigneeIDs == nil {
+		ids := make([]int, 0, len(s.Assignees))
+		for _, assignee := range s.Assignees {
+			id, err := strconv.Atoi(assignee)
+			if err != nil {
+				var users []struct {
+					ID int `json:"id"`
+				}
+				query := url.Values{"username": {strings.TrimPrefix(assignee, "@")}}
+				if err := s.do(http.MethodGet, s.apiURL("/users?"+query.Encode()), nil, &users); err != nil {
+					return fmt.Errorf("failed to look up assignee %s: %v", assignee, err)
+				}
+				if len(users) == 0 {
+					return fmt.Errorf("assignee %s not found", assignee)
+				}
+				id = users[0].ID
+			}
+			ids = append(ids, id)
+		}
+		s.assigneeIDs = ids
+	}
+	if s.Milestone != "" && s.milestoneID == 0 {
+		var milestones []struct {
+			ID    int    `json:"id"`
+			Title string `json:"title"`
+		}
+		query := url.Values{"title": {s.Milestone}, "include_parent_milestones": {"true"}}
+		if err := s.request(http.MethodGet, "/milestones?"+query.Encode(), nil, &milestones); err != nil {
+			return fmt.Errorf("failed to look up milestone %s: %v", s.Milestone, err)
+		}
+		if len(milestones) == 0 {
+			return fmt.Errorf("milestone %s not found", s.Milestone)
+		}
+		s.milestoneID = milestones[0].ID
+	}
+
+	if len(s.assigneeIDs) > 0 {
+		payload["assignee_ids"] = s.assigneeIDs
+	}
+	if s.milestoneID != 0 {
+		payload["milestone_id"] = s.milestoneID
+	}
+	return nil
+}
+
+// createIssue creates the issue, retrying with backoff on conflicts and server errors.
+// A failed request may still have created the issue, so before every retry
+// an open issue with the same title is looked up and taken instead.
+func (s *GitlabSender) createIssue(payload map[string]interface{}) (gitlabIssue, error) {
+	var issue gitlabIssue
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err := s.request(http.MethodPost, "/issues", payload, &issue)
+		if err == nil {
+			return issue, nil
+		}
+		apiErr, ok := err.(*gitlabError)
+		if !ok || !apiErr.retryable() || attempt >= s.Retries {
+			return issue, err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+
+		existing, found, err := s.findIssue(payload["title"].(string), payload["labels"].(string))
+		if err != nil {
+			return issue, err
+		}
+		if found {
+			return existing, nil
+		}
+	}
+}
+
+// findIssue returns the open issue with the given title and all of the comma separated labels, if there is one.
+func (s *GitlabSender) findIssue(title, labels string) (gitlabIssue, bool, error) {
+	query := url.Values{
+		"search": {title},
+		"in":     {"title"},
+		"state":  {"opened"},
+	}
+	if labels != "" {
+		query.Set("labels", labels)
+	}
+	var issues []struct {
+		gitlabIssue
+		Title string `json:"title"`
+	}
+	if err := s.request(http.MethodGet, "/issues?"+query.Encode(), nil, &issues); err != nil {
+		return gitlabIssue{}, false, err
+	}
+	for _, issue := range issues {
+		if issue.Title == title {
+			return issue.gitlabIssue, true, nil
+		}
+	}
+	return gitlabIssue{}, false, nil
+}
+
+// request sends payload to the project's API at path and decodes the response into result, if given.
+func (s *GitlabSender) request(method, path string, payload interface{}, result interface{}) error {
+	return s.do(method, s.apiURL("/projects/"+url.PathEscape(s.Project)+path), payload, result)
+}
+
+// apiURL returns the endpoint of GitLab's API at path.
+func (s *GitlabSender) apiURL(path string) string {
+	return strings.TrimSuffix(s.URL, "/") + "/api/v4" + path
+}
+
+// do sends payload to the endpoint and decodes the response into result, if given.
+func (s *GitlabSender) do(method, endpoint string, payload interface{}, result interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		payloadData, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payloadData)
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("PRIVATE-TOKEN", s.Token)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req = req.WithContext(ctx)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return &gitlabError{Status: resp.Status, Code: resp.StatusCode, Body: body}
+	}
+
+	if result == nil {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -6,7 +6,11 @@ require (
 	github.com/alexflint/go-arg v1.3.0
 	github.com/go-kit/kit v0.10.0
 	github.com/joho/godotenv v1.3.0
+	github.com/nats-io/nats.go v1.11.0
 	github.com/shurcooL/githubql v0.0.0-20191127044304-8f68eb5628d0
 	github.com/shurcooL/graphql v0.0.0-20181231061246-d48a9a75455f // indirect
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	google.golang.org/grpc v1.46.2
+	google.golang.org/protobuf v1.28.0
+	gopkg.in/yaml.v2 v2.3.0
 )
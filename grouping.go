@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GroupByOwner sends one message per owner for all of its releases found in a check cycle.
+const GroupByOwner = "owner"
+
+// Orders of the releases in a group, by default the order they were found in.
+const (
+	DigestSortName    = "name"
+	DigestSortVersion = "version"
+	DigestSortRecency = "recency"
+)
+
+// ReleaseGroups collects the releases of a check cycle by owner
+// to notify about them in a single message.
+type ReleaseGroups struct {
+	owners []string
+	groups map[string][]Repository
+}
+
+// Add adds the repository's release to its owner's group.
+func (g *ReleaseGroups) Add(repository Repository) {
+	if g.groups == nil {
+		g.groups = make(map[string][]Repository)
+	}
+
+	owner := strings.ToLower(repository.Owner)
+	if _, ok := g.groups[owner]; !ok {
+		g.owners = append(g.owners, owner)
+	}
+	g.groups[owner] = append(g.groups[owner], repository)
+}
+
+// Empty returns true if no release was added since the groups were taken.
+func (g *ReleaseGroups) Empty() bool {
+	return len(g.owners) == 0
+}
+
+// Take returns the groups in the order their first release was added and empties them.
+func (g *ReleaseGroups) Take() [][]Repository {
+	groups := make([][]Repository, 0, len(g.owners))
+	for _, owner := range g.owners {
+		groups = append(groups, g.groups[owner])
+	}
+	g.owners = nil
+	g.groups = nil
+	return groups
+}
+
+// DefaultWindowBypass sends security releases right away instead of holding them for GROUP_WINDOW.
+var DefaultWindowBypass = []string{"security"}
+
+// ParseWindowBypass parses the conditions of releases sent right away, like the ones of colors.
+// The single condition none holds all releases.
+func ParseWindowBypass(conditions []string) ([]ColorRule, error) {
+	if len(conditions) == 1 && conditions[0] == "none" {
+		return nil, nil
+	}
+	rules := make([]ColorRule, 0, len(conditions))
+	for _, condition := range conditions {
+		r, err := newColorRule(condition, "")
+		if err != nil {
+			return nil, fmt.Errorf("window bypass %q %v", condition, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Digest orders a group's releases by sort and cuts them off after limit, unless it's 0.
+// It returns the releases to list and how many were left out.
+func Digest(repositories []Repository, by string, limit int) ([]Repository, int) {
+	sorted := append([]Repository(nil), repositories...)
+	switch by {
+	case DigestSortName:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return strings.ToLower(sorted[i].Name) < strings.ToLower(sorted[j].Name)
+		})
+	case DigestSortVersion:
+		// Highest versions first, releases without one after them.
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, errA := ParseVersion(sorted[i].Release.TagName)
+			b, errB := ParseVersion(sorted[j].Release.TagName)
+			if errA != nil || errB != nil {
+				return errA == nil && errB != nil
+			}
+			return a.Compare(b) > 0
+		})
+	case DigestSortRecency:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Release.PublishedAt.After(sorted[j].Release.PublishedAt)
+		})
+	}
+
+	if limit <= 0 || len(sorted) <= limit {
+		return sorted, 0
+	}
+	return sorted[:limit], len(sorted) - limit
+}
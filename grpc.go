@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	notifierpb "github.com/marthjod/github-releases-notifier/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// GRPCSender calls the Notify RPC of a gRPC service with the release event,
+// through the client generated from proto/notifier.proto.
+type GRPCSender struct {
+	// Endpoint is the service's host:port.
+	Endpoint string
+	// Metadata are sent with every call, e.g. authorization for the service's auth.
+	Metadata map[string]string
+
+	client notifierpb.NotifierClient
+}
+
+// NewGRPCSender returns a sender calling the service at endpoint with TLS, trusting the CA
+// in the PEM file at caFile or, without one, the system's CAs. With plaintext it doesn't use TLS.
+// Metadata are given as key=value. The connection is only established on the first call.
+func NewGRPCSender(endpoint string, plaintext bool, caFile string, metadata []string) (*GRPCSender, error) {
+	s := &GRPCSender{
+		Endpoint: endpoint,
+		Metadata: make(map[string]string, len(metadata)),
+	}
+	for _, entry := range metadata {
+		i := strings.Index(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("grpc metadata %q is not of the form key=value", entry)
+		}
+		s.Metadata[strings.ToLower(entry[:i])] = entry[i+1:]
+	}
+
+	creds := insecure.NewCredentials()
+	if !plaintext {
+		config := &tls.Config{}
+		if caFile != "" {
+			pem, err := ioutil.ReadFile(caFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", caFile)
+			}
+			config.RootCAs = pool
+		}
+		creds = credentials.NewTLS(config)
+	}
+	conn, err := grpc.Dial(endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	s.client = notifierpb.NewNotifierClient(conn)
+	return s, nil
+}
+
+// Send calls Notify with the repository's release event.
+func (s *GRPCSender) Send(repository Repository) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if len(s.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(s.Metadata))
+	}
+	_, err := s.client.Notify(ctx, releaseEventProto(NewReleaseEvent(repository)))
+	return err
+}
+
+// releaseEventProto returns the event as the ReleaseEvent message of proto/notifier.proto.
+func releaseEventProto(event ReleaseEvent) *notifierpb.ReleaseEvent {
+	m := &notifierpb.ReleaseEvent{
+		SchemaVersion: int32(event.SchemaVersion),
+		DetectedAt:    protoTime(event.DetectedAt),
+		Repository: &notifierpb.Repository{
+			Id:          event.Repository.ID,
+			Owner:       event.Repository.Owner,
+			Name:        event.Repository.Name,
+			FullName:    event.Repository.FullName,
+			Description: event.Repository.Description,
+			Url:         event.Repository.URL,
+		},
+		Release:      releaseProto(event.Release),
+		PromotedFrom: event.PromotedFrom,
+	}
+	if event.Previous != nil {
+		m.Previous = releaseProto(*event.Previous)
+	}
+	return m
+}
+
+func releaseProto(release ReleaseEventRelease) *notifierpb.Release {
+	return &notifierpb.Release{
+		Id:          release.ID,
+		Name:        release.Name,
+		TagName:     release.TagName,
+		Url:         release.URL,
+		Prerelease:  release.Prerelease,
+		Author:      release.Author,
+		Body:        release.Body,
+		PublishedAt: protoTime(release.PublishedAt),
+		CreatedAt:   protoTime(release.CreatedAt),
+		Downloads:   int64(release.Downloads),
+	}
+}
+
+// protoTime formats times as RFC 3339 in UTC, as the proto file defines them, leaving unknown ones empty.
+func protoTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	notifierpb "github.com/marthjod/github-releases-notifier/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// notifierServer records the events and metadata of its Notify calls, failing them with fail.
+type notifierServer struct {
+	notifierpb.UnimplementedNotifierServer
+	events   chan *notifierpb.ReleaseEvent
+	metadata metadata.MD
+	fail     error
+}
+
+func (s *notifierServer) Notify(ctx context.Context, event *notifierpb.ReleaseEvent) (*notifierpb.NotifyResponse, error) {
+	s.metadata, _ = metadata.FromIncomingContext(ctx)
+	s.events <- event
+	return &notifierpb.NotifyResponse{}, s.fail
+}
+
+func newNotifierServer(t *testing.T) (*notifierServer, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := &notifierServer{events: make(chan *notifierpb.ReleaseEvent, 1)}
+	server := grpc.NewServer()
+	notifierpb.RegisterNotifierServer(server, notifier)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return notifier, listener.Addr().String()
+}
+
+func TestGRPCSenderSend(t *testing.T) {
+	notifier, endpoint := newNotifierServer(t)
+	s, err := NewGRPCSender(endpoint, true, "", []string{"Authorization=Bearer secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Times are sent in UTC whatever zone they were found in.
+	published := time.Date(2020, 2, 25, 19, 30, 0, 0, time.FixedZone("CET", 3600))
+	repository := Repository{
+		Owner: "golang",
+		Name:  "go",
+		Release: Release{
+			Name:        "go1.14",
+			TagName:     "go1.14",
+			PublishedAt: published,
+		},
+	}
+	if err := s.Send(repository); err != nil {
+		t.Fatal(err)
+	}
+
+	event := <-notifier.events
+	if event.Repository.FullName != "golang/go" || event.Release.TagName != "go1.14" {
+		t.Errorf("event = %v, want golang/go go1.14", event)
+	}
+	if want := "2020-02-25T18:30:00Z"; event.Release.PublishedAt != want {
+		t.Errorf("published_at = %q, want %q", event.Release.PublishedAt, want)
+	}
+	if got := notifier.metadata.Get("authorization"); len(got) != 1 || got[0] != "Bearer secret" {
+		t.Errorf("authorization = %v, want the configured metadata", got)
+	}
+
+	notifier.fail = status.Error(codes.Unavailable, "down for maintenance")
+	if err := s.Send(repository); status.Code(err) != codes.Unavailable {
+		t.Errorf("Send() = %v, want the service's status", err)
+	}
+}
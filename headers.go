@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// sensitiveHeaderParts mark headers whose values are redacted in logs.
+var sensitiveHeaderParts = []string{"auth", "token", "secret", "key", "password", "cookie", "signature"}
+
+// ParseGithubHeaders parses the headers added to the requests to GitHub, given as Name=value,
+// e.g. a gateway's auth header or an Accept header for schema previews.
+func ParseGithubHeaders(entries []string) (http.Header, error) {
+	return parseHeaders("github", entries)
+}
+
+// parseHeaders parses headers given as Name=value, kind tells whose they are in errors.
+func parseHeaders(kind string, entries []string) (http.Header, error) {
+	headers := make(http.Header, len(entries))
+	for _, entry := range entries {
+		i := strings.Index(entry, "=")
+		if i <= 0 || strings.ContainsAny(entry[:i], " \t:") {
+			return nil, fmt.Errorf("%s header %q is not of the form Name=value", kind, entry)
+		}
+		headers.Add(entry[:i], entry[i+1:])
+	}
+	return headers, nil
+}
+
+// redactedHeaders returns the headers as Name=value for logging, with the values of sensitive ones redacted.
+func redactedHeaders(headers http.Header) []string {
+	var redacted []string
+	for name, values := range headers {
+		for _, value := range values {
+			if isSensitiveHeader(name) {
+				value = "REDACTED"
+			}
+			redacted = append(redacted, name+"="+value)
+		}
+	}
+	sort.Strings(redacted)
+	return redacted
+}
+
+func isSensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range sensitiveHeaderParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerTransport adds the headers to every request, unless it has them already,
+// so the token's Authorization header is kept.
+type headerTransport struct {
+	next    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.headers) == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	// Transports must not change the request they were given.
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = values
+		}
+	}
+	return t.next.RoundTrip(req)
+}
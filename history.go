@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const historyKeyPrefix = "history/"
+
+// historyLength is how many releases are kept per repository for --replay.
+const historyLength = 10
+
+// History keeps the releases last dispatched to the senders, newest first per repository,
+// so they can be sent again after the senders failed to deliver them, see --replay.
+type History struct {
+	store Store
+}
+
+func historyKey(repoName string) string {
+	return historyKeyPrefix + strings.ToLower(repoName)
+}
+
+// Record adds the release to its repository's history, dropping the oldest one beyond historyLength.
+// A release dispatched again, e.g. after being held back, is only kept once.
+func (h *History) Record(repository Repository) error {
+	key := historyKey(repository.Owner + "/" + repository.Name)
+
+	var history []Repository
+	if _, err := h.store.Get(key, &history); err != nil {
+		return err
+	}
+	if len(history) > 0 && history[0].Release.Key() == repository.Release.Key() {
+		return nil
+	}
+	history = append([]Repository{repository}, history...)
+	if len(history) > historyLength {
+		history = history[:historyLength]
+	}
+	return h.store.Put(key, history)
+}
+
+// Recent returns up to n of the newest releases of every repository in the history,
+// ordered by repository and oldest first within each one, as they were dispatched.
+func (h *History) Recent(n int) ([]Repository, error) {
+	keys, err := h.store.Keys(historyKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	var recent []Repository
+	for _, key := range keys {
+		var history []Repository
+		if _, err := h.store.Get(key, &history); err != nil {
+			return recent, err
+		}
+		if len(history) > n {
+			history = history[:n]
+		}
+		for i := len(history) - 1; i >= 0; i-- {
+			recent = append(recent, history[i])
+		}
+	}
+	return recent, nil
+}
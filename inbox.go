@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const inboxKeyPrefix = "inbox/"
+
+const (
+	// inboxLimit is how many received events wait to be checked before more are turned away.
+	inboxLimit = 1000
+	// inboxRetryDelay is how long a failed event waits before it is retried the first time,
+	// doubling with every further attempt up to inboxMaxRetryDelay.
+	inboxRetryDelay    = time.Minute
+	inboxMaxRetryDelay = time.Hour
+)
+
+// errInboxFull is returned for events received while inboxLimit of them are waiting.
+var errInboxFull = errors.New("too many events waiting to be checked")
+
+// inboxEvent is a received webhook event waiting in the inbox for its repository to be checked.
+type inboxEvent struct {
+	Event      string    `json:"event"`
+	Action     string    `json:"action,omitempty"`
+	Delivery   string    `json:"delivery,omitempty"`
+	Repository string    `json:"repository"`
+	Received   time.Time `json:"received"`
+	// Attempts is how often checking the repository failed, Next when it is tried again and Error why it failed last.
+	Attempts int       `json:"attempts,omitempty"`
+	Next     time.Time `json:"next"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Receive puts the event into the inbox, writing the state right away so it isn't lost in a crash,
+// and has its repository checked between the scheduled checks, see processInbox.
+func (c *Checker) Receive(event inboxEvent) error {
+	keys, err := c.store.Keys(inboxKeyPrefix)
+	if err != nil {
+		return err
+	}
+	if len(keys) >= inboxLimit {
+		return errInboxFull
+	}
+
+	event.Received = time.Now().UTC()
+	event.Next = event.Received
+	key := fmt.Sprintf("%s%020d", inboxKeyPrefix, event.Received.UnixNano())
+	if event.Delivery != "" {
+		key += "-" + event.Delivery
+	}
+	if err := c.store.Put(key, event); err != nil {
+		return err
+	}
+	if err := c.store.Flush(); err != nil {
+		return err
+	}
+
+	select {
+	case c.triggers <- struct{}{}:
+	default:
+		// The inbox is processed already.
+	}
+	return nil
+}
+
+// processInbox checks the repositories of the events in the inbox that are due, once per repository.
+// Events whose check failed are retried with backoff, up to webhookRetries times, then written to
+// the dead letters. It returns when the next event is due, the zero time if none is waiting.
+func (c *Checker) processInbox(ctx context.Context, repositories []string, releases chan<- Repository) time.Time {
+	keys, err := c.store.Keys(inboxKeyPrefix)
+	if err != nil {
+		level.Warn(c.logger).Log("msg", "failed to load received events", "err", err)
+		return time.Now().Add(inboxRetryDelay)
+	}
+
+	now := time.Now()
+	var next time.Time
+	later := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	// Events are grouped by repository, in the order they were received.
+	var order []string
+	due := make(map[string][]string)
+	events := make(map[string]inboxEvent, len(keys))
+	for _, key := range keys {
+		var event inboxEvent
+		if _, err := c.store.Get(key, &event); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to load received event", "key", key, "err", err)
+			continue
+		}
+		if event.Next.After(now) {
+			later(event.Next)
+			continue
+		}
+		repoName := strings.ToLower(event.Repository)
+		if _, ok := due[repoName]; !ok {
+			order = append(order, repoName)
+		}
+		due[repoName] = append(due[repoName], key)
+		events[key] = event
+	}
+
+	for _, repoName := range order {
+		keys := due[repoName]
+		repository := events[keys[0]].Repository
+
+		var err error
+		if triggered := c.triggered(repositories, repository); len(triggered) > 0 {
+			level.Info(c.logger).Log("msg", "checking repository after receiving an event", "repository", repository)
+			// An event asks for a check now, also of repositories with an interval of their own, see dueKeys.
+			for _, key := range c.keys(triggered) {
+				delete(c.checkedAt, key)
+			}
+			err = c.checkRecovered(ctx, triggered, releases)
+		}
+		if ctx.Err() != nil {
+			// Events interrupted by shutting down are checked again on the next start.
+			return time.Time{}
+		}
+
+		var done []string
+		for _, key := range keys {
+			event := events[key]
+			if err == nil {
+				done = append(done, key)
+				continue
+			}
+			event.Attempts++
+			event.Error = err.Error()
+			if event.Attempts > c.webhookRetries {
+				c.deadLetter(event)
+				done = append(done, key)
+				continue
+			}
+			delay := inboxRetryDelay << uint(event.Attempts-1)
+			if delay > inboxMaxRetryDelay || delay <= 0 {
+				delay = inboxMaxRetryDelay
+			}
+			event.Next = time.Now().Add(delay)
+			level.Warn(c.logger).Log(
+				"msg", "failed to check repository of received event, retrying later",
+				"repository", repository,
+				"delivery", event.Delivery,
+				"attempts", event.Attempts,
+				"next", event.Next,
+				"err", err,
+			)
+			if err := c.store.Put(key, event); err != nil {
+				level.Warn(c.logger).Log("msg", "failed to store received event", "repository", repository, "err", err)
+			}
+			later(event.Next)
+		}
+		if err := c.store.Delete(done...); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to remove checked events", "repository", repository, "err", err)
+		}
+	}
+	if len(order) > 0 {
+		if err := c.store.Flush(); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to write the state", "err", err)
+		}
+	}
+	return next
+}
+
+// wait waits for d, or forever if it is negative, until ctx is done, checking the repositories whose events
+// were received until then, see processInbox. It returns the repositories, reloaded if asked to in the meantime.
+func (c *Checker) wait(ctx context.Context, d time.Duration, repositories []string, releases chan<- Repository) []string {
+	var due <-chan time.Time
+	if d >= 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		due = timer.C
+	}
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	for {
+		select {
+		case <-due:
+			return repositories
+		case <-ctx.Done():
+			return repositories
+		case <-c.hangups:
+			// Reloading between checks doesn't interrupt one.
+			repositories = c.reload(repositories)
+		case <-c.triggers:
+			if !retry.Stop() {
+				select {
+				case <-retry.C:
+				default:
+				}
+			}
+			retry.Reset(0)
+		case <-retry.C:
+			// Events left in the inbox, e.g. by a crash, are checked right away.
+			if next := c.processInbox(ctx, repositories, releases); !next.IsZero() {
+				retry.Reset(time.Until(next))
+			}
+		}
+	}
+}
+
+// triggered returns the entries watching the repository given as owner/name, with the entries it was found by
+// replaced with its name. Without any, it isn't watched.
+func (c *Checker) triggered(repositories []string, repoName string) []string {
+	var triggered []string
+	add := func(entry string) {
+		if !containsFold(triggered, entry) {
+			triggered = append(triggered, entry)
+		}
+	}
+	for _, entry := range repositories {
+		switch {
+		case strings.HasPrefix(entry, actionPrefix):
+			if action, err := actionRepository(strings.TrimPrefix(entry, actionPrefix)); err == nil && strings.EqualFold(action, repoName) {
+				add(action + tagsSuffix)
+			}
+		case isExpansion(entry):
+			for _, expanded := range c.expansions[entry] {
+				if strings.EqualFold(expanded, repoName) {
+					add(expanded)
+				}
+			}
+		case strings.EqualFold(keyRepository(entry), repoName):
+			add(entry)
+		}
+	}
+	return triggered
+}
+
+// deadLetter gives up on the event, appending it as JSON line to the dead letters file if there is one.
+func (c *Checker) deadLetter(event inboxEvent) {
+	level.Error(c.logger).Log(
+		"msg", "giving up on received event, its repository couldn't be checked",
+		"repository", event.Repository,
+		"event", event.Event,
+		"delivery", event.Delivery,
+		"attempts", event.Attempts,
+		"err", event.Error,
+	)
+	if c.deadLetters == "" {
+		return
+	}
+	line, err := json.Marshal(event)
+	if err == nil {
+		err = appendLine(c.deadLetters, line)
+	}
+	if err != nil {
+		level.Warn(c.logger).Log("msg", "failed to write dead letter", "file", c.deadLetters, "repository", event.Repository, "err", err)
+	}
+}
+
+// appendLine appends the line to the file, creating it if needed.
+func appendLine(path string, line []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	githubql "github.com/shurcooL/githubql"
+)
+
+// newInboxChecker returns a checker whose queries go to handler.
+func newInboxChecker(t *testing.T, handler http.HandlerFunc) *Checker {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	store, err := NewFileStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "inbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return &Checker{
+		logger:      log.NewNopLogger(),
+		client:      githubql.NewEnterpriseClient(server.URL, server.Client()),
+		store:       store,
+		triggers:    make(chan struct{}, 1),
+		paths:       func(string) []string { return nil },
+		checks:      func(string) string { return "" },
+		tracer:      &Tracer{},
+		deadLetters: filepath.Join(dir, "dead-letters.jsonl"),
+	}
+}
+
+func inboxEvents(t *testing.T, c *Checker) []inboxEvent {
+	t.Helper()
+	keys, err := c.store.Keys(inboxKeyPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []inboxEvent
+	for _, key := range keys {
+		var event inboxEvent
+		if _, err := c.store.Get(key, &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestReceiveSignalsProcessing(t *testing.T) {
+	c := newInboxChecker(t, func(w http.ResponseWriter, r *http.Request) {})
+	if err := c.Receive(inboxEvent{Event: "release", Repository: "octocat/hello"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.triggers:
+	default:
+		t.Fatal("receiving an event didn't signal the inbox")
+	}
+	events := inboxEvents(t, c)
+	if len(events) != 1 || events[0].Repository != "octocat/hello" || events[0].Next.IsZero() {
+		t.Fatalf("inbox = %+v, want the received event due now", events)
+	}
+}
+
+func TestReceiveRejectsFullInbox(t *testing.T) {
+	c := newInboxChecker(t, func(w http.ResponseWriter, r *http.Request) {})
+	for i := 0; i < inboxLimit; i++ {
+		if err := c.store.Put(inboxKeyPrefix+strings.Repeat("x", i+1), inboxEvent{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Receive(inboxEvent{Repository: "octocat/hello"}); err != errInboxFull {
+		t.Fatalf("Receive() = %v, want %v", err, errInboxFull)
+	}
+}
+
+func TestProcessInboxDropsUnwatched(t *testing.T) {
+	queried := false
+	c := newInboxChecker(t, func(w http.ResponseWriter, r *http.Request) { queried = true })
+	if err := c.Receive(inboxEvent{Repository: "octocat/unwatched"}); err != nil {
+		t.Fatal(err)
+	}
+	if next := c.processInbox(context.Background(), []string{"octocat/hello"}, make(chan Repository, 1)); !next.IsZero() {
+		t.Errorf("next = %v, want none", next)
+	}
+	if queried {
+		t.Error("unwatched repository was queried")
+	}
+	if events := inboxEvents(t, c); len(events) != 0 {
+		t.Errorf("inbox = %+v, want it empty", events)
+	}
+}
+
+func TestProcessInboxChecksRepositoryWithOwnInterval(t *testing.T) {
+	queried := false
+	c := newInboxChecker(t, func(w http.ResponseWriter, r *http.Request) { queried = true })
+	c.intervals = func(string) time.Duration { return 24 * time.Hour }
+	c.checkedAt = map[string]time.Time{"octocat/hello": time.Now()}
+	if err := c.Receive(inboxEvent{Repository: "octocat/hello"}); err != nil {
+		t.Fatal(err)
+	}
+	c.processInbox(context.Background(), []string{"octocat/hello"}, make(chan Repository, 1))
+	if !queried {
+		t.Error("repository checked before its interval passed wasn't queried for the event")
+	}
+	if events := inboxEvents(t, c); len(events) != 0 {
+		t.Errorf("inbox = %+v, want it empty", events)
+	}
+}
+
+func TestProcessInboxRetriesThenDeadLetters(t *testing.T) {
+	queries := 0
+	c := newInboxChecker(t, func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		http.Error(w, "unavailable", http.StatusBadGateway)
+	})
+	c.webhookRetries = 2
+	// Both events are of the same repository, which is checked once for them.
+	for _, delivery := range []string{"first", "second"} {
+		if err := c.Receive(inboxEvent{Event: "release", Delivery: delivery, Repository: "octocat/hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repositories := []string{"octocat/hello"}
+	releases := make(chan Repository, 1)
+	for attempt := 1; attempt <= c.webhookRetries; attempt++ {
+		before := time.Now()
+		next := c.processInbox(context.Background(), repositories, releases)
+		if want := before.Add(inboxRetryDelay << uint(attempt-1)); next.Before(want) {
+			t.Fatalf("attempt %d: next = %v, want at least %v", attempt, next, want)
+		}
+		events := inboxEvents(t, c)
+		if len(events) != 2 {
+			t.Fatalf("attempt %d: inbox = %+v, want both events", attempt, events)
+		}
+		for _, event := range events {
+			if event.Attempts != attempt || event.Error == "" {
+				t.Fatalf("attempt %d: event = %+v, want the failed attempt recorded", attempt, event)
+			}
+		}
+
+		// Events not due yet aren't checked.
+		if c.processInbox(context.Background(), repositories, releases); len(inboxEvents(t, c)) != 2 {
+			t.Fatalf("attempt %d: events were given up before they were due", attempt)
+		}
+		for _, key := range mustKeys(t, c.store, inboxKeyPrefix) {
+			var event inboxEvent
+			c.store.Get(key, &event)
+			event.Next = time.Now()
+			c.store.Put(key, event)
+		}
+	}
+	queried := queries
+
+	if next := c.processInbox(context.Background(), repositories, releases); !next.IsZero() {
+		t.Errorf("next = %v, want none after giving up", next)
+	}
+	if queries == queried {
+		t.Error("the last attempt didn't query the repository")
+	}
+	if events := inboxEvents(t, c); len(events) != 0 {
+		t.Fatalf("inbox = %+v, want it empty after giving up", events)
+	}
+
+	data, err := ioutil.ReadFile(c.deadLetters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("dead letters = %q, want both events", data)
+	}
+	for i, delivery := range []string{"first", "second"} {
+		var event inboxEvent
+		if err := json.Unmarshal([]byte(lines[i]), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Delivery != delivery || event.Attempts != c.webhookRetries+1 {
+			t.Errorf("dead letter %d = %+v, want delivery %s after %d attempts", i, event, delivery, c.webhookRetries+1)
+		}
+	}
+}
+
+func TestProcessInboxKeepsEventsOnShutdown(t *testing.T) {
+	c := newInboxChecker(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusBadGateway)
+	})
+	if err := c.Receive(inboxEvent{Repository: "octocat/hello"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.processInbox(ctx, []string{"octocat/hello"}, make(chan Repository, 1))
+	events := inboxEvents(t, c)
+	if len(events) != 1 || events[0].Attempts != 0 {
+		t.Fatalf("inbox = %+v, want the event untouched", events)
+	}
+	if _, err := os.Stat(c.deadLetters); !os.IsNotExist(err) {
+		t.Errorf("dead letters written on shutdown: %v", err)
+	}
+}
+
+func mustKeys(t *testing.T, store Store, prefix string) []string {
+	t.Helper()
+	keys, err := store.Keys(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/go-kit/kit/log/level"
+	githubql "github.com/shurcooL/githubql"
+)
+
+// Changes of a watched repository notified as a Notice.
+const (
+	// NoticeArchived is sent when a repository got archived, so it won't have new releases.
+	NoticeArchived = "archived"
+	// NoticeRenamed is sent when a repository got renamed or moved to another owner.
+	NoticeRenamed = "renamed"
+)
+
+const lifecycleKeyPrefix = "lifecycle/"
+
+// Notice tells about a change of a watched repository other than a release.
+type Notice struct {
+	Kind string
+	// Repository is the repository as it is watched, like in -r.
+	Repository string
+	// NewName is the repository's new owner/name, if it was renamed.
+	NewName string
+	URL     string
+}
+
+// repositoryStatus are the details of a repository queried with every check
+// to notice lifecycle changes. GitHub follows renames, so the name may differ from the queried one.
+type repositoryStatus struct {
+	IsArchived    githubql.Boolean
+	NameWithOwner githubql.String
+}
+
+// storedLifecycle is what was last seen of a repository's lifecycle.
+type storedLifecycle struct {
+	Archived bool `json:"archived"`
+	// Name is the repository's current owner/name, if it was renamed.
+	Name string `json:"name,omitempty"`
+}
+
+func lifecycleKey(repoName string) string {
+	return lifecycleKeyPrefix + strings.ToLower(repoName)
+}
+
+// lifecycleOf returns what was last seen of the repository's lifecycle.
+func (c *Checker) lifecycleOf(repoName string) storedLifecycle {
+	key := lifecycleKey(repoName)
+	if lifecycle, ok := c.lifecycles[key]; ok {
+		return lifecycle
+	}
+
+	var lifecycle storedLifecycle
+	if c.store != nil {
+		if _, err := c.store.Get(key, &lifecycle); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to load the repository's lifecycle", "repository", repoName, "err", err)
+		}
+	}
+	if c.lifecycles == nil {
+		c.lifecycles = make(map[string]storedLifecycle)
+	}
+	c.lifecycles[key] = lifecycle
+	return lifecycle
+}
+
+// currentName returns the owner and name to query the watched repository under,
+// its new ones after it was renamed.
+func (c *Checker) currentName(repoName string) (owner, name string) {
+	if lifecycle := c.lifecycleOf(repoName); lifecycle.Name != "" {
+		repoName = lifecycle.Name
+	}
+	return splitRepoName(repoName)
+}
+
+// noticeChanges compares the repository's status to the one seen before
+// and notices it becoming archived or renamed once.
+func (c *Checker) noticeChanges(repoName string, repository Repository, status repositoryStatus) {
+	seen := c.lifecycleOf(repoName)
+	lifecycle := seen
+
+	var notices []Notice
+	current := seen.Name
+	if current == "" {
+		current = repoName
+	}
+	if newName := string(status.NameWithOwner); newName != "" && !strings.EqualFold(newName, current) {
+		lifecycle.Name = newName
+		notices = append(notices, Notice{Kind: NoticeRenamed, Repository: repoName, NewName: newName, URL: repository.URL.String()})
+	}
+	lifecycle.Archived = bool(status.IsArchived)
+	if lifecycle.Archived && !seen.Archived {
+		notices = append(notices, Notice{Kind: NoticeArchived, Repository: repoName, URL: repository.URL.String()})
+	}
+	if lifecycle == seen {
+		return
+	}
+
+	c.lifecycles[lifecycleKey(repoName)] = lifecycle
+	if c.store != nil {
+		if err := c.store.Put(lifecycleKey(repoName), lifecycle); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to store the repository's lifecycle", "repository", repoName, "err", err)
+		}
+	}
+	for _, notice := range notices {
+		level.Info(c.logger).Log("msg", "watched repository changed", "repository", repoName, "change", notice.Kind, "new_name", notice.NewName)
+		if c.notices != nil {
+			c.notices <- notice
+		}
+	}
+}
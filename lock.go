@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errLocked is returned by lockFile for files another process holds the lock of.
+var errLocked = errors.New("locked by another process")
+
+// Lock is a lock file keeping a second instance from using the same state file.
+// The file is locked with the OS, which releases the lock when its process exits,
+// so the lock of a crashed instance is free again without anyone taking it over.
+// It holds the PID of its owner, only to tell who has the lock.
+type Lock struct {
+	f *os.File
+}
+
+// AcquireLock locks the lock file at path, creating it if needed. It fails if another
+// process, or another Lock of this one, holds the lock.
+func AcquireLock(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if err != errLocked {
+			return nil, err
+		}
+		if pid := lockOwner(path); pid > 0 {
+			return nil, fmt.Errorf("%s is locked by process %d, is another instance using the same state file?", path, pid)
+		}
+		return nil, fmt.Errorf("%s is locked by another process, is another instance using the same state file?", path)
+	}
+
+	// The file is only written once locked, so it still tells the last owner's PID if locking fails.
+	err = f.Truncate(0)
+	if err == nil {
+		_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// lockOwner returns the PID in the lock file at path, 0 if it can't be read.
+func lockOwner(path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// AcquireLockWait acquires the lock like AcquireLock,
+// waiting up to timeout for another process to release it.
+func AcquireLockWait(path string, timeout time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := AcquireLock(path)
+		if err == nil || time.Now().After(deadline) {
+			return lock, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Release unlocks the lock file, which is left in place for the next owner. It is safe to call on a nil Lock.
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	err := unlockFile(l.f)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Log formats for --logformat.
+const (
+	LogFormatJSON    = "json"
+	LogFormatLogfmt  = "logfmt"
+	LogFormatConsole = "console"
+)
+
+// newLogger returns a logger writing to w in the given format.
+func newLogger(format string, w io.Writer) (log.Logger, error) {
+	switch format {
+	case LogFormatJSON:
+		return log.NewJSONLogger(log.NewSyncWriter(w)), nil
+	case LogFormatLogfmt:
+		return log.NewLogfmtLogger(log.NewSyncWriter(w)), nil
+	case LogFormatConsole:
+		return &consoleLogger{w: log.NewSyncWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, must be json, logfmt or console", format)
+}
+
+var consoleColors = map[string]string{
+	"debug": "\x1b[90m",
+	"info":  "\x1b[36m",
+	"warn":  "\x1b[33m",
+	"error": "\x1b[31m",
+}
+
+// consoleLogger writes human-readable lines like
+// 15:04:05 INFO  waiting for new releases caller=main.go:12
+// with the level colored, for running in a terminal.
+type consoleLogger struct {
+	w io.Writer
+}
+
+func (l *consoleLogger) Log(keyvals ...interface{}) error {
+	var ts, lvl, msg string
+	var rest []interface{}
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = log.ErrMissingValue
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		switch fmt.Sprint(keyvals[i]) {
+		case "ts":
+			if t, err := time.Parse(time.RFC3339Nano, fmt.Sprint(value)); err == nil {
+				ts = t.Local().Format("15:04:05")
+			} else {
+				ts = fmt.Sprint(value)
+			}
+		case "level":
+			lvl = fmt.Sprint(value)
+		case "msg":
+			msg = fmt.Sprint(value)
+		default:
+			rest = append(rest, keyvals[i], value)
+		}
+	}
+
+	var buf bytes.Buffer
+	if ts != "" {
+		buf.WriteString(ts + " ")
+	}
+	if lvl != "" {
+		fmt.Fprintf(&buf, "%s%-5s\x1b[0m ", consoleColors[lvl], strings.ToUpper(lvl))
+	}
+	buf.WriteString(msg)
+	if len(rest) > 0 {
+		buf.WriteString(" ")
+		// The logfmt logger ends the line.
+		if err := log.NewLogfmtLogger(&buf).Log(rest...); err != nil {
+			return err
+		}
+	} else {
+		buf.WriteString("\n")
+	}
+
+	_, err := l.w.Write(buf.Bytes())
+	return err
+}
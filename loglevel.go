@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// logLevels are the levels for LOG_LEVEL and PUT /loglevel, from the most to the least verbose.
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// LevelLogger only logs lines of its level and above. The level can be changed while running,
+// e.g. to debug a live issue without restarting.
+type LevelLogger struct {
+	next log.Logger
+
+	mu     sync.RWMutex
+	level  string
+	filter log.Logger
+}
+
+// NewLevelLogger returns a logger filtering by the level, info if it's unknown.
+func NewLevelLogger(next log.Logger, lvl string) *LevelLogger {
+	l := &LevelLogger{next: next}
+	if err := l.SetLevel(lvl); err != nil {
+		_ = l.SetLevel("info")
+	}
+	return l
+}
+
+// SetLevel changes the level to one of logLevels.
+func (l *LevelLogger) SetLevel(lvl string) error {
+	var allow level.Option
+	switch strings.ToLower(lvl) {
+	case "debug":
+		allow = level.AllowDebug()
+	case "info":
+		allow = level.AllowInfo()
+	case "warn":
+		allow = level.AllowWarn()
+	case "error":
+		allow = level.AllowError()
+	default:
+		return fmt.Errorf("unknown log level %q, must be one of %s", lvl, strings.Join(logLevels, ", "))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = strings.ToLower(lvl)
+	l.filter = level.NewFilter(l.next, allow)
+	return nil
+}
+
+// Level returns the current level.
+func (l *LevelLogger) Level() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.level
+}
+
+func (l *LevelLogger) Log(keyvals ...interface{}) error {
+	l.mu.RLock()
+	filter := l.filter
+	l.mu.RUnlock()
+	return filter.Log(keyvals...)
+}
@@ -2,8 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/alexflint/go-arg"
@@ -14,14 +22,185 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// Exit codes, so supervisors can tell a misconfiguration, which restarting doesn't fix, from other failures.
+// Once running, failures are retried by the next check and never exit the notifier,
+// only a single check with --once exits with the outcome of the check.
+const (
+	exitNoNewReleases = 0
+	// exitError is for failures of the state or, with --once, of checks and notifications.
+	exitError = 1
+	// exitConfig is for invalid flags, environment variables or config files.
+	exitConfig = 2
+	// exitAuth is for a missing GitHub token or one GitHub rejected.
+	exitAuth = 3
+	// exitUnavailable is for a check with --once that couldn't reach GitHub for any of the repositories that failed.
+	exitUnavailable = 4
+	exitNewReleases = 10
+)
+
 // Config of env and args
 type Config struct {
-	GithubToken     string        `arg:"env:GITHUB_TOKEN"`
-	Interval        time.Duration `arg:"env:INTERVAL"`
-	LogLevel        string        `arg:"env:LOG_LEVEL"`
-	Repositories    []string      `arg:"-r,separate"`
-	SlackHook       string        `arg:"env:SLACK_HOOK"`
-	IgnoreNonstable bool          `arg:"env:IGNORE_NONSTABLE"`
+	ConfigFile               string        `arg:"--config,env:CONFIG_FILE"`
+	GithubToken              string        `arg:"env:GITHUB_TOKEN"`
+	AllowUnauthenticated     bool          `arg:"--allow-unauthenticated,env:ALLOW_UNAUTHENTICATED"`
+	GithubHeaders            []string      `arg:"--github-headers,env:GITHUB_HEADERS"`
+	GithubAPIURL             string        `arg:"--github-api-url,env:GITHUB_API_URL"`
+	GithubGraphQLURL         string        `arg:"--github-graphql-url,env:GITHUB_GRAPHQL_URL"`
+	GithubHostTokens         []string      `arg:"--github-host-tokens,env:GITHUB_HOST_TOKENS"`
+	ForgeTokens              []string      `arg:"--forge-tokens,env:FORGE_TOKENS"`
+	Interval                 Schedule      `arg:"env:INTERVAL"`
+	CycleTimeout             time.Duration `arg:"env:CYCLE_TIMEOUT"`
+	LogLevel                 string        `arg:"env:LOG_LEVEL"`
+	LogFormat                string        `arg:"env:LOG_FORMAT"`
+	Locale                   string        `arg:"env:LOCALE"`
+	Repositories             []string      `arg:"-r,separate"`
+	SearchLimit              int           `arg:"env:SEARCH_LIMIT"`
+	BackfillSince            Since         `arg:"env:BACKFILL_SINCE"`
+	IncludeForks             bool          `arg:"env:INCLUDE_FORKS"`
+	SkipArchived             bool          `arg:"env:SKIP_ARCHIVED"`
+	Orgs                     []string      `arg:"--org,separate,env:ORGS"`
+	Users                    []string      `arg:"--user,separate,env:USERS"`
+	Include                  []string      `arg:"--include,separate,env:INCLUDE"`
+	Exclude                  []string      `arg:"--exclude,separate,env:EXCLUDE"`
+	BatchSize                int           `arg:"env:BATCH_SIZE"`
+	QueryTimeout             time.Duration `arg:"env:QUERY_TIMEOUT"`
+	SlackHook                string        `arg:"env:SLACK_HOOK"`
+	OpsSlackHook             string        `arg:"env:OPS_SLACK_HOOK"`
+	SlackEnabled             bool          `arg:"env:SLACK_ENABLED"`
+	SlackColors              []string      `arg:"env:SLACK_COLORS"`
+	SlackEmoji               []string      `arg:"env:SLACK_EMOJI"`
+	SlackEmojiAsIcon         bool          `arg:"env:SLACK_EMOJI_AS_ICON"`
+	SlackBotToken            string        `arg:"env:SLACK_BOT_TOKEN"`
+	SlackChannel             string        `arg:"env:SLACK_CHANNEL"`
+	SlackUploadThreshold     int           `arg:"env:SLACK_UPLOAD_THRESHOLD"`
+	SlackTemplateFile        string        `arg:"env:SLACK_TEMPLATE_FILE"`
+	IgnoreNonstable          bool          `arg:"env:IGNORE_NONSTABLE"`
+	DeliveryInterval         time.Duration `arg:"env:DELIVERY_INTERVAL"`
+	SendConcurrency          int           `arg:"env:SEND_CONCURRENCY"`
+	SQLitePath               string        `arg:"env:SQLITE_PATH"`
+	SQLiteEnabled            bool          `arg:"env:SQLITE_ENABLED"`
+	Desktop                  bool          `arg:"env:DESKTOP"`
+	MarkdownPath             string        `arg:"env:MARKDOWN_PATH"`
+	MarkdownEnabled          bool          `arg:"env:MARKDOWN_ENABLED"`
+	MarkdownTemplateFile     string        `arg:"env:MARKDOWN_TEMPLATE_FILE"`
+	NotifyDelay              time.Duration `arg:"env:NOTIFY_DELAY"`
+	AuthorInclude            []string      `arg:"env:AUTHOR_INCLUDE"`
+	AuthorExclude            []string      `arg:"env:AUTHOR_EXCLUDE"`
+	SkipMarker               string        `arg:"env:SKIP_MARKER"`
+	RepoOverrides            bool          `arg:"env:REPO_OVERRIDES"`
+	MaxBodySize              int           `arg:"env:MAX_BODY_SIZE"`
+	NotesLength              int           `arg:"env:NOTES_LENGTH"`
+	NotificationFields       []string      `arg:"env:NOTIFICATION_FIELDS"`
+	SentryDSN                string        `arg:"env:SENTRY_DSN"`
+	OTLPEndpoint             string        `arg:"env:OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OTELServiceName          string        `arg:"env:OTEL_SERVICE_NAME"`
+	MaxNotificationsPerCycle int           `arg:"env:MAX_NOTIFICATIONS_PER_CYCLE"`
+	DeferSuppressed          bool          `arg:"env:DEFER_SUPPRESSED"`
+	NotifyRenamed            bool          `arg:"env:NOTIFY_RENAMED"`
+	MetadataTTL              time.Duration `arg:"env:METADATA_TTL"`
+	OpsGenieAPIKey           string        `arg:"env:OPSGENIE_API_KEY"`
+	OpsGenieEnabled          bool          `arg:"env:OPSGENIE_ENABLED"`
+	OpsGenieAPIURL           string        `arg:"env:OPSGENIE_API_URL"`
+	OpsGeniePriority         string        `arg:"env:OPSGENIE_PRIORITY"`
+	OpsGenieResponders       []string      `arg:"env:OPSGENIE_RESPONDERS"`
+	OpsGenieRepositories     []string      `arg:"env:OPSGENIE_REPOSITORIES"`
+	GitlabURL                string        `arg:"env:GITLAB_URL"`
+	GitlabToken              string        `arg:"env:GITLAB_TOKEN"`
+	GitlabProject            string        `arg:"env:GITLAB_PROJECT"`
+	GitlabEnabled            bool          `arg:"env:GITLAB_ENABLED"`
+	GitlabLabels             []string      `arg:"env:GITLAB_LABELS"`
+	GitlabClosePrevious      bool          `arg:"env:GITLAB_CLOSE_PREVIOUS"`
+	GitlabRetries            int           `arg:"env:GITLAB_RETRIES"`
+	GitlabOnDuplicate        string        `arg:"env:GITLAB_ON_DUPLICATE"`
+	GitlabAssignees          []string      `arg:"env:GITLAB_ASSIGNEES"`
+	GitlabMilestone          string        `arg:"env:GITLAB_MILESTONE"`
+	GRPCEndpoint             string        `arg:"--grpc-endpoint,env:GRPC_ENDPOINT"`
+	GRPCEnabled              bool          `arg:"--grpc-enabled,env:GRPC_ENABLED"`
+	GRPCPlaintext            bool          `arg:"--grpc-plaintext,env:GRPC_PLAINTEXT"`
+	GRPCCAFile               string        `arg:"--grpc-ca-file,env:GRPC_CA_FILE"`
+	GRPCMetadata             []string      `arg:"--grpc-metadata,env:GRPC_METADATA"`
+	DiscordHook              string        `arg:"--discord-hook,env:DISCORD_HOOK"`
+	DiscordEnabled           bool          `arg:"--discord-enabled,env:DISCORD_ENABLED"`
+	DiscordTemplateFile      string        `arg:"--discord-template-file,env:DISCORD_TEMPLATE_FILE"`
+	TeamsHook                string        `arg:"--teams-hook,env:TEAMS_HOOK"`
+	TeamsEnabled             bool          `arg:"--teams-enabled,env:TEAMS_ENABLED"`
+	TeamsTemplateFile        string        `arg:"--teams-template-file,env:TEAMS_TEMPLATE_FILE"`
+	SMTPHost                 string        `arg:"--smtp-host,env:SMTP_HOST"`
+	SMTPPort                 int           `arg:"--smtp-port,env:SMTP_PORT"`
+	SMTPTLS                  string        `arg:"--smtp-tls,env:SMTP_TLS"`
+	SMTPUsername             string        `arg:"--smtp-username,env:SMTP_USERNAME"`
+	SMTPPassword             string        `arg:"--smtp-password,env:SMTP_PASSWORD"`
+	EmailFrom                string        `arg:"--email-from,env:EMAIL_FROM"`
+	EmailTo                  []string      `arg:"--email-to,env:EMAIL_TO"`
+	EmailEnabled             bool          `arg:"--email-enabled,env:EMAIL_ENABLED"`
+	EmailTemplateFile        string        `arg:"--email-template-file,env:EMAIL_TEMPLATE_FILE"`
+	WebhookURL               string        `arg:"--webhook-url,env:WEBHOOK_URL"`
+	WebhookEnabled           bool          `arg:"--webhook-enabled,env:WEBHOOK_ENABLED"`
+	WebhookHeaders           []string      `arg:"--webhook-headers,env:WEBHOOK_HEADERS"`
+	WebhookTemplate          string        `arg:"--webhook-template,env:WEBHOOK_TEMPLATE"`
+	NATSServers              []string      `arg:"--nats-servers,env:NATS_SERVERS"`
+	NATSEnabled              bool          `arg:"--nats-enabled,env:NATS_ENABLED"`
+	NATSSubject              string        `arg:"--nats-subject,env:NATS_SUBJECT"`
+	NATSToken                string        `arg:"--nats-token,env:NATS_TOKEN"`
+	NATSUsername             string        `arg:"--nats-username,env:NATS_USERNAME"`
+	NATSPassword             string        `arg:"--nats-password,env:NATS_PASSWORD"`
+	NATSCAFile               string        `arg:"--nats-ca-file,env:NATS_CA_FILE"`
+	NATSJetStream            bool          `arg:"--nats-jetstream,env:NATS_JETSTREAM"`
+	NATSRetries              int           `arg:"--nats-retries,env:NATS_RETRIES"`
+	EventFieldNames          []string      `arg:"--event-field-names,env:EVENT_FIELD_NAMES"`
+	NewnessStrategy          string        `arg:"env:NEWNESS_STRATEGY"`
+	Mode                     string        `arg:"--mode,env:MODE"`
+	GroupBy                  string        `arg:"env:GROUP_BY"`
+	GroupWindow              time.Duration `arg:"env:GROUP_WINDOW"`
+	GroupWindowBypass        []string      `arg:"env:GROUP_WINDOW_BYPASS"`
+	DigestSort               string        `arg:"env:DIGEST_SORT"`
+	DigestLimit              int           `arg:"env:DIGEST_LIMIT"`
+	DigestSchedule           Schedule      `arg:"env:DIGEST_SCHEDULE"`
+	DigestSenders            []string      `arg:"env:DIGEST_SENDERS"`
+	DigestOnly               bool          `arg:"env:DIGEST_ONLY"`
+	StateFile                string        `arg:"env:STATE_FILE"`
+	StateNamespace           string        `arg:"env:STATE_NAMESPACE"`
+	StateBackup              bool          `arg:"env:STATE_BACKUP"`
+	StateWrites              string        `arg:"env:STATE_WRITES"`
+	CatchUp                  bool          `arg:"env:CATCH_UP"`
+	CatchUpLimit             int           `arg:"env:CATCH_UP_LIMIT"`
+	StateCompact             bool          `arg:"env:STATE_COMPACT"`
+	Once                     bool          `arg:"env:ONCE"`
+	Listen                   string        `arg:"--listen,env:LISTEN_ADDR"`
+	FeedEnabled              bool          `arg:"--feed-enabled,env:FEED_ENABLED"`
+	FeedLimit                int           `arg:"--feed-limit,env:FEED_LIMIT"`
+	FeedTitle                string        `arg:"--feed-title,env:FEED_TITLE"`
+	HTTPMaxIdleConns         int           `arg:"env:HTTP_MAX_IDLE_CONNS"`
+	HTTPMaxIdleConnsPerHost  int           `arg:"env:HTTP_MAX_IDLE_CONNS_PER_HOST"`
+	HTTPIdleConnTimeout      time.Duration `arg:"env:HTTP_IDLE_CONN_TIMEOUT"`
+	TLSCertFile              string        `arg:"--tls-cert-file,env:TLS_CERT_FILE"`
+	TLSKeyFile               string        `arg:"--tls-key-file,env:TLS_KEY_FILE"`
+	PauseMode                string        `arg:"env:PAUSE_MODE"`
+	TestToken                string        `arg:"env:TEST_TOKEN"`
+	GithubWebhookSecret      string        `arg:"env:GITHUB_WEBHOOK_SECRET"`
+	GithubWebhookRetries     int           `arg:"env:GITHUB_WEBHOOK_RETRIES"`
+	GithubWebhookDeadLetters string        `arg:"env:GITHUB_WEBHOOK_DEAD_LETTERS"`
+	Poll                     bool          `arg:"--poll,env:POLL"`
+	RateLimitReserve         int           `arg:"env:RATE_LIMIT_RESERVE"`
+	SpreadChecks             bool          `arg:"env:SPREAD_CHECKS"`
+	CheckConcurrency         int           `arg:"env:CHECK_CONCURRENCY"`
+	CheckJitter              time.Duration `arg:"env:CHECK_JITTER"`
+	ExportState              bool          `arg:"--export-state"`
+	ImportState              string        `arg:"--import-state"`
+	Replay                   int           `arg:"--replay"`
+	Diff                     bool          `arg:"--diff"`
+	PruneState               bool          `arg:"--prune-state"`
+	DryRun                   bool          `arg:"--dry-run"`
+	Check                    *CheckCommand `arg:"subcommand:check"`
+}
+
+// CheckCommand checks all repositories a single time and exits, like --once.
+type CheckCommand struct{}
+
+// configReload asks the main loop to reload the config file, answering with the repositories to watch from then on.
+type configReload struct {
+	current      []string
+	repositories chan []string
 }
 
 // Token returns an oauth2 token or an error.
@@ -29,63 +208,1468 @@ func (c Config) Token() *oauth2.Token {
 	return &oauth2.Token{AccessToken: c.GithubToken}
 }
 
+// newGithubClient returns a client of the GraphQL API at endpoint authenticating with the token,
+// without one if it is empty, adding the headers to its requests.
+func newGithubClient(endpoint string, token *oauth2.Token, limit *SecondaryRateLimit, headers http.Header) *githubql.Client {
+	base := &http.Client{Transport: &rateLimitTransport{
+		next:  &headerTransport{next: http.DefaultTransport, headers: headers},
+		limit: limit,
+	}}
+	if token.AccessToken == "" {
+		return githubql.NewEnterpriseClient(endpoint, base)
+	}
+	tokenSource := oauth2.StaticTokenSource(token)
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base)
+	return githubql.NewEnterpriseClient(endpoint, oauth2.NewClient(ctx, tokenSource))
+}
+
 func main() {
 	_ = godotenv.Load()
 
 	c := Config{
-		Interval: time.Hour,
-		LogLevel: "info",
+		Interval:                Every(time.Hour),
+		FeedLimit:               50,
+		FeedTitle:               "Releases",
+		LogLevel:                "info",
+		SlackEnabled:            true,
+		SQLiteEnabled:           true,
+		MarkdownEnabled:         true,
+		OpsGenieEnabled:         true,
+		GitlabEnabled:           true,
+		GRPCEnabled:             true,
+		WebhookEnabled:          true,
+		NATSEnabled:             true,
+		NATSSubject:             "releases.{owner}.{name}",
+		NATSRetries:             3,
+		DiscordEnabled:          true,
+		TeamsEnabled:            true,
+		OpsGenieAPIURL:          "https://api.opsgenie.com",
+		OpsGeniePriority:        "P3",
+		GitlabURL:               "https://gitlab.com",
+		GitlabRetries:           3,
+		GitlabOnDuplicate:       GitlabDuplicateSkip,
+		SMTPPort:                587,
+		SMTPTLS:                 SMTPStartTLS,
+		EmailEnabled:            true,
+		NewnessStrategy:         NewnessPublished,
+		Mode:                    ModeReleases,
+		GithubAPIURL:            DefaultGithubAPIURL,
+		Poll:                    true,
+		RateLimitReserve:        50,
+		LogFormat:               LogFormatJSON,
+		Locale:                  DefaultLocale,
+		MaxBodySize:             10000,
+		SlackUploadThreshold:    3000,
+		MetadataTTL:             24 * time.Hour,
+		SearchLimit:             100,
+		BatchSize:               DefaultBatchSize,
+		PauseMode:               PauseBuffer,
+		GithubWebhookRetries:    5,
+		CatchUp:                 true,
+		CatchUpLimit:            20,
+		StateWrites:             StateWritesCycle,
+		HTTPMaxIdleConns:        defaultMaxIdleConns,
+		HTTPMaxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+		HTTPIdleConnTimeout:     defaultIdleConnTimeout,
+		OTELServiceName:         "github-releases-notifier",
+	}
+	// Like arg.MustParse, but invalid flags or environment variables exit with exitConfig.
+	parser, err := arg.NewParser(arg.Config{}, &c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfig)
+	}
+	switch err := parser.Parse(os.Args[1:]); {
+	case err == arg.ErrHelp:
+		parser.WriteHelp(os.Stdout)
+		os.Exit(0)
+	case err != nil:
+		parser.WriteUsage(os.Stderr)
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(exitConfig)
 	}
-	arg.MustParse(&c)
 
-	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stdout))
+	if c.Check != nil {
+		c.Once = true
+	}
+
+	logger, err := newLogger(c.LogFormat, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfig)
+	}
 	logger = log.With(logger,
 		"ts", log.DefaultTimestampUTC,
-		"caller", log.Caller(5),
+		"caller", log.Caller(6),
 	)
 
 	// level.SetKey("severity")
-	switch strings.ToLower(c.LogLevel) {
-	case "debug":
-		logger = level.NewFilter(logger, level.AllowDebug())
-	case "warn":
-		logger = level.NewFilter(logger, level.AllowWarn())
-	case "error":
-		logger = level.NewFilter(logger, level.AllowError())
-	default:
-		logger = level.NewFilter(logger, level.AllowInfo())
+	// The level can be changed while running through the server's endpoints.
+	logLevel := NewLevelLogger(logger, c.LogLevel)
+	logger = logLevel
+
+	if err := ValidateStateNamespace(c.StateNamespace); err != nil {
+		level.Error(logger).Log("msg", "invalid state namespace", "err", err)
+		os.Exit(exitConfig)
+	}
+
+	// A second instance using the same state would notify twice, so the state is locked.
+	// Instances with their own namespace share the file, each locking its namespace.
+	// A dry run doesn't change the state, so it can run next to the instance using it.
+	var lock *Lock
+	if c.StateFile != "" && !c.DryRun {
+		lockPath := c.StateFile + ".lock"
+		if c.StateNamespace != "" {
+			lockPath = c.StateFile + "." + c.StateNamespace + ".lock"
+		}
+		if lock, err = AcquireLock(lockPath); err != nil {
+			level.Error(logger).Log("msg", "failed to lock state", "err", err)
+			os.Exit(exitError)
+		}
+	}
+	var store *FileStore
+	exit := func(code int) {
+		if store != nil {
+			if err := store.Flush(); err != nil {
+				level.Warn(logger).Log("msg", "failed to write state", "err", err)
+			}
+		}
+		if err := lock.Release(); err != nil {
+			level.Warn(logger).Log("msg", "failed to release state lock", "err", err)
+		}
+		os.Exit(code)
+	}
+	// Once waiting for releases, the first signal stops gracefully: the running check and the deliveries
+	// of the releases found so far are finished. A second one, or one before, stops right away.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	var graceful int32
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		if atomic.LoadInt32(&graceful) == 1 {
+			level.Info(logger).Log("msg", "stopping after the running check and deliveries", "signal", sig)
+			stop()
+			sig = <-signals
+		}
+		level.Info(logger).Log("msg", "stopping", "signal", sig)
+		exit(exitNoNewReleases)
+	}()
+
+	store, err = NewFileStore(c.StateFile, c.StateNamespace)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to load state", "err", err)
+		exit(exitError)
+	}
+	if c.DryRun {
+		store.ReadOnly()
+		level.Info(logger).Log("msg", "dry run, releases are only logged and the state isn't written")
+	}
+
+	if c.ExportState {
+		if err := ExportState(store, os.Stdout); err != nil {
+			level.Error(logger).Log("msg", "failed to export state", "err", err)
+			exit(exitError)
+		}
+		exit(0)
+	}
+	if c.ImportState != "" {
+		if c.StateFile == "" {
+			level.Error(logger).Log("msg", "importing state needs a state file")
+			exit(exitConfig)
+		}
+		in := os.Stdin
+		if c.ImportState != "-" {
+			if in, err = os.Open(c.ImportState); err != nil {
+				level.Error(logger).Log("msg", "failed to import state", "err", err)
+				exit(exitError)
+			}
+		}
+		n, err := ImportState(store, in)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to import state", "err", err)
+			exit(exitError)
+		}
+		level.Info(logger).Log("msg", "imported state", "releases", n)
+		exit(0)
+	}
+
+	fileConfig := &FileConfig{}
+	if c.ConfigFile != "" {
+		fileConfig, err = LoadFileConfig(c.ConfigFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to load config file", "err", err)
+			exit(exitConfig)
+		}
+	}
+	// The repositories given with flags stay watched when the config file is reloaded.
+	flagRepositories := append([]string(nil), c.Repositories...)
+	for _, repoName := range fileConfig.RepositoryNames() {
+		if !containsFold(c.Repositories, repoName) {
+			c.Repositories = append(c.Repositories, repoName)
+		}
+	}
+	for _, org := range c.Orgs {
+		c.Repositories = append(c.Repositories, orgPrefix+org)
+	}
+	for _, user := range c.Users {
+		c.Repositories = append(c.Repositories, userPrefix+user)
+	}
+	// Repositories given as host/owner/name are watched as owner/name, with the client of their host.
+	hostTokens, err := ParseHostTokens(c.GithubHostTokens)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid github host tokens", "err", err)
+		exit(exitConfig)
+	}
+	hosts := make(map[string]string)
+	for i, entry := range c.Repositories {
+		host, repoName := splitHost(entry)
+		if host == "" {
+			continue
+		}
+		host = strings.ToLower(host)
+		if hostTokens[host] == "" && !c.AllowUnauthenticated {
+			level.Error(logger).Log("msg", "GITHUB_HOST_TOKENS has no token for the repository's host, set it or run with --allow-unauthenticated", "repository", entry)
+			exit(exitAuth)
+		}
+		hosts[repoName] = host
+		c.Repositories[i] = repoName
+	}
+	// Repositories on GitLab and Gitea, given as gitlab:host/namespace/project or gitea:host/owner/name,
+	// are watched as namespace/project or owner/name on their source, with their host's token if it has one.
+	forgeTokens, err := ParseHostTokens(c.ForgeTokens)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid forge tokens", "err", err)
+		exit(exitConfig)
+	}
+	forges := make(map[string]Source)
+	sources := make(map[string]Source)
+	watchSource := func(entry string) (string, bool, error) {
+		kind, host, repoName, err := splitSource(entry)
+		if err != nil || kind == "" {
+			return entry, false, err
+		}
+		if _, ok := forges[kind+host]; !ok {
+			forges[kind+host] = NewSource(kind, host, forgeTokens[host])
+		}
+		sources[repoName] = forges[kind+host]
+		return repoName, true, nil
+	}
+	for i, entry := range c.Repositories {
+		repoName, _, err := watchSource(entry)
+		if err != nil {
+			level.Error(logger).Log("msg", "invalid repository", "err", err)
+			exit(exitConfig)
+		}
+		c.Repositories[i] = repoName
+	}
+	graphqlURL, err := GraphQLURL(c.GithubAPIURL)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid GITHUB_API_URL", "err", err)
+		exit(exitConfig)
+	}
+	if c.GithubGraphQLURL != "" {
+		graphqlURL = c.GithubGraphQLURL
+	}
+	filter, err := ParseRepositoryFilter(c.Include, c.Exclude)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid repository filter", "err", err)
+		exit(exitConfig)
 	}
 
 	if len(c.Repositories) == 0 {
 		level.Error(logger).Log("msg", "no repositories wo watch")
-		os.Exit(1)
+		exit(exitConfig)
+	}
+
+	if c.StateBackup {
+		if err := store.Backup(); err != nil {
+			level.Error(logger).Log("msg", "failed to back up state", "err", err)
+			exit(exitError)
+		}
+	}
+
+	switch c.NewnessStrategy {
+	case NewnessPublished, NewnessSemver, NewnessCreated, NewnessCreatedAfterLastSeen:
+	default:
+		level.Error(logger).Log("msg", "unknown newness strategy", "strategy", c.NewnessStrategy)
+		exit(exitConfig)
+	}
+	if c.FeedEnabled && c.Listen == "" {
+		level.Error(logger).Log("msg", "FEED_ENABLED needs LISTEN_ADDR to serve the feed on")
+		exit(exitConfig)
+	}
+	if c.FeedLimit < 1 {
+		level.Error(logger).Log("msg", "FEED_LIMIT must be at least 1", "feed_limit", c.FeedLimit)
+		exit(exitConfig)
+	}
+	if len(c.NATSServers) > 0 && c.NATSSubject == "" {
+		level.Error(logger).Log("msg", "NATS_SERVERS needs NATS_SUBJECT to publish release events to")
+		exit(exitConfig)
+	}
+	if c.NATSRetries < 0 {
+		level.Error(logger).Log("msg", "NATS_RETRIES must not be negative", "nats_retries", c.NATSRetries)
+		exit(exitConfig)
+	}
+	if c.NotesLength < 0 {
+		level.Error(logger).Log("msg", "NOTES_LENGTH must not be negative", "notes_length", c.NotesLength)
+		exit(exitConfig)
+	}
+	if c.GithubWebhookSecret != "" && c.Listen == "" {
+		level.Error(logger).Log("msg", "GITHUB_WEBHOOK_SECRET needs LISTEN_ADDR to receive webhook events on")
+		exit(exitConfig)
+	}
+	if !c.Poll && c.GithubWebhookSecret == "" {
+		level.Error(logger).Log("msg", "POLL=false needs GITHUB_WEBHOOK_SECRET to receive webhook events instead")
+		exit(exitConfig)
+	}
+	if c.CheckConcurrency > 1 && c.SpreadChecks {
+		level.Error(logger).Log("msg", "SPREAD_CHECKS spreads the queries of one worker, it doesn't work with CHECK_CONCURRENCY")
+		exit(exitConfig)
+	}
+	if c.GitlabOnDuplicate != GitlabDuplicateSkip && c.GitlabOnDuplicate != GitlabDuplicateUpdate {
+		level.Error(logger).Log("msg", "GITLAB_ON_DUPLICATE must be skip or update", "on_duplicate", c.GitlabOnDuplicate)
+		exit(exitConfig)
+	}
+	if c.SMTPTLS != SMTPStartTLS && c.SMTPTLS != SMTPTLS && c.SMTPTLS != SMTPPlain {
+		level.Error(logger).Log("msg", "SMTP_TLS must be starttls, tls or none", "smtp_tls", c.SMTPTLS)
+		exit(exitConfig)
+	}
+	if c.SMTPHost != "" && (c.EmailFrom == "" || len(c.EmailTo) == 0) {
+		level.Error(logger).Log("msg", "SMTP_HOST needs EMAIL_FROM and EMAIL_TO")
+		exit(exitConfig)
+	}
+	if !validMode(c.Mode) {
+		level.Error(logger).Log("msg", "unknown mode", "mode", c.Mode)
+		exit(exitConfig)
+	}
+	if c.Interval.Next(time.Now()).IsZero() {
+		level.Error(logger).Log("msg", "interval never runs a check", "interval", c.Interval)
+		exit(exitConfig)
+	}
+	if c.PauseMode != PauseBuffer && c.PauseMode != PauseDrop {
+		level.Error(logger).Log("msg", "unknown pause mode", "pause_mode", c.PauseMode)
+		exit(exitConfig)
+	}
+	if c.GithubWebhookRetries < 0 {
+		level.Error(logger).Log("msg", "GITHUB_WEBHOOK_RETRIES must not be negative", "github_webhook_retries", c.GithubWebhookRetries)
+		exit(exitConfig)
+	}
+	if c.GroupBy != "" && c.GroupBy != GroupByOwner {
+		level.Error(logger).Log("msg", "unknown grouping", "group_by", c.GroupBy)
+		exit(exitConfig)
+	}
+	if c.GroupWindow > 0 && c.GroupBy == "" {
+		level.Error(logger).Log("msg", "GROUP_WINDOW needs GROUP_BY")
+		exit(exitConfig)
+	}
+	if c.Replay < 0 {
+		level.Error(logger).Log("msg", "replay needs a positive number of releases", "replay", c.Replay)
+		exit(exitConfig)
+	}
+	switch c.DigestSort {
+	case "", DigestSortName, DigestSortVersion, DigestSortRecency:
+	default:
+		level.Error(logger).Log("msg", "unknown digest order", "digest_sort", c.DigestSort)
+		exit(exitConfig)
+	}
+	digestEnabled := c.DigestSchedule.String() != ""
+	if digestEnabled && !c.DigestSchedule.Next(time.Now()).After(time.Now()) {
+		level.Error(logger).Log("msg", "digest schedule never sends a digest", "digest_schedule", c.DigestSchedule)
+		exit(exitConfig)
+	}
+	if len(c.DigestSenders) == 0 {
+		c.DigestSenders = []string{"slack"}
+	}
+	for _, sender := range c.DigestSenders {
+		if !containsFold(DigestSenderNames, sender) {
+			level.Error(logger).Log("msg", "unknown digest sender", "sender", sender, "supported", strings.Join(DigestSenderNames, ","))
+			exit(exitConfig)
+		}
+	}
+	if c.DigestOnly && !digestEnabled {
+		level.Error(logger).Log("msg", "DIGEST_ONLY needs DIGEST_SCHEDULE")
+		exit(exitConfig)
+	}
+
+	reporter, err := NewSentry(c.SentryDSN, logger)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to set up error reporting", "err", err)
+		exit(exitConfig)
 	}
 
-	tokenSource := oauth2.StaticTokenSource(c.Token())
-	client := oauth2.NewClient(context.Background(), tokenSource)
+	tracer := NewTracer(c.OTLPEndpoint, c.OTELServiceName, logger)
+
+	if err := tuneTransport(c.HTTPMaxIdleConns, c.HTTPMaxIdleConnsPerHost, c.HTTPIdleConnTimeout); err != nil {
+		level.Error(logger).Log("msg", "invalid connection pool settings", "err", err)
+		exit(exitConfig)
+	}
+
+	// Operational events, like a rejected token, go to a Slack hook of their own if there is one.
+	opsHook := c.OpsSlackHook
+	if c.DryRun {
+		opsHook = ""
+	}
+	ops := NewOps(opsHook, logger)
+
+	// Extra headers go to GitHub with every request, e.g. for a gateway in between.
+	githubHeaders, err := ParseGithubHeaders(c.GithubHeaders)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid github headers", "err", err)
+		exit(exitConfig)
+	}
+	if len(githubHeaders) > 0 {
+		level.Debug(logger).Log("msg", "adding headers to GitHub requests", "headers", strings.Join(redactedHeaders(githubHeaders), ","))
+	}
+
+	// The secondary rate limit is shared by all clients, pausing one pauses all of them.
+	secondaryRateLimit := &SecondaryRateLimit{}
+
+	if c.GithubToken == "" && !c.AllowUnauthenticated {
+		level.Error(logger).Log("msg", "GITHUB_TOKEN is not set, set it or run with --allow-unauthenticated")
+		exit(exitAuth)
+	}
+	if c.GithubToken == "" {
+		level.Warn(logger).Log("msg", "running without a GitHub token, GitHub allows only 60 requests per hour without one")
+	}
+
+	// Repositories with their own token get a client of their own, those sharing a token share the client.
+	clientsByToken := make(map[string]*githubql.Client)
+	clients := make(map[string]*githubql.Client)
+	for _, repoName := range c.Repositories {
+		token := fileConfig.TokenFor(repoName)
+		if token == "" {
+			continue
+		}
+		if _, ok := clientsByToken[token]; !ok {
+			clientsByToken[token] = newGithubClient(graphqlURL, &oauth2.Token{AccessToken: token}, secondaryRateLimit, githubHeaders)
+		}
+		clients[repoName] = clientsByToken[token]
+	}
+
+	// A rejected token fails every query, so it's better to stop right away.
+	// Other failures are left to the checks, which retry them.
+	client := newGithubClient(graphqlURL, c.Token(), secondaryRateLimit, githubHeaders)
+	verify := map[string]*githubql.Client{"GITHUB_TOKEN": client}
+	if c.GithubToken == "" {
+		delete(verify, "GITHUB_TOKEN")
+	}
+	// Repositories on other hosts, like a GitHub Enterprise Server, get a client of their host, with its token.
+	hostClients := make(map[string]*githubql.Client)
+	for repoName, host := range hosts {
+		if _, ok := hostClients[host]; !ok {
+			hostClients[host] = newGithubClient("https://"+host+"/api/graphql", &oauth2.Token{AccessToken: hostTokens[host]}, secondaryRateLimit, githubHeaders)
+			if hostTokens[host] != "" {
+				verify["token of "+host] = hostClients[host]
+			}
+		}
+		clients[repoName] = hostClients[host]
+	}
+	for _, repoName := range c.Repositories {
+		if token := fileConfig.TokenFor(repoName); token != "" && token != c.GithubToken {
+			verify["token of "+repoName] = clients[repoName]
+		}
+	}
+	for token, client := range verify {
+		err := verifyToken(client)
+		if err == errTokenRejected {
+			level.Error(logger).Log("msg", "GitHub token is invalid", "token", token, "err", err)
+			ops.Notify(OpsTokenRejected, token, fmt.Sprintf("GitHub rejected %s as invalid, expired or revoked, not starting", token))
+			exit(exitAuth)
+		}
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to verify the GitHub token", "token", token, "err", err)
+		}
+	}
+
+	modeFor := func(repoName string) string {
+		return fileConfig.ModeFor(repoName, c.Mode)
+	}
+	newnessFor := func(repoName string) string {
+		return fileConfig.NewnessFor(repoName, c.NewnessStrategy)
+	}
 	checker := &Checker{
-		logger: logger,
-		client: githubql.NewClient(client),
+		logger:        logger,
+		client:        client,
+		clients:       clients,
+		sources:       sources,
+		store:         store,
+		newness:       c.NewnessStrategy,
+		discussions:   fileConfig.Discussions(),
+		initialNotify: fileConfig.InitialNotifyFor,
+		backfillSince: c.BackfillSince,
+		catchUp:       c.CatchUp,
+		catchUpLimit:  c.CatchUpLimit,
+		checks:        fileConfig.ChecksFor,
+		assets:        fileConfig.RequiredAssetsFor,
+		paths:         fileConfig.PathsFor,
+		intervals:     fileConfig.IntervalFor,
+		modes:         modeFor,
+		newnessFor:    newnessFor,
+		releaseLines:  fileConfig.ReleaseLines(),
+		notifyDelay:   c.NotifyDelay,
+		reporter:      reporter,
+		ops:           ops,
+		tracer:        tracer,
+		secondary:     secondaryRateLimit,
+		metadata:      NewMetadataCache(c.MetadataTTL),
+		searchLimit:   c.SearchLimit,
+		includeForks:  c.IncludeForks,
+		skipArchived:  c.SkipArchived,
+		pushOnly:      !c.Poll,
+		filter:        filter,
+		batchSize:     c.BatchSize,
+		queryTimeout:  c.QueryTimeout,
+		overrides:     c.RepoOverrides,
+		triggers:      make(chan struct{}, 1),
+		deadLetters:   c.GithubWebhookDeadLetters,
+
+		maxPerCycle:     c.MaxNotificationsPerCycle,
+		deferSuppressed: c.DeferSuppressed,
+		notifyRenamed:   c.NotifyRenamed,
+		cycleTimeout:    c.CycleTimeout,
+		webhookRetries:  c.GithubWebhookRetries,
+
+		rateLimitReserve: c.RateLimitReserve,
+		spread:           c.SpreadChecks,
+		schedule:         &c.Interval,
+		concurrency:      c.CheckConcurrency,
+		jitter:           c.CheckJitter,
 	}
 
-	// TODO: releases := make(chan Repository, len(c.Repositories))
-	releases := make(chan Repository)
-	go checker.Run(c.Interval, c.Repositories, releases)
+	// The diff shows what the next check would notify about, before it changes anything.
+	if c.Diff {
+		n, err := checker.Diff(c.Repositories, os.Stdout)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to diff against the state", "err", err)
+			exit(exitError)
+		}
+		level.Info(logger).Log("msg", "diff done", "would_notify", n)
+		exit(0)
+	}
 
-	slack := SlackSender{Hook: c.SlackHook}
+	// Pruning is compacting on its own, without running checks afterwards.
+	if c.StateCompact || c.PruneState {
+		// Compacting with a failed expansion would drop the state of its repositories.
+		watched, err := checker.expand(c.Repositories)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to compact state", "err", err)
+			exit(exitError)
+		}
+		removed, err := CompactState(store, watched)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to compact state", "err", err)
+			exit(exitError)
+		}
+		for _, key := range removed {
+			level.Info(logger).Log("msg", "removed state of repository that isn't watched anymore", "key", key)
+		}
+		level.Info(logger).Log("msg", "compacted state", "removed", len(removed))
+		if c.PruneState {
+			exit(0)
+		}
+	}
+	switch c.StateWrites {
+	case StateWritesCycle:
+		store.Batch()
+	case StateWritesImmediate:
+	default:
+		level.Error(logger).Log("msg", "unknown state writes", "state_writes", c.StateWrites)
+		exit(exitConfig)
+	}
 
-	level.Info(logger).Log("msg", "waiting for new releases")
-	for repository := range releases {
-		if c.IgnoreNonstable && repository.Release.IsNonstable() {
-			level.Debug(logger).Log("msg", "not notifying about non-stable version", "version", repository.Release.Name)
+	// Watched repositories that got archived or renamed are notified in Slack.
+	notices := make(chan Notice)
+	checker.notices = notices
+
+	// With grouping, the checker tells when a cycle is done to send its groups.
+	var cycles chan struct{}
+	if c.GroupBy != "" {
+		cycles = make(chan struct{})
+		checker.cycles = cycles
+	}
+
+	if c.SlackColors == nil {
+		c.SlackColors = DefaultColorRules
+	}
+	colors, err := ParseColorRules(c.SlackColors)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid slack colors", "err", err)
+		exit(exitConfig)
+	}
+	if c.SlackEmoji == nil {
+		c.SlackEmoji = DefaultEmojiRules
+	}
+	emoji, err := ParseEmojiRules(c.SlackEmoji)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid slack emoji", "err", err)
+		exit(exitConfig)
+	}
+	if c.GroupWindowBypass == nil {
+		c.GroupWindowBypass = DefaultWindowBypass
+	}
+	windowBypass, err := ParseWindowBypass(c.GroupWindowBypass)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid group window bypass", "err", err)
+		exit(exitConfig)
+	}
+	// Releases matching a bypass aren't held for the window, but sent to Slack on their own right away.
+	bypassesWindow := func(repository Repository) bool {
+		if c.GroupWindow <= 0 {
+			return false
+		}
+		for _, rule := range windowBypass {
+			if rule.Matches(repository) {
+				return true
+			}
+		}
+		return false
+	}
+	fields, err := ParseNotificationFields(c.NotificationFields)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid notification fields", "err", err)
+		exit(exitConfig)
+	}
+	// The names apply to the events of the JSON senders.
+	eventFieldNames, err := ParseEventFieldNames(c.EventFieldNames)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid event field names", "err", err)
+		exit(exitConfig)
+	}
+	messages, err := MessagesFor(c.Locale)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid locale", "err", err)
+		exit(exitConfig)
+	}
+	if c.SlackBotToken != "" && c.SlackChannel == "" {
+		level.Error(logger).Log("msg", "SLACK_BOT_TOKEN needs SLACK_CHANNEL to upload release notes to")
+		exit(exitConfig)
+	}
+	// Senders can be disabled without removing their configuration, e.g. during a migration.
+	slackConfigured := c.SlackHook != "" || len(fileConfig.SlackDestinations) > 0
+	slackEnabled := c.SlackEnabled && slackConfigured
+	for sender, disabled := range map[string]bool{
+		"slack":    !c.SlackEnabled && slackConfigured,
+		"sqlite":   !c.SQLiteEnabled && c.SQLitePath != "",
+		"gitlab":   !c.GitlabEnabled && c.GitlabToken != "",
+		"opsgenie": !c.OpsGenieEnabled && c.OpsGenieAPIKey != "",
+		"markdown": !c.MarkdownEnabled && c.MarkdownPath != "",
+		"grpc":     !c.GRPCEnabled && c.GRPCEndpoint != "",
+		"webhook":  !c.WebhookEnabled && c.WebhookURL != "",
+		"discord":  !c.DiscordEnabled && c.DiscordHook != "",
+		"teams":    !c.TeamsEnabled && c.TeamsHook != "",
+		"email":    !c.EmailEnabled && c.SMTPHost != "",
+		"nats":     !c.NATSEnabled && len(c.NATSServers) > 0,
+	} {
+		if disabled {
+			level.Info(logger).Log("msg", "sender is configured but disabled", "sender", sender)
+		}
+	}
+	// Without the sqlite3 command line tool every release would fail to be recorded.
+	if c.SQLiteEnabled && c.SQLitePath != "" {
+		if _, err := exec.LookPath("sqlite3"); err != nil {
+			level.Error(logger).Log("msg", "SQLITE_PATH needs the sqlite3 command line tool", "err", err)
+			exit(exitConfig)
+		}
+	}
+	slack := SlackSender{
+		Hook:            c.SlackHook,
+		BotToken:        c.SlackBotToken,
+		Channel:         c.SlackChannel,
+		UploadThreshold: c.SlackUploadThreshold,
+		NotesLength:     c.NotesLength,
+		Colors:          colors,
+		Emoji:           emoji,
+		EmojiAsIcon:     c.SlackEmojiAsIcon,
+		Mentions:        fileConfig.SlackMentions,
+		Channels:        fileConfig.SlackChannelFor,
+		Routes:          fileConfig.SlackDestinationsFor,
+		Fields:          fields,
+		Messages:        messages,
+		DigestSort:      c.DigestSort,
+		DigestLimit:     c.DigestLimit,
+	}
+	sqlite := &SQLiteSender{Path: c.SQLitePath}
+	desktop := &DesktopSender{logger: logger, Messages: messages}
+	markdown := &MarkdownFileSender{Path: c.MarkdownPath, Fields: fields, Messages: messages}
+	discord := &DiscordSender{Hook: c.DiscordHook, Fields: fields, Messages: messages}
+	teams := &TeamsSender{Hook: c.TeamsHook, Fields: fields, Messages: messages}
+	email := &EmailSender{
+		Host:        c.SMTPHost,
+		Port:        c.SMTPPort,
+		TLS:         c.SMTPTLS,
+		Username:    c.SMTPUsername,
+		Password:    c.SMTPPassword,
+		From:        c.EmailFrom,
+		To:          c.EmailTo,
+		Messages:    messages,
+		DigestSort:  c.DigestSort,
+		DigestLimit: c.DigestLimit,
+	}
+	if email.Template, err = LoadEmailTemplate(c.EmailTemplateFile); err != nil {
+		level.Error(logger).Log("msg", "invalid message template", "sender", "email", "err", err)
+		exit(exitConfig)
+	}
+	opsgenie := &OpsGenieSender{
+		logger:       logger,
+		APIURL:       c.OpsGenieAPIURL,
+		APIKey:       c.OpsGenieAPIKey,
+		Priority:     c.OpsGeniePriority,
+		Responders:   c.OpsGenieResponders,
+		Repositories: c.OpsGenieRepositories,
+		Fields:       fields,
+		Messages:     messages,
+	}
+	gitlab := &GitlabSender{
+		store:         store,
+		URL:           c.GitlabURL,
+		Token:         c.GitlabToken,
+		Project:       c.GitlabProject,
+		Labels:        c.GitlabLabels,
+		ClosePrevious: c.GitlabClosePrevious,
+		Retries:       c.GitlabRetries,
+		OnDuplicate:   c.GitlabOnDuplicate,
+		Assignees:     c.GitlabAssignees,
+		Milestone:     c.GitlabMilestone,
+		NotesLength:   c.NotesLength,
+		Fields:        fields,
+		Messages:      messages,
+	}
+
+	var grpc *GRPCSender
+	if c.GRPCEndpoint != "" {
+		if grpc, err = NewGRPCSender(c.GRPCEndpoint, c.GRPCPlaintext, c.GRPCCAFile, c.GRPCMetadata); err != nil {
+			level.Error(logger).Log("msg", "invalid grpc sender", "err", err)
+			exit(exitConfig)
+		}
+	}
+
+	webhook := &WebhookSender{URL: c.WebhookURL, FieldNames: eventFieldNames}
+	nats := &NATSSender{
+		Servers:    c.NATSServers,
+		Subject:    c.NATSSubject,
+		Token:      c.NATSToken,
+		Username:   c.NATSUsername,
+		Password:   c.NATSPassword,
+		CAFile:     c.NATSCAFile,
+		JetStream:  c.NATSJetStream,
+		Retries:    c.NATSRetries,
+		FieldNames: eventFieldNames,
+	}
+	if webhook.Headers, err = parseHeaders("webhook", c.WebhookHeaders); err != nil {
+		level.Error(logger).Log("msg", "invalid webhook headers", "err", err)
+		exit(exitConfig)
+	}
+	if c.WebhookTemplate != "" {
+		if webhook.Template, err = ParseWebhookTemplate(c.WebhookTemplate); err != nil {
+			level.Error(logger).Log("msg", "invalid webhook template", "err", err)
+			exit(exitConfig)
+		}
+	}
+
+	// Senders with a template of their own render their messages with it.
+	for _, sender := range []struct {
+		name, path string
+		template   **template.Template
+	}{
+		{"slack", c.SlackTemplateFile, &slack.Template},
+		{"markdown", c.MarkdownTemplateFile, &markdown.Template},
+		{"discord", c.DiscordTemplateFile, &discord.Template},
+		{"teams", c.TeamsTemplateFile, &teams.Template},
+	} {
+		if sender.path == "" {
 			continue
 		}
-		if err := slack.Send(repository); err != nil {
+		if *sender.template, err = LoadMessageTemplate(sender.name, sender.path); err != nil {
+			level.Error(logger).Log("msg", "invalid message template", "sender", sender.name, "err", err)
+			exit(exitConfig)
+		}
+	}
+
+	var sendFailures int32
+	deliver := func(sender string, repository Repository, notifier Notifier) error {
+		repoName := repository.Owner + "/" + repository.Name
+
+		if c.DryRun {
+			level.Info(logger).Log("msg", "dry run, not sending release", "sender", sender, "repository", repoName, "tag", repository.Release.TagName)
+			return nil
+		}
+		span := tracer.Start(repository.span, "send")
+		span.SetAttribute("sender", sender)
+		span.SetAttribute("repository", repoName)
+		err := notifier.Send(repository)
+		span.End(err)
+		recordDelivery(sender, err)
+
+		if err != nil {
+			atomic.AddInt32(&sendFailures, 1)
 			level.Warn(logger).Log(
-				"msg", "failed to send release to messenger",
+				"msg", "failed to send release",
+				"sender", sender,
+				"repository", repoName,
 				"err", err,
 			)
+			reporter.Repeated(sender+" "+repoName, err, map[string]string{
+				"sender":     sender,
+				"repository": repoName,
+			})
+			ops.Repeated(sender, sender+" "+repoName, err)
+			return err
+		}
+		reporter.Reset(sender + " " + repoName)
+		ops.Reset(sender + " " + repoName)
+		return nil
+	}
+
+	// Releases go to the senders of both their repository and their channel.
+	sendsTo := func(repoName string, release Release, sender string) bool {
+		return fileConfig.SendsTo(repoName, sender) && fileConfig.ChannelSendsTo(release, sender)
+	}
+
+	// The enabled senders are notified in this order.
+	notifiers := &Notifiers{}
+	notifiers.Register("sqlite", c.SQLiteEnabled && c.SQLitePath != "", sqlite, nil)
+	notifiers.Register("slack", slackEnabled, &slack, func(repository Repository) bool {
+		// Without SLACK_HOOK only the releases routed to a destination are sent.
+		if c.SlackHook == "" && len(slack.destinations(repository)) == 0 {
+			return false
+		}
+		return c.GroupBy == "" || bypassesWindow(repository)
+	})
+	notifiers.Register("discord", c.DiscordEnabled && c.DiscordHook != "", discord, nil)
+	notifiers.Register("teams", c.TeamsEnabled && c.TeamsHook != "", teams, nil)
+	notifiers.Register("email", c.EmailEnabled && c.SMTPHost != "", email, nil)
+	notifiers.Register("gitlab", c.GitlabEnabled && c.GitlabToken != "" && c.GitlabProject != "", gitlab, nil)
+	notifiers.Register("opsgenie", c.OpsGenieEnabled && c.OpsGenieAPIKey != "", opsgenie, opsgenie.Watches)
+	notifiers.Register("desktop", c.Desktop, desktop, nil)
+	notifiers.Register("markdown", c.MarkdownEnabled && c.MarkdownPath != "", markdown, nil)
+	notifiers.Register("grpc", c.GRPCEnabled && grpc != nil, grpc, nil)
+	notifiers.Register("webhook", c.WebhookEnabled && c.WebhookURL != "", webhook, nil)
+	notifiers.Register("nats", c.NATSEnabled && len(c.NATSServers) > 0, nats, nil)
+
+	// sendAll delivers the release to every enabled sender but the ones that delivered it before,
+	// or only to the one named only. Tests go to the senders regardless of the repository and grouping.
+	sendAll := func(repository Repository, only string, test bool, delivered []string) []SenderResult {
+		repoName := repository.Owner + "/" + repository.Name
+
+		return notifiers.Notify(repository, func(sender string) bool {
+			switch {
+			case only != "" && sender != only, containsFold(delivered, sender):
+				return true
+			case test:
+				return false
+			}
+			// The digest's senders only get the digest.
+			return !sendsTo(repoName, repository.Release, sender) ||
+				!notifiers.Accepts(sender, repository) ||
+				(c.DigestOnly && containsFold(c.DigestSenders, sender))
+		}, deliver)
+	}
+
+	// Releases that failed for some senders are retried for those only, see DeliveryLog.
+	deliveryLog := &DeliveryLog{store: store}
+	dispatcher := NewDispatcher(c.DeliveryInterval, c.SendConcurrency, func(repository Repository) {
+		repoName := repository.Owner + "/" + repository.Name
+		defer reporter.Recover(map[string]string{"repository": repoName})
+
+		delivered, err := deliveryLog.Delivered(repository)
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to load the release's deliveries", "repository", repoName, "err", err)
+		}
+		repository.delivered = delivered
+		results := sendAll(repository, "", false, delivered)
+		retried, err := deliveryLog.Record(repository, results)
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to store the release's deliveries", "repository", repoName, "err", err)
+		}
+		// Deliveries finish after the cycle's state was written, their outcome, the history and
+		// what the senders keep in the state, like GitLab issues, are written right away.
+		if err := store.Flush(); err != nil {
+			level.Warn(logger).Log("msg", "failed to write state", "repository", repoName, "err", err)
+		}
+
+		// Every release gets a summary of the senders it was delivered to.
+		var succeeded, failed []string
+		for _, result := range results {
+			if result.Err != nil {
+				failed = append(failed, result.Sender)
+			} else {
+				succeeded = append(succeeded, result.Sender)
+			}
+		}
+
+		if len(succeeded)+len(failed) > 0 {
+			level.Info(logger).Log(
+				"msg", "delivered release",
+				"repository", repoName,
+				"release", repository.Release.Key(),
+				"channel", fileConfig.ChannelFor(repository.Release).Name,
+				"succeeded", strings.Join(succeeded, ","),
+				"failed", strings.Join(failed, ","),
+				"retried", retried,
+			)
+		}
+	})
+
+	// Grouped releases are sent to Slack in one message per owner at the end of every cycle,
+	// the other senders still get them one by one.
+	var groups ReleaseGroups
+	sendGroups := func() {
+		for _, group := range groups.Take() {
+			owner := group[0].Owner
+			if c.DryRun {
+				level.Info(logger).Log("msg", "dry run, not sending releases", "sender", "slack", "owner", owner, "releases", len(group))
+				continue
+			}
+
+			span := tracer.Start(nil, "send")
+			span.SetAttribute("sender", "slack")
+			span.SetAttribute("owner", owner)
+			span.SetAttribute("releases", len(group))
+			err := slack.SendGroup(owner, group)
+			span.End(err)
+			recordDelivery("slack", err)
+
+			if err != nil {
+				atomic.AddInt32(&sendFailures, 1)
+				level.Warn(logger).Log(
+					"msg", "failed to send releases",
+					"sender", "slack",
+					"owner", owner,
+					"err", err,
+				)
+				reporter.Repeated("slack "+owner, err, map[string]string{
+					"sender": "slack",
+					"owner":  owner,
+				})
+				ops.Repeated("slack", "slack "+owner, err)
+				continue
+			}
+			reporter.Reset("slack " + owner)
+			ops.Reset("slack " + owner)
+		}
+	}
+
+	mirrors := &MirrorDedup{store: store, groups: fileConfig.Mirrors}
+
+	// With a window the groups are sent GROUP_WINDOW after their first release instead of at the end of the cycle,
+	// so releases found in several cycles end up in the same message.
+	var windowDue <-chan time.Time
+	group := func(repository Repository) {
+		if slackEnabled && c.GroupBy != "" && !bypassesWindow(repository) && !(c.DigestOnly && containsFold(c.DigestSenders, "slack")) && sendsTo(repository.Owner+"/"+repository.Name, repository.Release, "slack") {
+			if c.GroupWindow > 0 && groups.Empty() {
+				windowDue = time.After(c.GroupWindow)
+			}
+			groups.Add(repository)
+		}
+	}
+	send := func(repository Repository) {
+		dispatcher.Dispatch(repository)
+		group(repository)
+	}
+	// Dispatched releases are kept in the history to send them again with --replay,
+	// and until the scheduled digest lists them.
+	history := &History{store: store}
+	digest := &ScheduledDigest{store: store}
+	dispatch := func(repository Repository) {
+		if err := history.Record(repository); err != nil {
+			level.Warn(logger).Log("msg", "failed to record release in the history", "repository", repository.Owner+"/"+repository.Name, "err", err)
+		}
+		if digestEnabled {
+			if err := digest.Add(repository); err != nil {
+				level.Warn(logger).Log("msg", "failed to collect release for the digest", "repository", repository.Owner+"/"+repository.Name, "err", err)
+			}
+		}
+		send(repository)
+	}
+
+	// Replaying sends the releases recorded in the history again, e.g. after fixing a broken sender,
+	// and exits without checking for new releases. It goes to the senders right away, not through the
+	// dispatcher and its delivery log, and leaves the state as it is, so an old release replayed to
+	// GitLab doesn't become the repository's latest issue or close the newer one.
+	if c.Replay > 0 {
+		replayed, err := history.Recent(c.Replay)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to read the history", "err", err)
+			exit(exitError)
+		}
+		store.ReadOnly()
+		gitlab.Untracked = true
+		for _, repository := range replayed {
+			level.Debug(logger).Log("msg", "replaying release", "repository", repository.Owner+"/"+repository.Name, "version", repository.Release.Name)
+			sendAll(repository, "", false, nil)
+			group(repository)
+		}
+		sendGroups()
+		level.Info(logger).Log("msg", "replay done", "replayed", len(replayed), "deliveries", deliveries.String())
+		if atomic.LoadInt32(&sendFailures) > 0 {
+			level.Error(logger).Log("msg", "failed to send notifications", "failures", atomic.LoadInt32(&sendFailures))
+			exit(exitError)
+		}
+		exit(0)
+	}
+
+	// Notifications can be paused, e.g. for maintenance, through the server's endpoints.
+	pause := NewPause(c.PauseMode, store)
+	if c.Listen != "" {
+		server := &Server{
+			logger:        logger,
+			pause:         pause,
+			logLevel:      logLevel,
+			testToken:     c.TestToken,
+			webhookSecret: c.GithubWebhookSecret,
+			receive:       checker.Receive,
+			test: func(sender string) []SenderResult {
+				if sender != "" {
+					return sendAll(testRepository(), sender, true, nil)
+				}
+				var results []SenderResult
+				for _, sender := range testSenders {
+					results = append(results, sendAll(testRepository(), sender, true, nil)...)
+				}
+				return results
+			},
+		}
+		if c.FeedEnabled {
+			server.history = history
+			server.feedLimit = c.FeedLimit
+			server.feedTitle = c.FeedTitle
+			server.messages = messages
+		}
+		if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+			level.Error(logger).Log("msg", "TLS needs both TLS_CERT_FILE and TLS_KEY_FILE")
+			exit(exitConfig)
+		}
+		var certs *CertReloader
+		if c.TLSCertFile != "" {
+			if certs, err = NewCertReloader(c.TLSCertFile, c.TLSKeyFile); err != nil {
+				level.Error(logger).Log("msg", "failed to load TLS certificate", "err", err)
+				exit(exitConfig)
+			}
+			// Rotated certificates are picked up on SIGHUP.
+			hangups := make(chan os.Signal, 1)
+			signal.Notify(hangups, syscall.SIGHUP)
+			go func() {
+				for range hangups {
+					if err := certs.Reload(); err != nil {
+						level.Error(logger).Log("msg", "failed to reload TLS certificate, keeping the current one", "err", err)
+						continue
+					}
+					level.Info(logger).Log("msg", "reloaded TLS certificate", "cert", c.TLSCertFile)
+				}
+			}()
+		}
+		go func() {
+			level.Info(logger).Log("msg", "listening", "addr", c.Listen, "tls", certs != nil)
+			serve := func() error { return server.ListenAndServe(c.Listen) }
+			if certs != nil {
+				serve = func() error { return server.ListenAndServeTLS(c.Listen, certs) }
+			}
+			if err := serve(); err != nil {
+				level.Error(logger).Log("msg", "failed to serve", "addr", c.Listen, "err", err)
+				exit(exitConfig)
+			}
+		}()
+	}
+
+	holdPaused := func(repository Repository) bool {
+		held, err := pause.Hold(repository)
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to store release held back while paused", "repository", repository.Owner+"/"+repository.Name, "err", err)
+		}
+		return held
+	}
+
+	// Repositories with a cooldown are checked for held back releases that are due regularly.
+	// Releases held back by an earlier run may be due right away.
+	cooldown := &Cooldown{store: store, interval: fileConfig.CooldownFor}
+	var cooldownChecks <-chan time.Time
+	for _, repository := range fileConfig.Repositories {
+		if repository.MinIntervalBetweenNotifications > 0 {
+			cooldownChecks = time.Tick(cooldownCheckInterval)
+			break
+		}
+	}
+	var notified int
+	notifyDue := func() {
+		due, err := cooldown.Due(time.Now())
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to check for releases held back during a cooldown", "err", err)
+		}
+		for _, repository := range due {
+			level.Debug(logger).Log("msg", "notifying about release held back during the repository's cooldown", "version", repository.Release.Name)
+			notified++
+			if holdPaused(repository) {
+				continue
+			}
+			dispatch(repository)
+		}
+	}
+	notifyDue()
+
+	// Deliveries that failed for some senders, also before a restart, are retried regularly.
+	deliveryRetries := time.Tick(deliveryRetryInterval)
+	retryDeliveries := func() {
+		if pause.Status().Paused {
+			return
+		}
+		pending, err := deliveryLog.Pending()
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to load releases to retry delivering", "err", err)
+		}
+		for _, repository := range pending {
+			level.Debug(logger).Log("msg", "retrying to deliver release", "repository", repository.Owner+"/"+repository.Name, "version", repository.Release.Name)
+			dispatcher.Dispatch(repository)
+		}
+	}
+	retryDeliveries()
+
+	// The digest of the releases collected since the last one is sent at the times of its own schedule,
+	// regardless of the checks' interval.
+	var digestTimer *time.Timer
+	var digestDue <-chan time.Time
+	if digestEnabled {
+		digestTimer = time.NewTimer(time.Until(c.DigestSchedule.Next(time.Now())))
+		digestDue = digestTimer.C
+	}
+	// A digest due while paused is sent on resume.
+	var digestHeld bool
+	sendDigest := func() {
+		if pause.Status().Paused {
+			level.Debug(logger).Log("msg", "not sending digest while paused")
+			digestHeld = true
+			return
+		}
+		digestHeld = false
+		collected, err := digest.Collected()
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to load the releases collected for the digest", "err", err)
+			return
+		}
+		if len(collected) == 0 {
+			level.Debug(logger).Log("msg", "no releases for the digest")
+			return
+		}
+
+		if c.DryRun {
+			level.Info(logger).Log("msg", "dry run, not sending digest", "senders", strings.Join(c.DigestSenders, ","), "releases", len(collected))
+			return
+		}
+
+		// The releases are kept for the next digest unless all senders got this one.
+		failed := false
+		for _, sender := range c.DigestSenders {
+			var err error
+			switch strings.ToLower(sender) {
+			case "slack":
+				if !slackEnabled {
+					continue
+				}
+				err = slack.SendDigest(collected)
+			case "markdown":
+				if !c.MarkdownEnabled || c.MarkdownPath == "" {
+					continue
+				}
+				err = markdown.SendDigest(collected, time.Now())
+			case "email":
+				if !c.EmailEnabled || c.SMTPHost == "" {
+					continue
+				}
+				err = email.SendDigest(collected)
+			}
+			recordDelivery(sender, err)
+			if err != nil {
+				failed = true
+				atomic.AddInt32(&sendFailures, 1)
+				level.Warn(logger).Log("msg", "failed to send the digest", "sender", sender, "releases", len(collected), "err", err)
+			}
+		}
+		if failed {
+			return
+		}
+		if err := digest.Clear(collected); err != nil {
+			level.Warn(logger).Log("msg", "failed to clear the releases of the digest", "err", err)
+		}
+		if err := store.Flush(); err != nil {
+			level.Warn(logger).Log("msg", "failed to write state", "err", err)
+		}
+		level.Info(logger).Log("msg", "sent digest", "releases", len(collected))
+	}
+
+	sendNotice := func(notice Notice) {
+		if c.DryRun {
+			level.Info(logger).Log("msg", "dry run, not sending notice", "sender", "slack", "repository", notice.Repository, "change", notice.Kind)
+			return
+		}
+		err := slack.SendNotice(notice)
+		recordDelivery("slack", err)
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to send notice", "sender", "slack", "repository", notice.Repository, "change", notice.Kind, "err", err)
+		}
+	}
+
+	// Releases and notices held back while paused are notified on resume. Ones held back before a restart
+	// are notified right away, as notifications aren't paused anymore after it.
+	notifyHeld := func() {
+		held, heldNotices, err := pause.Take()
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to load releases held back while paused", "err", err)
+		}
+		if len(held)+len(heldNotices) == 0 {
+			return
+		}
+		level.Info(logger).Log("msg", "notifying about releases held back while paused", "releases", len(held), "notices", len(heldNotices))
+		for _, repository := range held {
+			dispatch(repository)
+		}
+		for _, notice := range heldNotices {
+			sendNotice(notice)
+		}
+	}
+	notifyHeld()
+
+	// On SIGHUP the config file is loaded again between two checks, so the watched repositories, their settings,
+	// filters and routing change without a restart. The checker asks for it once it finished its check
+	// and the releases found are delivered before the config changes under them.
+	reloads := make(chan configReload)
+	reloadConfig := func(current []string) []string {
+		reloaded, err := LoadFileConfig(c.ConfigFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to reload config file, keeping the current one", "err", err)
+			return current
+		}
+		dispatcher.Drain()
+		*fileConfig = *reloaded
+
+		repositories := append([]string(nil), flagRepositories...)
+		for _, repoName := range fileConfig.RepositoryNames() {
+			if !containsFold(repositories, repoName) {
+				repositories = append(repositories, repoName)
+			}
+		}
+		for _, org := range c.Orgs {
+			repositories = append(repositories, orgPrefix+org)
+		}
+		for _, user := range c.Users {
+			repositories = append(repositories, userPrefix+user)
+		}
+		watched := repositories[:0]
+		for _, entry := range repositories {
+			if repoName, sourced, err := watchSource(entry); err != nil {
+				level.Warn(logger).Log("msg", "not watching invalid repository", "err", err)
+				continue
+			} else if sourced {
+				watched = append(watched, repoName)
+				continue
+			}
+			host, repoName := splitHost(entry)
+			if host == "" {
+				repoName = entry
+			} else if client, ok := hostClients[strings.ToLower(host)]; ok {
+				clients[repoName] = client
+			} else {
+				level.Warn(logger).Log("msg", "not watching repository of a host not watched before, restart to watch it", "repository", entry)
+				continue
+			}
+			if token := fileConfig.TokenFor(repoName); token != "" && host == "" {
+				if _, ok := clientsByToken[token]; !ok {
+					clientsByToken[token] = newGithubClient(graphqlURL, &oauth2.Token{AccessToken: token}, secondaryRateLimit, githubHeaders)
+				}
+				clients[repoName] = clientsByToken[token]
+			}
+			watched = append(watched, repoName)
+		}
+
+		// Settings taken from the config file on startup are taken again.
+		checker.discussions = fileConfig.Discussions()
+		checker.releaseLines = fileConfig.ReleaseLines()
+		slack.Mentions = fileConfig.SlackMentions
+		mirrors.groups = fileConfig.Mirrors
+		for _, repository := range fileConfig.Repositories {
+			if repository.MinIntervalBetweenNotifications > 0 && cooldownChecks == nil {
+				cooldownChecks = time.Tick(cooldownCheckInterval)
+			}
+		}
+		level.Info(logger).Log("msg", "reloaded config file", "config", c.ConfigFile, "repositories", len(watched))
+		return watched
+	}
+	if c.ConfigFile != "" && !c.Once {
+		hangups := make(chan os.Signal, 1)
+		signal.Notify(hangups, syscall.SIGHUP)
+		checker.hangups = hangups
+		checker.reload = func(current []string) []string {
+			reload := configReload{current: current, repositories: make(chan []string)}
+			reloads <- reload
+			return <-reload.repositories
+		}
+	}
+
+	// TODO: releases := make(chan Repository, len(c.Repositories))
+	releases := make(chan Repository)
+	var checkErr error
+	atomic.StoreInt32(&graceful, 1)
+	go func() {
+		if c.Once {
+			_, checkErr = checker.Check(ctx, c.Repositories, releases)
+		} else {
+			checker.Run(ctx, c.Interval, c.Repositories, releases)
+		}
+		checker.Wait()
+		close(releases)
+	}()
+
+	level.Info(logger).Log("msg", "waiting for new releases")
+loop:
+	for {
+		var repository Repository
+		select {
+		case reload := <-reloads:
+			reload.repositories <- reloadConfig(reload.current)
+			continue
+		case <-cycles:
+			if c.GroupWindow <= 0 {
+				sendGroups()
+			}
 			continue
+		case <-windowDue:
+			windowDue = nil
+			sendGroups()
+			continue
+		case <-cooldownChecks:
+			notifyDue()
+			continue
+		case <-deliveryRetries:
+			retryDeliveries()
+			continue
+		case <-digestDue:
+			sendDigest()
+			digestTimer.Reset(time.Until(c.DigestSchedule.Next(time.Now())))
+			continue
+		case notice := <-notices:
+			if !slackEnabled || !fileConfig.SendsTo(notice.Repository, "slack") {
+				continue
+			}
+			held, err := pause.HoldNotice(notice)
+			if err != nil {
+				level.Warn(logger).Log("msg", "failed to store notice held back while paused", "repository", notice.Repository, "change", notice.Kind, "err", err)
+			}
+			if held {
+				level.Debug(logger).Log("msg", "not sending notice while paused", "repository", notice.Repository, "change", notice.Kind, "pause_mode", c.PauseMode)
+				continue
+			}
+			sendNotice(notice)
+			continue
+		case <-pause.Resumed():
+			notifyHeld()
+			if digestHeld {
+				sendDigest()
+			}
+			continue
+		case next, ok := <-releases:
+			if !ok {
+				break loop
+			}
+			repository = next
+		}
+
+		if fileConfig.IgnoreNonstableFor(repository.Owner+"/"+repository.Name, c.IgnoreNonstable) && repository.Release.IsNonstable() {
+			level.Debug(logger).Log("msg", "not notifying about non-stable version", "version", repository.Release.Name)
+			continue
+		}
+		if len(c.AuthorInclude) > 0 && !repository.Release.IsAuthoredBy(c.AuthorInclude...) {
+			level.Debug(logger).Log("msg", "not notifying about release by author not included", "version", repository.Release.Name, "author", repository.Release.Author)
+			continue
+		}
+		if repository.Release.IsAuthoredBy(c.AuthorExclude...) {
+			level.Debug(logger).Log("msg", "not notifying about release by excluded author", "version", repository.Release.Name, "author", repository.Release.Author)
+			continue
+		}
+		if repository.Release.HasMarker(c.SkipMarker) {
+			level.Debug(logger).Log("msg", "not notifying about release with skip marker", "version", repository.Release.Name, "marker", c.SkipMarker)
+			continue
+		}
+		if pattern := fileConfig.TagPatternFor(repository.Owner + "/" + repository.Name); pattern != nil && !pattern.MatchString(repository.Release.TagName) {
+			level.Debug(logger).Log("msg", "not notifying about release whose tag doesn't match the pattern", "version", repository.Release.Name, "tag", repository.Release.TagName, "pattern", pattern)
+			continue
+		}
+		if reason := fileConfig.VersionFilterFor(repository.Owner + "/" + repository.Name).Skips(repository); reason != "" {
+			level.Debug(logger).Log("msg", "not notifying about release skipped by the repository's version filter", "version", repository.Release.Name, "tag", repository.Release.TagName, "reason", reason)
+			continue
+		}
+		if pattern, ok := fileConfig.AssetPatternFor(repository.Owner + "/" + repository.Name); ok && !repository.Release.HasAsset(pattern) {
+			level.Debug(logger).Log("msg", "not notifying about release without matching asset", "version", repository.Release.Name, "pattern", pattern)
+			continue
+		}
+		if overrides := repository.Overrides; overrides != nil {
+			if overrides.IgnorePrereleases && (repository.Release.IsPrerelease || repository.Release.IsNonstable()) {
+				level.Debug(logger).Log("msg", "not notifying about pre-release ignored by the repository", "version", repository.Release.Name)
+				continue
+			}
+			if repository.Release.HasMarker(overrides.SkipMarker) {
+				level.Debug(logger).Log("msg", "not notifying about release with the repository's skip marker", "version", repository.Release.Name, "marker", overrides.SkipMarker)
+				continue
+			}
+		}
+		if group, first, err := mirrors.Duplicate(repository); err != nil {
+			level.Warn(logger).Log("msg", "failed to check for release of a mirror", "repository", repository.Owner+"/"+repository.Name, "err", err)
+		} else if first != "" {
+			level.Debug(logger).Log("msg", "not notifying about release already notified for a mirror", "version", repository.Release.Name, "mirrors", group, "first", first)
+			continue
+		}
+		repository.Release = repository.Release.Normalized(c.MaxBodySize, messages)
+		if held, err := cooldown.Hold(repository, time.Now()); err != nil {
+			level.Warn(logger).Log("msg", "failed to check the repository's cooldown", "repository", repository.Owner+"/"+repository.Name, "err", err)
+		} else if held {
+			level.Debug(logger).Log("msg", "not notifying about release during the repository's cooldown", "version", repository.Release.Name)
+			continue
+		}
+		notified++
+		if holdPaused(repository) {
+			level.Debug(logger).Log("msg", "not notifying about release while paused", "version", repository.Release.Name, "pause_mode", c.PauseMode)
+			continue
+		}
+		dispatch(repository)
+	}
+	sendGroups()
+	dispatcher.Close()
+	desktop.Close()
+	if err := tracer.Flush(); err != nil {
+		level.Warn(logger).Log("msg", "failed to export traces", "err", err)
+	}
+	if !c.Once {
+		level.Info(logger).Log("msg", "stopped", "deliveries", deliveries.String())
+		exit(exitNoNewReleases)
+	}
+
+	// Only reached with --once, after the single check is done.
+	level.Info(logger).Log("msg", "check done", "notified", notified, "deliveries", deliveries.String(), "dry_run", c.DryRun)
+	switch {
+	case errors.Is(checkErr, errTokenRejected):
+		level.Error(logger).Log("msg", "check failed", "err", checkErr)
+		exit(exitAuth)
+	case errors.Is(checkErr, errGitHubUnavailable):
+		level.Error(logger).Log("msg", "check failed", "err", checkErr)
+		exit(exitUnavailable)
+	case checkErr != nil:
+		level.Error(logger).Log("msg", "check failed", "err", checkErr)
+		exit(exitError)
+	case atomic.LoadInt32(&sendFailures) > 0:
+		level.Error(logger).Log("msg", "failed to send notifications", "failures", atomic.LoadInt32(&sendFailures))
+		exit(exitError)
+	case notified > 0:
+		exit(exitNewReleases)
+	default:
+		exit(exitNoNewReleases)
+	}
+}
+
+// containsFold returns true if the list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
 		}
 	}
+	return false
 }
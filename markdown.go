@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	markdownHeader = "# Upstream releases\n"
+	// markdownNotesLength is how many bytes of the release notes are kept in an entry.
+	markdownNotesLength = 500
+)
+
+// MarkdownFileSender appends an entry for every release to a Markdown file,
+// e.g. a changelog of upstream releases kept in version control.
+type MarkdownFileSender struct {
+	Path string
+	// Fields of the release to include, its link and notes by default.
+	Fields   NotificationFields
+	Messages Messages
+	// Template, if set, renders the entries instead, see MessageData.
+	Template *template.Template
+
+	mu sync.Mutex
+}
+
+// Send appends an entry for the repository's release, creating the file with a header if needed.
+// The file is rewritten atomically, so it is never left half written.
+func (s *MarkdownFileSender) Send(repository Repository) error {
+	if s.Template != nil {
+		entry, err := renderMessage(s.Template, repository, s.Messages)
+		if err != nil {
+			return err
+		}
+		return s.append("\n" + entry + "\n")
+	}
+	release := repository.Release
+	fields := s.Fields.Or(FieldURL, FieldBody)
+
+	var entry strings.Builder
+	fmt.Fprintf(&entry, "\n## %s %s/%s %s\n\n",
+		release.PublishedAt.UTC().Format("2006-01-02"),
+		repository.Owner,
+		repository.Name,
+		release.Name,
+	)
+	var lines []string
+	if fields.Has(FieldURL) {
+		lines = append(lines, fmt.Sprintf("[%s](%s)", release.Key(), release.URL.String()))
+	}
+	for _, detail := range fields.Details(release, s.Messages) {
+		lines = append(lines, "* "+detail)
+	}
+	if len(lines) > 0 {
+		fmt.Fprintf(&entry, "%s\n", strings.Join(lines, "\n"))
+	}
+	if notes := markdownNotes(release.Description); fields.Has(FieldBody) && notes != "" {
+		fmt.Fprintf(&entry, "\n%s\n", notes)
+	}
+
+	return s.append(entry.String())
+}
+
+// SendDigest appends an entry listing the releases collected for the scheduled digest, dated at.
+func (s *MarkdownFileSender) SendDigest(repositories []Repository, at time.Time) error {
+	var entry strings.Builder
+	fmt.Fprintf(&entry, "\n## %s %s\n\n", at.UTC().Format("2006-01-02"), s.Messages.Digest)
+	for _, repository := range repositories {
+		fmt.Fprintf(&entry, "* %s/%s [%s](%s)\n",
+			repository.Owner,
+			repository.Name,
+			repository.Release.Name,
+			repository.Release.URL.String(),
+		)
+	}
+	return s.append(entry.String())
+}
+
+// append adds the entry to the end of the file, creating it with a header if needed.
+func (s *MarkdownFileSender) append(entry string) error {
+	// Releases of different repositories are delivered in parallel,
+	// but entries must be appended one after the other.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		data, err = []byte(markdownHeader), nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data = append(data, entry...)
+	if err := writeFileAtomic(s.Path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write release to %s: %v", s.Path, err)
+	}
+	return nil
+}
+
+// markdownNotes returns the beginning of the release notes, quoted so
+// their headings don't mix with the ones of the file.
+func markdownNotes(notes string) string {
+	notes = strings.TrimSpace(notes)
+	if notes == "" {
+		return ""
+	}
+	if len(notes) > markdownNotesLength {
+		cut := markdownNotesLength
+		for cut > 0 && !strings.HasPrefix(notes[cut:], " ") && !strings.HasPrefix(notes[cut:], "\n") {
+			cut--
+		}
+		if cut == 0 {
+			cut = markdownNotesLength
+			for cut > 0 && !utf8.RuneStart(notes[cut]) {
+				cut--
+			}
+		}
+		notes = strings.TrimSpace(notes[:cut]) + " …"
+	}
+
+	lines := strings.Split(notes, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Messages are the fixed parts of notifications, the release's own content is never translated.
+type Messages struct {
+	// Released follows a release's name, like "v1.2.0 released".
+	Released string
+	// RenamedFrom follows the name of a renamed release, with its previous name as argument.
+	RenamedFrom string
+	// PromotedFrom follows the name of a stable release whose pre-release was seen before,
+	// with the pre-release's tag as argument.
+	PromotedFrom string
+	// OwnerReleased heads the releases grouped by owner, with the owner as argument.
+	OwnerReleased string
+	// Digest heads the releases of the scheduled digest.
+	Digest string
+	// Archived and RenamedTo tell about changes of a watched repository, with its name
+	// and for RenamedTo its new name as arguments.
+	Archived, RenamedTo string
+	// AndMore ends a group cut off after DIGEST_LIMIT releases, with the number left out as argument.
+	AndMore string
+	// Labels of the release's details.
+	Tag, Checks, Author, Asset, Published, Downloads string
+	// Truncated follows cut release notes, with the release's URL as argument.
+	Truncated string
+	// Superseded is noted on the GitLab issue of the previous release,
+	// with the new issue's number and the release's name as arguments.
+	Superseded string
+	// Changes links to the changes since the previous release, with its tag as argument.
+	Changes string
+	// Commit and Commits count the commits since the previous release, Commits with the number as argument.
+	Commit, Commits string
+}
+
+// ChangesSince returns the text of the link to the changes since the repository's previous release,
+// like "Changes since v1.1.0 (12 commits)".
+func (m Messages) ChangesSince(repository Repository) string {
+	var tag string
+	if repository.Previous != nil {
+		tag = repository.Previous.TagName
+	}
+	text := fmt.Sprintf(m.Changes, tag)
+	switch {
+	case repository.Commits == 1:
+		text += " (" + m.Commit + ")"
+	case repository.Commits > 1:
+		text += " (" + fmt.Sprintf(m.Commits, repository.Commits) + ")"
+	}
+	return text
+}
+
+// Action returns what happened to the repository's release, following its name.
+func (m Messages) Action(repository Repository) string {
+	switch {
+	case repository.Renamed && repository.Previous != nil:
+		return fmt.Sprintf(m.RenamedFrom, repository.Previous.Name)
+	case repository.PromotedFrom != "":
+		return fmt.Sprintf(m.PromotedFrom, repository.PromotedFrom)
+	}
+	return m.Released
+}
+
+// DefaultLocale is used unless LOCALE picks another one.
+const DefaultLocale = "en"
+
+// locales are the message catalogs by language.
+var locales = map[string]Messages{
+	"en": {
+		Released:      "released",
+		RenamedFrom:   "renamed from %q",
+		PromotedFrom:  "promoted to stable from %s",
+		OwnerReleased: "*%s* released:",
+		Digest:        "Released since the last digest",
+		Archived:      "%s was archived, it won't get new releases",
+		RenamedTo:     "%s was renamed to %s and is watched under its new name",
+		AndMore:       "… and %d more",
+		Tag:           "Tag",
+		Checks:        "Checks",
+		Author:        "Author",
+		Asset:         "Asset",
+		Published:     "Published",
+		Downloads:     "Downloads",
+		Truncated:     "… truncated, see the full release notes at %s",
+		Superseded:    "Superseded by #%d (%s).",
+		Changes:       "Changes since %s",
+		Commit:        "1 commit",
+		Commits:       "%d commits",
+	},
+	"de": {
+		Released:      "veröffentlicht",
+		RenamedFrom:   "umbenannt von %q",
+		PromotedFrom:  "als stabil freigegeben nach %s",
+		OwnerReleased: "*%s* hat veröffentlicht:",
+		Digest:        "Veröffentlicht seit der letzten Zusammenfassung",
+		Archived:      "%s wurde archiviert und bekommt keine neuen Releases mehr",
+		RenamedTo:     "%s wurde in %s umbenannt und wird unter dem neuen Namen beobachtet",
+		AndMore:       "… und %d weitere",
+		Tag:           "Tag",
+		Checks:        "Checks",
+		Author:        "Autor",
+		Asset:         "Datei",
+		Published:     "Veröffentlicht",
+		Downloads:     "Downloads",
+		Truncated:     "… gekürzt, die vollständigen Release Notes stehen unter %s",
+		Superseded:    "Abgelöst durch #%d (%s).",
+		Changes:       "Änderungen seit %s",
+		Commit:        "1 Commit",
+		Commits:       "%d Commits",
+	},
+	"es": {
+		Released:      "publicado",
+		RenamedFrom:   "renombrado desde %q",
+		PromotedFrom:  "promovido a estable desde %s",
+		OwnerReleased: "*%s* publicó:",
+		Digest:        "Publicado desde el último resumen",
+		Archived:      "%s fue archivado, no tendrá nuevas versiones",
+		RenamedTo:     "%s fue renombrado a %s y se sigue con su nuevo nombre",
+		AndMore:       "… y %d más",
+		Tag:           "Etiqueta",
+		Checks:        "Comprobaciones",
+		Author:        "Autor",
+		Asset:         "Archivo",
+		Published:     "Publicado",
+		Downloads:     "Descargas",
+		Truncated:     "… recortado, las notas completas están en %s",
+		Superseded:    "Reemplazado por #%d (%s).",
+		Changes:       "Cambios desde %s",
+		Commit:        "1 commit",
+		Commits:       "%d commits",
+	},
+	"fr": {
+		Released:      "publié",
+		RenamedFrom:   "renommé depuis %q",
+		PromotedFrom:  "promu en version stable depuis %s",
+		OwnerReleased: "*%s* a publié :",
+		Digest:        "Publié depuis le dernier résumé",
+		Archived:      "%s a été archivé, il n'aura plus de nouvelles versions",
+		RenamedTo:     "%s a été renommé en %s et est suivi sous son nouveau nom",
+		AndMore:       "… et %d de plus",
+		Tag:           "Tag",
+		Checks:        "Vérifications",
+		Author:        "Auteur",
+		Asset:         "Fichier",
+		Published:     "Publié",
+		Downloads:     "Téléchargements",
+		Truncated:     "… tronqué, les notes complètes sont sur %s",
+		Superseded:    "Remplacé par #%d (%s).",
+		Changes:       "Changements depuis %s",
+		Commit:        "1 commit",
+		Commits:       "%d commits",
+	},
+}
+
+// MessagesFor returns the messages of a locale like de, de-AT or de_DE.UTF-8,
+// which only picks the language.
+func MessagesFor(locale string) (Messages, error) {
+	language := strings.ToLower(locale)
+	if i := strings.IndexAny(language, "-_."); i >= 0 {
+		language = language[:i]
+	}
+	messages, ok := locales[language]
+	if !ok {
+		known := make([]string, 0, len(locales))
+		for language := range locales {
+			known = append(known, language)
+		}
+		sort.Strings(known)
+		return Messages{}, fmt.Errorf("unknown locale %q, must be one of %s", locale, strings.Join(known, ", "))
+	}
+	return messages, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	githubql "github.com/shurcooL/githubql"
+)
+
+// repositoryFields are the details of a repository that hardly ever change,
+// queried along with its releases until they are cached.
+type repositoryFields struct {
+	ID               githubql.ID
+	Name             githubql.String
+	Description      githubql.String
+	URL              githubql.URI
+	DefaultBranchRef *struct {
+		Name githubql.String
+	}
+}
+
+// RepositoryMetadata is what is cached of a repository between checks.
+type RepositoryMetadata struct {
+	ID            string
+	Name          string
+	Description   string
+	URL           url.URL
+	DefaultBranch string
+}
+
+func newRepositoryMetadata(fields repositoryFields) (RepositoryMetadata, error) {
+	repositoryID, ok := fields.ID.(string)
+	if !ok {
+		return RepositoryMetadata{}, fmt.Errorf("can't convert repository id to string: %v", fields.ID)
+	}
+
+	metadata := RepositoryMetadata{
+		ID:          repositoryID,
+		Name:        string(fields.Name),
+		Description: string(fields.Description),
+		URL:         *fields.URL.URL,
+	}
+	if fields.DefaultBranchRef != nil {
+		metadata.DefaultBranch = string(fields.DefaultBranchRef.Name)
+	}
+	return metadata, nil
+}
+
+// MetadataCache keeps the repositories' metadata for a while so checks only query their releases.
+// It is safe for concurrent use. A nil cache or one without TTL caches nothing.
+type MetadataCache struct {
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]cachedMetadata
+}
+
+type cachedMetadata struct {
+	metadata RepositoryMetadata
+	fetched  time.Time
+}
+
+// NewMetadataCache returns a cache keeping metadata for ttl.
+func NewMetadataCache(ttl time.Duration) *MetadataCache {
+	return &MetadataCache{ttl: ttl, entries: make(map[string]cachedMetadata)}
+}
+
+// Get returns the metadata of the repository given as owner/name, if it is cached and not expired.
+func (m *MetadataCache) Get(repoName string) (RepositoryMetadata, bool) {
+	if m == nil || m.ttl <= 0 {
+		return RepositoryMetadata{}, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cached, ok := m.entries[strings.ToLower(repoName)]
+	if !ok || time.Since(cached.fetched) >= m.ttl {
+		return RepositoryMetadata{}, false
+	}
+	return cached.metadata, true
+}
+
+// Put caches the metadata of the repository given as owner/name.
+func (m *MetadataCache) Put(repoName string, metadata RepositoryMetadata) {
+	if m == nil || m.ttl <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[strings.ToLower(repoName)] = cachedMetadata{metadata: metadata, fetched: time.Now()}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// deliveries counts deliveries by sender, result and error class like slack.failure.http_5xx.
+// It is published with expvar along with the other counters.
+var deliveries = expvar.NewMap("deliveries")
+
+// Counters of the checks, also exported for Prometheus on /metrics.
+var (
+	checksPerformed  = expvar.NewInt("checks")
+	releasesDetected = expvar.NewInt("releases_detected")
+	// githubErrors counts failed queries by error class, see errorClass, and secondary_rate_limit or token_rejected.
+	githubErrors = expvar.NewMap("github_errors")
+	// rateLimitRemaining is the quota left of GitHub's rate limit as of the last query.
+	rateLimitRemaining = expvar.NewInt("github_rate_limit_remaining")
+	// rateLimitResetAt is when the quota is reset, in seconds since the epoch.
+	rateLimitResetAt = expvar.NewInt("github_rate_limit_reset_at")
+)
+
+// metricsPrefix is the prefix of the names of the metrics on /metrics.
+const metricsPrefix = "github_releases_notifier_"
+
+// WritePrometheus writes the counters in Prometheus' text format.
+func WritePrometheus(w io.Writer) error {
+	var b strings.Builder
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, kind)
+	}
+
+	metric("checks_total", "counter", "Checks of all repositories performed.")
+	fmt.Fprintf(&b, "%schecks_total %d\n", metricsPrefix, checksPerformed.Value())
+	metric("releases_detected_total", "counter", "New releases detected by the checks.")
+	fmt.Fprintf(&b, "%sreleases_detected_total %d\n", metricsPrefix, releasesDetected.Value())
+
+	metric("notifications_total", "counter", "Notifications by sender, result and error class of failures.")
+	deliveries.Do(func(kv expvar.KeyValue) {
+		// Keys are like slack.success or slack.failure.http_5xx.
+		parts := strings.SplitN(kv.Key, ".", 3)
+		labels := fmt.Sprintf("sender=%q,result=%q", parts[0], parts[1])
+		if len(parts) == 3 {
+			labels += fmt.Sprintf(",class=%q", parts[2])
+		}
+		fmt.Fprintf(&b, "%snotifications_total{%s} %s\n", metricsPrefix, labels, kv.Value)
+	})
+
+	metric("github_errors_total", "counter", "Failed queries to GitHub by error class.")
+	githubErrors.Do(func(kv expvar.KeyValue) {
+		fmt.Fprintf(&b, "%sgithub_errors_total{class=%q} %s\n", metricsPrefix, kv.Key, kv.Value)
+	})
+	metric("github_rate_limit_remaining", "gauge", "Quota left of GitHub's rate limit as of the last query.")
+	fmt.Fprintf(&b, "%sgithub_rate_limit_remaining %d\n", metricsPrefix, rateLimitRemaining.Value())
+	metric("github_rate_limit_reset_timestamp_seconds", "gauge", "When the quota of GitHub's rate limit is reset.")
+	fmt.Fprintf(&b, "%sgithub_rate_limit_reset_timestamp_seconds %d\n", metricsPrefix, rateLimitResetAt.Value())
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// statusError is returned by senders for unexpected HTTP responses.
+type statusError struct {
+	Code    int
+	Message string
+}
+
+func (e *statusError) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the response's HTTP status code.
+func (e *statusError) StatusCode() int {
+	return e.Code
+}
+
+// recordDelivery counts a delivery of the sender, with err being nil for successful ones.
+func recordDelivery(sender string, err error) {
+	if err == nil {
+		deliveries.Add(sender+".success", 1)
+		return
+	}
+	deliveries.Add(fmt.Sprintf("%s.failure.%s", sender, errorClass(err)), 1)
+}
+
+// errorClass returns a coarse class of the error for counting failures:
+// timeout, network, http_4xx, http_5xx or other.
+func errorClass(err error) string {
+	if err == context.DeadlineExceeded {
+		return "timeout"
+	}
+	if status, ok := err.(interface{ StatusCode() int }); ok {
+		switch code := status.StatusCode(); {
+		case code >= 500:
+			return "http_5xx"
+		case code >= 400:
+			return "http_4xx"
+		}
+		return "other"
+	}
+	if netErr, ok := err.(net.Error); ok {
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	return "other"
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Parts of a release that can identify it within a mirror group.
+const (
+	IdentityTag  = "tag"
+	IdentityName = "name"
+	IdentityBody = "body"
+)
+
+var identityParts = []string{IdentityTag, IdentityName, IdentityBody}
+
+const mirrorKeyPrefix = "mirror/"
+
+// MirrorGroup are repositories publishing the same releases, like a project and its mirrors.
+// A release is only notified for the repository it was found in first.
+type MirrorGroup struct {
+	Name         string   `yaml:"name"`
+	Repositories []string `yaml:"repositories"`
+	// Identity are the parts identifying a release across the group, only its tag by default.
+	Identity []string `yaml:"identity"`
+}
+
+func (g MirrorGroup) validate() error {
+	if g.Name == "" {
+		return fmt.Errorf("mirror group without name")
+	}
+	if len(g.Repositories) < 2 {
+		return fmt.Errorf("mirror group %s needs at least two repositories", g.Name)
+	}
+	for _, part := range g.Identity {
+		if !containsFold(identityParts, part) {
+			return fmt.Errorf("mirror group %s: unknown identity %q, must be one of %s", g.Name, part, strings.Join(identityParts, ", "))
+		}
+	}
+	return nil
+}
+
+// identity returns what identifies the release in the group, hashed to keep it short.
+func (g MirrorGroup) identity(release Release) string {
+	identity := g.Identity
+	if len(identity) == 0 {
+		identity = []string{IdentityTag}
+	}
+
+	hash := sha256.New()
+	for _, part := range identityParts {
+		if !containsFold(identity, part) {
+			continue
+		}
+		switch part {
+		case IdentityTag:
+			hash.Write([]byte(release.Key()))
+		case IdentityName:
+			hash.Write([]byte(release.Name))
+		case IdentityBody:
+			hash.Write([]byte(strings.TrimSpace(release.Description)))
+		}
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// MirrorDedup notifies about a release of a mirror group only once.
+// The releases already notified are kept in the store, so mirrors catching up later,
+// even after a restart, don't notify again.
+type MirrorDedup struct {
+	store  Store
+	groups []MirrorGroup
+}
+
+// Duplicate returns the group and the repository the release was notified for first, if it was,
+// and otherwise remembers the release as notified for the repository.
+func (d *MirrorDedup) Duplicate(repository Repository) (group, first string, err error) {
+	repoName := repository.Owner + "/" + repository.Name
+	for _, g := range d.groups {
+		if !containsFold(g.Repositories, repoName) {
+			continue
+		}
+
+		key := mirrorKeyPrefix + g.Name + "/" + g.identity(repository.Release)
+		ok, err := d.store.Get(key, &first)
+		if err != nil {
+			return "", "", err
+		}
+		if ok && !strings.EqualFold(first, repoName) {
+			return g.Name, first, nil
+		}
+		return "", "", d.store.Put(key, repoName)
+	}
+	return "", "", nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	mrkdwnHeading  = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*$`)
+	mrkdwnListItem = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	mrkdwnImage    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	mrkdwnLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mrkdwnAutoLink = regexp.MustCompile(`&lt;(https?://[^\s>]+?)&gt;`)
+	mrkdwnBold     = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	mrkdwnItalic   = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*`)
+	mrkdwnStrike   = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	mrkdwnEscapes  = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+// mrkdwnBoldMarker stands in for the asterisks of bold text while italics are converted.
+const mrkdwnBoldMarker = "\x00"
+
+// markdownToMrkdwn converts GitHub's Markdown, like release notes, to Slack's mrkdwn:
+// headings and bold text become bold, links Slack's <url|text>, list items bullets and
+// strikethrough single tildes. Code is left as it is, and &, < and > are escaped like Slack wants.
+func markdownToMrkdwn(markdown string) string {
+	lines := strings.Split(strings.Replace(markdown, "\r\n", "\n", -1), "\n")
+	inCode := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			// Slack doesn't highlight code, so the language after the fence goes.
+			inCode = !inCode
+			lines[i] = strings.TrimRight(line[:strings.Index(line, "```")+3], " ")
+			continue
+		}
+		if inCode {
+			lines[i] = mrkdwnEscapes.Replace(line)
+			continue
+		}
+
+		heading := false
+		if m := mrkdwnHeading.FindStringSubmatch(line); m != nil {
+			line, heading = m[1], true
+		}
+		line = mrkdwnListItem.ReplaceAllString(line, "$1• ")
+
+		// Inline code is between every other pair of backticks.
+		parts := strings.Split(line, "`")
+		for j := range parts {
+			if j%2 == 1 && j < len(parts)-1 {
+				parts[j] = mrkdwnEscapes.Replace(parts[j])
+				continue
+			}
+			parts[j] = mrkdwnInline(parts[j])
+		}
+		line = strings.Join(parts, "`")
+
+		if heading {
+			line = "*" + strings.Trim(line, "*") + "*"
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mrkdwnInline converts the emphasis and links of text outside of code.
+func mrkdwnInline(text string) string {
+	text = mrkdwnEscapes.Replace(text)
+	text = mrkdwnImage.ReplaceAllString(text, "<$2|$1>")
+	text = mrkdwnLink.ReplaceAllString(text, "<$2|$1>")
+	text = mrkdwnAutoLink.ReplaceAllString(text, "<$1>")
+	// Bold is marked before italics are converted, as both use asterisks.
+	text = mrkdwnBold.ReplaceAllString(text, mrkdwnBoldMarker+"$1$2"+mrkdwnBoldMarker)
+	text = mrkdwnItalic.ReplaceAllString(text, "_${1}_")
+	text = strings.Replace(text, mrkdwnBoldMarker, "*", -1)
+	return mrkdwnStrike.ReplaceAllString(text, "~$1~")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsTimeout is how long connecting to a NATS server and publishing a release may take.
+const natsTimeout = 10 * time.Second
+
+// NATSSender publishes every release as release event to a subject of a NATS server,
+// through the nats.go client. With JetStream the server acknowledges every event
+// once a stream stored it, otherwise once it received it.
+// Kafka is out of scope, a bridge can forward the events there.
+type NATSSender struct {
+	// Servers are tried in order until one accepts the connection, like nats://nats.internal:4222
+	// or tls://nats.internal:4222, optionally with user:password@ or token@.
+	Servers []string
+	// Subject is where the events are published, {owner} and {name} are replaced with the repository's,
+	// e.g. releases.{owner}.{name}.
+	Subject string
+	// Token, or Username and Password, authenticate with servers without credentials of their own.
+	Token    string
+	Username string
+	Password string
+	// CAFile is the PEM file of the CA to trust for TLS instead of the system's CAs, if set.
+	CAFile string
+	// JetStream waits for a stream to acknowledge every event, see NATSSender.
+	JetStream bool
+	// Retries is how often publishing an event is retried, reconnecting first.
+	Retries    int
+	FieldNames EventFieldNames
+
+	mu   sync.Mutex
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+// Send publishes the repository's release event, retrying with backoff on failures.
+func (s *NATSSender) Send(repository Repository) error {
+	event, err := MarshalReleaseEvent(repository, s.FieldNames)
+	if err != nil {
+		return err
+	}
+	subject := natsSubject(s.Subject, repository)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err := s.publish(subject, event)
+		if err == nil {
+			return nil
+		}
+		// The connection may be broken, the next attempt makes a new one.
+		s.close()
+		if attempt >= s.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// natsSubject returns the subject with the repository's owner and name.
+// Dots would separate the subject's tokens, so they become underscores.
+func natsSubject(subject string, repository Repository) string {
+	token := strings.NewReplacer(".", "_", " ", "_", "/", ".")
+	return strings.NewReplacer(
+		"{owner}", token.Replace(repository.Owner),
+		"{name}", token.Replace(repository.Name),
+	).Replace(subject)
+}
+
+// publish publishes the event on the current connection, connecting first without one.
+// Without JetStream the connection is flushed, so the server's PONG confirms it processed the event.
+func (s *NATSSender) publish(subject string, event []byte) error {
+	if s.conn == nil || s.conn.IsClosed() {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	if !s.JetStream {
+		if err := s.conn.Publish(subject, event); err != nil {
+			return err
+		}
+		return s.conn.FlushTimeout(natsTimeout)
+	}
+
+	_, err := s.js.Publish(subject, event, nats.AckWait(natsTimeout))
+	if errors.Is(err, nats.ErrNoStreamResponse) {
+		return fmt.Errorf("no JetStream stream stored the event, check that one listens on %s", subject)
+	}
+	if err != nil {
+		return fmt.Errorf("JetStream didn't store the event: %v", err)
+	}
+	return nil
+}
+
+// connect connects to the first server accepting the connection and authenticates with it.
+// The client doesn't reconnect by itself, Send does on its retries.
+func (s *NATSSender) connect() error {
+	options := []nats.Option{
+		nats.Name("github-releases-notifier"),
+		nats.Timeout(natsTimeout),
+		nats.DontRandomize(),
+		nats.NoReconnect(),
+	}
+	// Credentials in a server's URL take precedence over these.
+	switch {
+	case s.Token != "":
+		options = append(options, nats.Token(s.Token))
+	case s.Username != "":
+		options = append(options, nats.UserInfo(s.Username, s.Password))
+	}
+	if s.CAFile != "" {
+		options = append(options, nats.RootCAs(s.CAFile))
+	}
+
+	conn, err := nats.Connect(strings.Join(s.Servers, ","), options...)
+	if err != nil {
+		return err
+	}
+	if s.JetStream {
+		s.js, err = conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	s.conn = conn
+	return nil
+}
+
+// close closes the connection, if there is one.
+func (s *NATSSender) close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn, s.js = nil, nil
+}
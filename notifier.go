@@ -0,0 +1,55 @@
+package main
+
+// Notifier delivers notifications about releases to a destination, like Slack or GitLab.
+type Notifier interface {
+	Send(repository Repository) error
+}
+
+// Notifiers is the registry of the enabled notifiers by name, in the order they are registered.
+type Notifiers struct {
+	names     []string
+	notifiers map[string]Notifier
+	accepts   map[string]func(Repository) bool
+}
+
+// Register adds the notifier under the name if it is enabled.
+// accepts, if not nil, returns whether it takes the repository's release at all, e.g. if it only watches some repositories.
+func (n *Notifiers) Register(name string, enabled bool, notifier Notifier, accepts func(Repository) bool) {
+	if !enabled {
+		return
+	}
+	if n.notifiers == nil {
+		n.notifiers = make(map[string]Notifier)
+		n.accepts = make(map[string]func(Repository) bool)
+	}
+	if _, ok := n.notifiers[name]; !ok {
+		n.names = append(n.names, name)
+	}
+	n.notifiers[name] = notifier
+	n.accepts[name] = accepts
+}
+
+// Names returns the names of the enabled notifiers.
+func (n *Notifiers) Names() []string {
+	return n.names
+}
+
+// Accepts returns true if the notifier takes the repository's release.
+func (n *Notifiers) Accepts(name string, repository Repository) bool {
+	accepts := n.accepts[name]
+	return accepts == nil || accepts(repository)
+}
+
+// Notify sends the repository's release to every enabled notifier skip returns false for, with send,
+// e.g. to trace and log the delivery. Every notifier is sent to on its own, one failing doesn't keep
+// the release from the others, and the results tell which ones failed to retry them.
+func (n *Notifiers) Notify(repository Repository, skip func(name string) bool, send func(name string, repository Repository, notifier Notifier) error) []SenderResult {
+	var results []SenderResult
+	for _, name := range n.names {
+		if skip(name) {
+			continue
+		}
+		results = append(results, SenderResult{Sender: name, Err: send(name, repository, n.notifiers[name])})
+	}
+	return results
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Kinds of operational events, about the notifier being unhealthy rather than about releases.
+const (
+	// OpsRateLimited is sent when GitHub's rate limit paused the queries.
+	OpsRateLimited = "rate_limited"
+	// OpsTokenRejected is sent when GitHub rejected a token as invalid, expired or revoked.
+	OpsTokenRejected = "token_rejected"
+	// OpsSendFailures is sent when a sender failed to deliver several times in a row.
+	OpsSendFailures = "send_failures"
+)
+
+// opsRepeatInterval is how long the same event isn't sent again, so an ongoing problem doesn't flood the channel.
+const opsRepeatInterval = time.Hour
+
+// Ops sends operational events to a Slack hook of their own, apart from the notifications about releases.
+// A nil *Ops is valid and does nothing, so it can be used unconditionally.
+type Ops struct {
+	slack  *SlackSender
+	logger log.Logger
+
+	mu       sync.Mutex
+	failures map[string]int
+	sent     map[string]time.Time
+}
+
+// NewOps returns the operational events sender for the Slack hook.
+// It returns nil if the hook is empty.
+func NewOps(hook string, logger log.Logger) *Ops {
+	if hook == "" {
+		return nil
+	}
+	return &Ops{
+		slack:    &SlackSender{Hook: hook},
+		logger:   logger,
+		failures: make(map[string]int),
+		sent:     make(map[string]time.Time),
+	}
+}
+
+// Notify sends the event of the kind about key, e.g. the token or sender involved,
+// unless the same one was sent less than opsRepeatInterval ago.
+func (o *Ops) Notify(kind, key, message string) {
+	if o == nil {
+		return
+	}
+
+	id := kind + " " + key
+	o.mu.Lock()
+	if time.Since(o.sent[id]) < opsRepeatInterval {
+		o.mu.Unlock()
+		return
+	}
+	o.sent[id] = time.Now()
+	o.mu.Unlock()
+
+	err := o.slack.post(slackPayload{
+		Username:  "GitHub Releases",
+		IconEmoji: ":github:",
+		Text:      ":warning: " + message,
+	})
+	if err != nil {
+		level.Warn(o.logger).Log("msg", "failed to send operational event", "kind", kind, "err", err)
+	}
+}
+
+// Repeated counts consecutive failures of the sender for key and notifies them once
+// they reach the threshold, like Sentry.Repeated. Occasional failures are expected and only logged.
+func (o *Ops) Repeated(sender, key string, err error) {
+	if o == nil {
+		return
+	}
+
+	o.mu.Lock()
+	o.failures[key]++
+	failures := o.failures[key]
+	o.mu.Unlock()
+
+	if failures == sentryRepeatedThreshold {
+		o.Notify(OpsSendFailures, key, fmt.Sprintf("%s failed to send %d times in a row: %v", sender, failures, err))
+	}
+}
+
+// Reset clears the consecutive failures for key after it succeeded again.
+func (o *Ops) Reset(key string) {
+	if o == nil {
+		return
+	}
+
+	o.mu.Lock()
+	delete(o.failures, key)
+	o.mu.Unlock()
+}
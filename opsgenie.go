@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// OpsGenieSender creates OpsGenie alerts for releases.
+type OpsGenieSender struct {
+	logger log.Logger
+
+	APIURL   string
+	APIKey   string
+	Priority string
+	// Responders are given as type:name, e.g. team:platform or user:jane@example.com.
+	Responders []string
+	// Repositories limits the alerts to the given owner/name repositories, all if empty.
+	Repositories []string
+	// Fields of the release to include in the description, its notes by default.
+	Fields   NotificationFields
+	Messages Messages
+}
+
+type opsGenieResponder struct {
+	Type     string `json:"type"`
+	Name     string `json:"name,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+type opsGeniePayload struct {
+	Message     string              `json:"message"`
+	Alias       string              `json:"alias"`
+	Description string              `json:"description,omitempty"`
+	Responders  []opsGenieResponder `json:"responders,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Details     map[string]string   `json:"details,omitempty"`
+	Source      string              `json:"source"`
+	Priority    string              `json:"priority,omitempty"`
+}
+
+type opsGenieResponse struct {
+	Result    string            `json:"result"`
+	Message   string            `json:"message"`
+	RequestID string            `json:"requestId"`
+	Errors    map[string]string `json:"errors"`
+}
+
+// Watches returns true if alerts should be created for the repository.
+func (s *OpsGenieSender) Watches(repository Repository) bool {
+	if len(s.Repositories) == 0 {
+		return true
+	}
+	for _, name := range s.Repositories {
+		if strings.EqualFold(name, repository.Owner+"/"+repository.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Send creates an alert for the repository's release.
+// The alias is owner/name@tag, so OpsGenie deduplicates alerts of the same release.
+func (s *OpsGenieSender) Send(repository Repository) error {
+	repoName := repository.Owner + "/" + repository.Name
+
+	var responders []opsGenieResponder
+	for _, responder := range s.Responders {
+		kind, name := "team", responder
+		if i := strings.Index(responder, ":"); i >= 0 {
+			kind, name = responder[:i], responder[i+1:]
+		}
+		if kind == "user" {
+			responders = append(responders, opsGenieResponder{Type: kind, Username: name})
+		} else {
+			responders = append(responders, opsGenieResponder{Type: kind, Name: name})
+		}
+	}
+
+	message := fmt.Sprintf("%s: %s %s", repoName, repository.Release.Name, s.Messages.Action(repository))
+	// OpsGenie rejects alert messages longer than 130 characters.
+	if len(message) > 130 {
+		message = message[:127] + "..."
+	}
+
+	fields := s.Fields.Or(FieldBody)
+	description := fields.Details(repository.Release, s.Messages)
+	if fields.Has(FieldURL) {
+		description = append([]string{repository.Release.URL.String()}, description...)
+	}
+	if fields.Has(FieldBody) && repository.Release.Description != "" {
+		description = append(description, repository.Release.Description)
+	}
+
+	payload := opsGeniePayload{
+		Message:     message,
+		Alias:       repoName + "@" + repository.Release.Key(),
+		Description: strings.Join(description, "\n"),
+		Responders:  responders,
+		Tags:        []string{"github-release", repoName},
+		Details: map[string]string{
+			"repository": repository.URL.String(),
+			"release":    repository.Release.URL.String(),
+			"tag":        repository.Release.TagName,
+		},
+		Source:   "github-releases-notifier",
+		Priority: s.Priority,
+	}
+
+	payloadData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.APIURL, "/")+"/v2/alerts", bytes.NewReader(payloadData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+s.APIKey)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req = req.WithContext(ctx)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	var result opsGenieResponse
+	_ = json.Unmarshal(body, &result)
+
+	// Alerts are created asynchronously, a successful request is only accepted for processing.
+	if resp.StatusCode != http.StatusAccepted {
+		if result.Message != "" {
+			return &statusError{Code: resp.StatusCode, Message: fmt.Sprintf("request didn't respond with 202 Accepted: %s, %s %v", resp.Status, result.Message, result.Errors)}
+		}
+		return &statusError{Code: resp.StatusCode, Message: fmt.Sprintf("request didn't respond with 202 Accepted: %s, %s", resp.Status, body)}
+	}
+
+	level.Debug(s.logger).Log(
+		"msg", "opsgenie accepted alert",
+		"alias", payload.Alias,
+		"result", result.Result,
+		"request_id", result.RequestID,
+	)
+
+	return nil
+}
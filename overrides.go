@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	githubql "github.com/shurcooL/githubql"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// repoOverridesPath is the file in a watched repository's default branch
+	// with the repository's own notification preferences.
+	repoOverridesPath = ".github/releases-notifier.yml"
+	// repoOverridesTTL is how long a repository's overrides are cached.
+	repoOverridesTTL = time.Hour
+)
+
+// RepoOverrides are notification preferences a repository declares itself.
+// They are merged with the notifier's own settings.
+type RepoOverrides struct {
+	// Labels are added to the GitLab issues of the repository's releases.
+	Labels []string `yaml:"labels"`
+	// SkipMarker skips releases containing it, in addition to SKIP_MARKER.
+	SkipMarker string `yaml:"skip_marker"`
+	// IgnorePrereleases skips the repository's pre-releases.
+	IgnorePrereleases bool `yaml:"ignore_prereleases"`
+}
+
+type cachedOverrides struct {
+	overrides *RepoOverrides
+	fetched   time.Time
+}
+
+// overridesFor returns the repository's overrides or nil if it has none.
+// They are only fetched when needed and cached for a while. Failing to fetch or parse them
+// is logged and the last known overrides are used.
+func (c *Checker) overridesFor(owner, name string) *RepoOverrides {
+	key := owner + "/" + name
+	// Overrides are only looked for on GitHub.
+	if c.sources[key] != nil {
+		return nil
+	}
+	cached, ok := c.overridesCache[key]
+	if ok && time.Since(cached.fetched) < repoOverridesTTL {
+		return cached.overrides
+	}
+
+	overrides, err := c.queryOverrides(owner, name)
+	if err != nil {
+		level.Warn(c.logger).Log(
+			"msg", "failed to fetch the repository's overrides",
+			"owner", owner,
+			"name", name,
+			"err", err,
+		)
+		return cached.overrides
+	}
+
+	if c.overridesCache == nil {
+		c.overridesCache = make(map[string]cachedOverrides)
+	}
+	c.overridesCache[key] = cachedOverrides{overrides: overrides, fetched: time.Now()}
+	return overrides
+}
+
+func (c *Checker) queryOverrides(owner, name string) (*RepoOverrides, error) {
+	var query struct {
+		Repository struct {
+			Object *struct {
+				Blob struct {
+					Text *githubql.String
+				} `graphql:"... on Blob"`
+			} `graphql:"object(expression: $expression)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner":      githubql.String(owner),
+		"name":       githubql.String(name),
+		"expression": githubql.String("HEAD:" + repoOverridesPath),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.clientFor(owner+"/"+name).Query(ctx, &query, variables); err != nil {
+		return nil, err
+	}
+
+	// Most repositories don't have the file.
+	if query.Repository.Object == nil || query.Repository.Object.Blob.Text == nil {
+		return nil, nil
+	}
+
+	var overrides RepoOverrides
+	if err := yaml.Unmarshal([]byte(*query.Repository.Object.Blob.Text), &overrides); err != nil {
+		return nil, err
+	}
+	return &overrides, nil
+}
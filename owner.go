@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	githubql "github.com/shurcooL/githubql"
+)
+
+const (
+	// orgPrefix expands the repositories of an organization, e.g. org:kubernetes.
+	orgPrefix = "org:"
+	// userPrefix expands the repositories owned by a user, e.g. user:octocat.
+	userPrefix = "user:"
+	// regexpPrefix marks repository patterns that are regular expressions rather than globs.
+	regexpPrefix = "re:"
+)
+
+type ownedRepositories struct {
+	Nodes    []expandedRepository
+	PageInfo struct {
+		EndCursor   githubql.String
+		HasNextPage githubql.Boolean
+	}
+}
+
+// expandOwner returns the repositories of the organization or, if isUser, the ones owned by the user.
+func (c *Checker) expandOwner(login string, isUser bool) ([]string, error) {
+	var repositories []string
+	variables := map[string]interface{}{
+		"login":  githubql.String(login),
+		"cursor": (*githubql.String)(nil),
+	}
+
+	for {
+		var org struct {
+			Organization *struct {
+				Repositories ownedRepositories `graphql:"repositories(first: 100, after: $cursor)"`
+			} `graphql:"organization(login: $login)"`
+		}
+		var user struct {
+			User *struct {
+				Repositories ownedRepositories `graphql:"repositories(first: 100, after: $cursor, ownerAffiliations: OWNER)"`
+			} `graphql:"user(login: $login)"`
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var page ownedRepositories
+		var err error
+		if isUser {
+			err = c.client.Query(ctx, &user, variables)
+			if err == nil && user.User == nil {
+				err = fmt.Errorf("can't find user %s", login)
+			}
+			if user.User != nil {
+				page = user.User.Repositories
+			}
+		} else {
+			err = c.client.Query(ctx, &org, variables)
+			if err == nil && org.Organization == nil {
+				err = fmt.Errorf("can't find organization %s", login)
+			}
+			if org.Organization != nil {
+				page = org.Organization.Repositories
+			}
+		}
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range page.Nodes {
+			if c.watchExpanded(node) {
+				repositories = append(repositories, string(node.NameWithOwner))
+			}
+		}
+		if !page.PageInfo.HasNextPage {
+			return repositories, nil
+		}
+		variables["cursor"] = githubql.NewString(page.PageInfo.EndCursor)
+	}
+}
+
+// RepositoryFilter decides which of the repositories found by expansions are watched.
+type RepositoryFilter struct {
+	include []repositoryPattern
+	exclude []repositoryPattern
+}
+
+// repositoryPattern is a glob like kubernetes/sig-* or a regular expression after re:.
+// Globs without a slash match the name regardless of the owner.
+type repositoryPattern struct {
+	glob   string
+	regexp *regexp.Regexp
+}
+
+// ParseRepositoryFilter parses the patterns of the repositories to include, all if there are none,
+// and of the ones to exclude from them.
+func ParseRepositoryFilter(include, exclude []string) (RepositoryFilter, error) {
+	var filter RepositoryFilter
+	var err error
+	if filter.include, err = parseRepositoryPatterns(include); err != nil {
+		return RepositoryFilter{}, err
+	}
+	if filter.exclude, err = parseRepositoryPatterns(exclude); err != nil {
+		return RepositoryFilter{}, err
+	}
+	return filter, nil
+}
+
+func parseRepositoryPatterns(entries []string) ([]repositoryPattern, error) {
+	patterns := make([]repositoryPattern, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, regexpPrefix) {
+			re, err := regexp.Compile("(?i)" + strings.TrimPrefix(entry, regexpPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("invalid repository pattern %q: %v", entry, err)
+			}
+			patterns = append(patterns, repositoryPattern{regexp: re})
+			continue
+		}
+		if _, err := path.Match(entry, ""); err != nil {
+			return nil, fmt.Errorf("invalid repository pattern %q: %v", entry, err)
+		}
+		patterns = append(patterns, repositoryPattern{glob: strings.ToLower(entry)})
+	}
+	return patterns, nil
+}
+
+func (p repositoryPattern) matches(repoName string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(repoName)
+	}
+	repoName = strings.ToLower(repoName)
+	if !strings.Contains(p.glob, "/") {
+		repoName = repoName[strings.Index(repoName, "/")+1:]
+	}
+	// Validated when parsing the pattern.
+	matched, _ := path.Match(p.glob, repoName)
+	return matched
+}
+
+// Watches returns true if the repository given as owner/name matches any of the included patterns, if there are any,
+// and none of the excluded ones.
+func (f RepositoryFilter) Watches(repoName string) bool {
+	for _, pattern := range f.exclude {
+		if pattern.matches(repoName) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if pattern.matches(repoName) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	githubql "github.com/shurcooL/githubql"
+)
+
+// gitObject is a file or directory at a tag, its ID changes with its content.
+type gitObject struct {
+	Oid githubql.GitObjectID
+}
+
+// pathsChanged returns true if any of the paths differs between the tags of the releases,
+// comparing the IDs of their Git objects instead of downloading the releases.
+// A path added or removed counts as changed, one missing at both tags doesn't.
+func (c *Checker) pathsChanged(ctx context.Context, repoName string, paths []string, release, previous Release) (bool, error) {
+	owner, name := c.currentName(repoName)
+	for _, path := range paths {
+		var query struct {
+			Repository struct {
+				Previous *gitObject `graphql:"previous: object(expression: $previous)"`
+				Current  *gitObject `graphql:"current: object(expression: $current)"`
+			} `graphql:"repository(owner: $owner, name: $name)"`
+		}
+		variables := map[string]interface{}{
+			"owner":    githubql.String(owner),
+			"name":     githubql.String(name),
+			"previous": githubql.String(previous.TagName + ":" + path),
+			"current":  githubql.String(release.TagName + ":" + path),
+		}
+
+		queryCtx, cancel := context.WithTimeout(ctx, c.timeout(5*time.Second))
+		err := c.clientFor(repoName).Query(queryCtx, &query, variables)
+		cancel()
+		if err != nil {
+			return false, err
+		}
+
+		prev, curr := query.Repository.Previous, query.Repository.Current
+		if (prev == nil) != (curr == nil) || (prev != nil && prev.Oid != curr.Oid) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// changesWatchedPaths returns true unless the repository watches paths and none of them changed
+// since the previous release. Releases are notified if that can't be told, e.g. without tags.
+func (c *Checker) changesWatchedPaths(ctx context.Context, repoName string, release, previous Release) bool {
+	paths := c.paths(repoName)
+	if len(paths) == 0 || release.TagName == "" || previous.TagName == "" || c.sources[repoName] != nil {
+		return true
+	}
+
+	changed, err := c.pathsChanged(ctx, repoName, paths, release, previous)
+	if err != nil {
+		level.Warn(c.logger).Log(
+			"msg", "failed to compare the watched paths of the release, notifying anyway",
+			"repository", repoName,
+			"release", release.TagName,
+			"err", err,
+		)
+		return true
+	}
+	if !changed {
+		level.Debug(c.logger).Log(
+			"msg", "not notifying about release without changes to the watched paths",
+			"repository", repoName,
+			"release", release.TagName,
+			"previous", previous.TagName,
+		)
+	}
+	return changed
+}
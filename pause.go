@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// What happens to releases found while notifications are paused.
+const (
+	// PauseBuffer holds them back and notifies about them on resume.
+	PauseBuffer = "buffer"
+	// PauseDrop only remembers them as seen, without ever notifying.
+	PauseDrop = "drop"
+)
+
+const pausedKeyPrefix = "paused/"
+
+// storedPaused is a release or a notice held back while notifications are paused.
+type storedPaused struct {
+	Repository *Repository `json:"repository,omitempty"`
+	Notice     *Notice     `json:"notice,omitempty"`
+}
+
+// pausedKey is where a release held back is kept, after a # so it still belongs to the repository, see keyRepository.
+func pausedKey(repository Repository) string {
+	return pausedKeyPrefix + strings.ToLower(repository.Owner+"/"+repository.Name) + "#" + repository.Release.Key()
+}
+
+// pausedNoticeKey is where a notice held back is kept, like a release.
+func pausedNoticeKey(notice Notice) string {
+	return pausedKeyPrefix + strings.ToLower(notice.Repository) + "#notice:" + notice.Kind
+}
+
+// Pause stops notifications for a while, e.g. during maintenance, while checks go on.
+// Releases and notices held back are kept in the store, as they are seen already,
+// so they are notified after a restart, too.
+type Pause struct {
+	buffer  bool
+	store   Store
+	resumed chan struct{}
+
+	mu      sync.Mutex
+	paused  bool
+	since   time.Time
+	dropped int
+}
+
+// PauseStatus is the current state of a Pause.
+type PauseStatus struct {
+	Paused bool       `json:"paused"`
+	Since  *time.Time `json:"paused_since,omitempty"`
+	// Held counts the releases and notices held back, Dropped the ones found since pausing.
+	Held    int `json:"held"`
+	Dropped int `json:"dropped"`
+}
+
+// NewPause returns an unpaused Pause handling releases found while paused according to mode,
+// keeping the held back ones in store.
+func NewPause(mode string, store Store) *Pause {
+	return &Pause{
+		buffer:  mode == PauseBuffer,
+		store:   store,
+		resumed: make(chan struct{}, 1),
+	}
+}
+
+// Pause stops notifications. It returns false if they already were.
+func (p *Pause) Pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		return false
+	}
+	p.paused, p.since, p.dropped = true, time.Now(), 0
+	return true
+}
+
+// Resume notifications. It returns false if they weren't paused.
+// Held back releases are handed out by Take after Resumed fires.
+func (p *Pause) Resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		return false
+	}
+	p.paused = false
+	select {
+	case p.resumed <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Resumed fires after notifications were resumed.
+func (p *Pause) Resumed() <-chan struct{} {
+	return p.resumed
+}
+
+// Hold holds back or drops the repository's release if notifications are paused
+// and returns true if it did, along with an error if it couldn't be kept.
+func (p *Pause) Hold(repository Repository) (bool, error) {
+	repository.span = nil
+	repository.status = nil
+	return p.hold(pausedKey(repository), storedPaused{Repository: &repository})
+}
+
+// HoldNotice holds back or drops the notice like Hold.
+func (p *Pause) HoldNotice(notice Notice) (bool, error) {
+	return p.hold(pausedNoticeKey(notice), storedPaused{Notice: &notice})
+}
+
+func (p *Pause) hold(key string, held storedPaused) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		return false, nil
+	}
+	if !p.buffer {
+		p.dropped++
+		return true, nil
+	}
+	return true, p.store.Put(key, held)
+}
+
+// Take returns the releases and notices held back while paused, also before a restart, and forgets them.
+func (p *Pause) Take() ([]Repository, []Notice, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys, err := p.store.Keys(pausedKeyPrefix)
+	if err != nil || len(keys) == 0 {
+		return nil, nil, err
+	}
+	var releases []Repository
+	var notices []Notice
+	for _, key := range keys {
+		var held storedPaused
+		if _, err := p.store.Get(key, &held); err != nil {
+			return releases, notices, err
+		}
+		if held.Repository != nil {
+			releases = append(releases, *held.Repository)
+		}
+		if held.Notice != nil {
+			notices = append(notices, *held.Notice)
+		}
+	}
+	return releases, notices, p.store.Delete(keys...)
+}
+
+// Status returns whether notifications are paused and since when.
+func (p *Pause) Status() PauseStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Failing to load them isn't worth failing the status for.
+	held, _ := p.store.Keys(pausedKeyPrefix)
+	status := PauseStatus{Paused: p.paused, Held: len(held), Dropped: p.dropped}
+	if p.paused {
+		since := p.since
+		status.Since = &since
+	}
+	return status
+}
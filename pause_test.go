@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestPauseKeepsHeldReleases(t *testing.T) {
+	store, err := NewFileStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pause := NewPause(PauseBuffer, store)
+	repository := Repository{Owner: "octocat", Name: "hello", Release: Release{TagName: "v1.0.0"}}
+	notice := Notice{Kind: NoticeArchived, Repository: "octocat/hello"}
+	if held, err := pause.Hold(repository); held || err != nil {
+		t.Fatalf("Hold() before pausing = %t, %v, want the release notified", held, err)
+	}
+
+	pause.Pause()
+	if held, err := pause.Hold(repository); !held || err != nil {
+		t.Fatalf("Hold() = %t, %v, want the release held back", held, err)
+	}
+	if held, err := pause.HoldNotice(notice); !held || err != nil {
+		t.Fatalf("HoldNotice() = %t, %v, want the notice held back", held, err)
+	}
+	if status := pause.Status(); status.Held != 2 {
+		t.Errorf("held = %d, want 2", status.Held)
+	}
+
+	// After a restart the held back releases are still there.
+	releases, notices, err := NewPause(PauseBuffer, store).Take()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 1 || releases[0].Release.TagName != "v1.0.0" || len(notices) != 1 || notices[0] != notice {
+		t.Errorf("Take() = %v, %v, want the held back release and notice", releases, notices)
+	}
+	if keys := mustKeys(t, store, pausedKeyPrefix); len(keys) != 0 {
+		t.Errorf("held back = %v, want them forgotten", keys)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// prefetch queries the keys with the checker's workers, the releases of repositories in batches as usual,
+// so a slow repository only holds up its own worker. Before every query a worker waits for the rate limits
+// and a random jitter, so the workers don't all hit GitHub at once.
+func (c *Checker) prefetch(ctx context.Context, cycle *Span, keys []string) map[string]batchResult {
+	// The names to query are looked up first, the workers only read them.
+	for _, key := range keys {
+		c.currentName(keyRepository(key))
+	}
+
+	var units [][]string
+	assigned := make(map[string]bool, len(keys))
+	for i, key := range keys {
+		if assigned[key] {
+			continue
+		}
+		unit := []string{key}
+		if c.batched(key) {
+			unit = c.nextBatch(keys[i:])
+		}
+		for _, key := range unit {
+			assigned[key] = true
+		}
+		units = append(units, unit)
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]batchResult, len(keys))
+	work := make(chan []string)
+	var wg sync.WaitGroup
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for unit := range work {
+				c.waitForRateLimits(ctx)
+				if c.jitter > 0 {
+					select {
+					case <-time.After(time.Duration(rand.Int63n(int64(c.jitter)))):
+					case <-ctx.Done():
+					}
+				}
+
+				span := c.tracer.Start(cycle, "query")
+				span.SetAttribute("repository", keyRepository(unit[0]))
+				var batch map[string]batchResult
+				if len(unit) > 1 || c.batched(unit[0]) {
+					batch = c.queryBatch(ctx, span, unit)
+				} else {
+					repository, err := c.queryKey(ctx, span, unit[0])
+					batch = map[string]batchResult{unit[0]: {repository: repository, err: err}}
+				}
+				span.End(nil)
+
+				mu.Lock()
+				for key, result := range batch {
+					results[key] = result
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, unit := range units {
+		work <- unit
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
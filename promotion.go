@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const prereleaseKeyPrefix = "prerelease/"
+
+// prereleaseKey is where the last pre-release seen of a base version like 2.0.0 is kept,
+// after a # so the key still belongs to the repository, see keyRepository.
+func prereleaseKey(key, base string) string {
+	return prereleaseKeyPrefix + key + "#" + base
+}
+
+// baseVersion returns the version without pre-release and build, like 2.0.0 of v2.0.0-rc.3.
+func baseVersion(v Version) string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// rememberPrerelease keeps the release, if it is a pre-release, in the history of its base version
+// so the stable release can be told apart as its promotion.
+func (c *Checker) rememberPrerelease(key string, release Release) {
+	v, err := release.Version()
+	if err != nil || !v.IsPrerelease() {
+		return
+	}
+
+	tag := release.TagName
+	if tag == "" {
+		tag = release.Name
+	}
+	storeKey := prereleaseKey(key, baseVersion(v))
+	if c.prereleases == nil {
+		c.prereleases = make(map[string]string)
+	}
+	c.prereleases[storeKey] = tag
+	if c.store == nil {
+		return
+	}
+	if err := c.store.Put(storeKey, tag); err != nil {
+		level.Warn(c.logger).Log(
+			"msg", "failed to store the repository's pre-release",
+			"repository", key,
+			"err", err,
+		)
+	}
+}
+
+// promotedFrom returns the tag of the pre-release seen before of the stable release's version,
+// or an empty string if it isn't stable or none was seen. The pre-release is forgotten,
+// so the version is promoted only once.
+func (c *Checker) promotedFrom(key string, release, previous Release) string {
+	v, err := release.Version()
+	if err != nil || v.IsPrerelease() {
+		return ""
+	}
+	base := baseVersion(v)
+	storeKey := prereleaseKey(key, base)
+
+	tag, ok := c.prereleases[storeKey]
+	if !ok && c.store != nil {
+		var err error
+		ok, err = c.store.Get(storeKey, &tag)
+		if err != nil {
+			level.Warn(c.logger).Log(
+				"msg", "failed to load the repository's pre-release",
+				"repository", key,
+				"err", err,
+			)
+		}
+	}
+	// The previous release tells even without the history, e.g. of releases seen before it was kept.
+	if !ok {
+		if prev, err := previous.Version(); err == nil && prev.IsPrerelease() && baseVersion(prev) == base {
+			if previous.TagName == "" {
+				return previous.Name
+			}
+			return previous.TagName
+		}
+		return ""
+	}
+
+	delete(c.prereleases, storeKey)
+	if c.store != nil {
+		if err := c.store.Delete(storeKey); err != nil {
+			level.Warn(c.logger).Log(
+				"msg", "failed to remove the repository's pre-release",
+				"repository", key,
+				"err", err,
+			)
+		}
+	}
+	return tag
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	githubql "github.com/shurcooL/githubql"
+)
+
+const (
+	// secondaryRateLimitBackoff is how long to pause after hitting the secondary rate limit
+	// without a Retry-After header. It grows with every hit in a row up to secondaryRateLimitMaxBackoff.
+	secondaryRateLimitBackoff    = time.Minute
+	secondaryRateLimitMaxBackoff = 15 * time.Minute
+)
+
+// SecondaryRateLimit keeps track of GitHub's secondary rate limit, also known as abuse detection,
+// which is hit by too many requests in a short time regardless of the remaining quota.
+type SecondaryRateLimit struct {
+	mu    sync.Mutex
+	until time.Time
+	hits  int
+}
+
+// Remaining returns how long requests should still be paused.
+func (l *SecondaryRateLimit) Remaining() time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if d := time.Until(l.until); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (l *SecondaryRateLimit) hit(retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.hits++
+	if retryAfter <= 0 {
+		retryAfter = time.Duration(l.hits) * secondaryRateLimitBackoff
+		if retryAfter > secondaryRateLimitMaxBackoff {
+			retryAfter = secondaryRateLimitMaxBackoff
+		}
+	}
+	l.until = time.Now().Add(retryAfter)
+}
+
+func (l *SecondaryRateLimit) reset() {
+	l.mu.Lock()
+	l.hits = 0
+	l.mu.Unlock()
+}
+
+// isSecondaryRateLimit returns true if the error or response body is about the secondary rate limit.
+func isSecondaryRateLimit(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "secondary rate limit") || strings.Contains(message, "abuse")
+}
+
+// primaryRateLimit is the quota of GitHub's primary rate limit as of the last response, shared by all clients.
+var primaryRateLimit = &PrimaryRateLimit{}
+
+// PrimaryRateLimit keeps track of GitHub's primary rate limit, the quota of requests per hour,
+// so queries can be paused until it is reset instead of failing until then.
+type PrimaryRateLimit struct {
+	mu        sync.Mutex
+	known     bool
+	remaining int
+	resetAt   time.Time
+}
+
+// observe keeps the quota of the last response.
+func (l *PrimaryRateLimit) observe(remaining int, resetAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.known = true
+	l.remaining = remaining
+	if !resetAt.IsZero() {
+		l.resetAt = resetAt
+	}
+	rateLimitRemaining.Set(int64(remaining))
+	if !l.resetAt.IsZero() {
+		rateLimitResetAt.Set(l.resetAt.Unix())
+	}
+}
+
+// exhausted records that a query failed because the quota ran out.
+// Without a known reset it is assumed in a minute, so queries are retried soon.
+func (l *PrimaryRateLimit) exhausted() {
+	l.mu.Lock()
+	resetAt := l.resetAt
+	l.mu.Unlock()
+	if !resetAt.After(time.Now()) {
+		resetAt = time.Now().Add(time.Minute)
+	}
+	l.observe(0, resetAt)
+}
+
+// Wait returns how long queries should be paused because at most reserve requests are left until the quota is reset.
+func (l *PrimaryRateLimit) Wait(reserve int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.known || l.remaining > reserve {
+		return 0
+	}
+	if d := time.Until(l.resetAt); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Quota returns the remaining quota and when it is reset, as of the last response.
+func (l *PrimaryRateLimit) Quota() (remaining int, resetAt time.Time, known bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.remaining, l.resetAt, l.known
+}
+
+// isPrimaryRateLimit returns true if the error is about the quota running out, not the secondary rate limit.
+func isPrimaryRateLimit(message string) bool {
+	return strings.Contains(strings.ToLower(message), "rate limit exceeded") && !isSecondaryRateLimit(message)
+}
+
+// rateLimit is GitHub's primary rate limit as queried along with the releases.
+type rateLimit struct {
+	Cost      githubql.Int
+	Remaining githubql.Int
+	ResetAt   githubql.DateTime
+}
+
+// record adds the query's cost to the span and keeps the remaining quota for pausing queries and the metrics.
+// Queries that failed before GitHub answered have no cost and are left out.
+func (l rateLimit) record(span *Span) {
+	if l.Cost == 0 {
+		return
+	}
+	span.SetAttribute("github.api.cost", int(l.Cost))
+	primaryRateLimit.observe(int(l.Remaining), l.ResetAt.Time)
+}
+
+// rateLimitTransport records secondary rate limit responses, including their Retry-After header,
+// and the quota of the primary rate limit of every response, also of queries not asking for it.
+type rateLimitTransport struct {
+	next  http.RoundTripper
+	limit *SecondaryRateLimit
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		var resetAt time.Time
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			resetAt = time.Unix(reset, 0)
+		}
+		primaryRateLimit.observe(remaining, resetAt)
+	}
+
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		t.limit.reset()
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if isSecondaryRateLimit(string(body)) {
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		t.limit.hit(time.Duration(seconds) * time.Second)
+	}
+	return resp, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// maxWebhookPayload is the most GitHub sends in a webhook delivery.
+const maxWebhookPayload = 25 << 20
+
+// webhookEvent is the part of GitHub's release and create events that tells the repository.
+type webhookEvent struct {
+	Action     string `json:"action"`
+	RefType    string `json:"ref_type"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// receiveWebhook handles GitHub's release and create events, the latter for tags, by checking their repository
+// right away. The events are only taken as a hint, the repository's releases are queried as on any check,
+// so events of unwatched repositories or for releases notified already don't notify anything.
+// Events are answered once they are in the inbox, see Checker.Receive, checking their repository comes after.
+func (s *Server) receiveWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validSignature(s.webhookSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		level.Warn(s.logger).Log("msg", "rejected webhook with invalid signature", "remote", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	kind := r.Header.Get("X-GitHub-Event")
+	var event webhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	repoName := event.Repository.FullName
+	if kind != "release" && (kind != "create" || event.RefType != "tag") || strings.Count(repoName, "/") != 1 {
+		// Pings and other events are fine, they just don't trigger anything.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	err = s.receive(inboxEvent{Event: kind, Action: event.Action, Delivery: delivery, Repository: repoName})
+	if err == errInboxFull {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		level.Warn(s.logger).Log("msg", "failed to store received webhook", "repository", repoName, "delivery", delivery, "err", err)
+		http.Error(w, "failed to store the event", http.StatusInternalServerError)
+		return
+	}
+	level.Debug(s.logger).Log(
+		"msg", "received webhook",
+		"event", kind,
+		"action", event.Action,
+		"repository", repoName,
+		"delivery", delivery,
+	)
+	w.WriteHeader(http.StatusOK)
+}
+
+// validSignature returns true if signature, like sha256=<hex>, is the HMAC of the body with the secret.
+func validSignature(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	sum, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sum, mac.Sum(nil))
+}
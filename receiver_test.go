@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func signedWebhook(secret, kind, body string) *http.Request {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	r.Header.Set("X-GitHub-Event", kind)
+	r.Header.Set("X-GitHub-Delivery", "delivery-1")
+	r.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestReceiveWebhook(t *testing.T) {
+	release := `{"action": "published", "repository": {"full_name": "octocat/hello"}}`
+	tests := []struct {
+		name       string
+		request    *http.Request
+		receiveErr error
+		wantStatus int
+		wantEvent  bool
+	}{
+		{"release", signedWebhook("secret", "release", release), nil, http.StatusOK, true},
+		{"tag", signedWebhook("secret", "create", `{"ref_type": "tag", "repository": {"full_name": "octocat/hello"}}`), nil, http.StatusOK, true},
+		{"branch", signedWebhook("secret", "create", `{"ref_type": "branch", "repository": {"full_name": "octocat/hello"}}`), nil, http.StatusNoContent, false},
+		{"ping", signedWebhook("secret", "ping", `{"zen": "Keep it simple."}`), nil, http.StatusNoContent, false},
+		{"invalid signature", signedWebhook("other", "release", release), nil, http.StatusUnauthorized, false},
+		{"inbox full", signedWebhook("secret", "release", release), errInboxFull, http.StatusServiceUnavailable, true},
+		{"store failed", signedWebhook("secret", "release", release), errors.New("disk full"), http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received []inboxEvent
+			s := &Server{
+				logger:        log.NewNopLogger(),
+				webhookSecret: "secret",
+				receive: func(event inboxEvent) error {
+					received = append(received, event)
+					return tt.receiveErr
+				},
+			}
+			w := httptest.NewRecorder()
+			s.receiveWebhook(w, tt.request)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := len(received) == 1; got != tt.wantEvent {
+				t.Fatalf("received = %+v, want an event: %v", received, tt.wantEvent)
+			}
+			if tt.wantEvent && (received[0].Repository != "octocat/hello" || received[0].Delivery != "delivery-1") {
+				t.Errorf("received = %+v, want octocat/hello from delivery-1", received[0])
+			}
+		})
+	}
+}
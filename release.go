@@ -1,18 +1,102 @@
 package main
 
 import (
+	"fmt"
 	"net/url"
+	"path"
+	"regexp"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Release of a repository tagged via GitHub.
 type Release struct {
-	ID          string
-	Name        string
-	Description string
-	URL         url.URL
-	PublishedAt time.Time
+	ID           string
+	Name         string
+	TagName      string
+	IsPrerelease bool
+	Description  string
+	// FullDescription is the description before Normalized cut it, empty if it wasn't.
+	FullDescription string
+	URL             url.URL
+	PublishedAt     time.Time
+	CreatedAt       time.Time
+	Author          string
+	// AuthorAvatarURL and AuthorURL are the author's avatar and profile, if known.
+	AuthorAvatarURL string
+	AuthorURL       string
+	Assets          []Asset
+	// Checks is the state of the status checks of the release's commit, if the repository takes them into account.
+	Checks string
+
+	// assetsCursor is where the assets queried with the release end if it has more of them, see queryRemainingAssets.
+	assetsCursor string
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	Name      string
+	URL       url.URL
+	Downloads int
+}
+
+// AssetPattern matches asset names, e.g. of binaries for a platform.
+type AssetPattern struct {
+	glob   string
+	regexp *regexp.Regexp
+}
+
+// ParseAssetPattern parses a regular expression like linux_amd64 matching anywhere in the name,
+// or with a glob: prefix a glob like glob:*_linux_amd64.tar.gz matching the whole name.
+func ParseAssetPattern(pattern string) (AssetPattern, error) {
+	if strings.HasPrefix(pattern, "glob:") {
+		glob := strings.TrimPrefix(pattern, "glob:")
+		if _, err := path.Match(glob, ""); err != nil {
+			return AssetPattern{}, fmt.Errorf("invalid asset glob %q: %v", glob, err)
+		}
+		return AssetPattern{glob: glob}, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return AssetPattern{}, fmt.Errorf("invalid asset pattern %q: %v", pattern, err)
+	}
+	return AssetPattern{regexp: re}, nil
+}
+
+// Matches returns true if the asset name matches the pattern.
+func (p AssetPattern) Matches(name string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(name)
+	}
+	matched, _ := path.Match(p.glob, name)
+	return matched
+}
+
+func (p AssetPattern) String() string {
+	if p.regexp != nil {
+		return p.regexp.String()
+	}
+	return "glob:" + p.glob
+}
+
+// Key identifies the release within its repository:
+// its tag or, for releases without one like discussion announcements, its ID.
+func (r Release) Key() string {
+	if r.TagName != "" {
+		return r.TagName
+	}
+	return r.ID
+}
+
+// Version parses the release's tag as semantic version,
+// falling back to its name for releases without a tag.
+func (r Release) Version() (Version, error) {
+	if r.TagName != "" {
+		return ParseVersion(r.TagName)
+	}
+	return ParseVersion(r.Name)
 }
 
 // IsReleaseCandidate returns true if the release name hints at an RC release.
@@ -25,7 +109,100 @@ func (r Release) IsBeta() bool {
 	return strings.Contains(strings.ToLower(r.Name), "beta")
 }
 
+// IsSecurity returns true if the release name or description hints at a security fix.
+func (r Release) IsSecurity() bool {
+	for _, text := range []string{r.Name, r.Description} {
+		text = strings.ToLower(text)
+		if strings.Contains(text, "security") || strings.Contains(text, "cve-") {
+			return true
+		}
+	}
+	return false
+}
+
 // IsNonstable returns true if one of the non-stable release-checking functions return true.
 func (r Release) IsNonstable() bool {
 	return r.IsReleaseCandidate() || r.IsBeta()
 }
+
+// IsAuthoredBy returns true if the release was published by one of the given logins.
+// Logins are compared case-insensitively.
+func (r Release) IsAuthoredBy(logins ...string) bool {
+	for _, login := range logins {
+		if strings.EqualFold(r.Author, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// Downloads returns the total download count of the release's assets.
+func (r Release) Downloads() int {
+	var downloads int
+	for _, asset := range r.Assets {
+		downloads += asset.Downloads
+	}
+	return downloads
+}
+
+// HasAsset returns true if one of the release's assets matches the pattern.
+func (r Release) HasAsset(pattern AssetPattern) bool {
+	for _, asset := range r.Assets {
+		if pattern.Matches(asset.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasMarker returns true if the release name or description contains the marker, ignoring case.
+func (r Release) HasMarker(marker string) bool {
+	if marker == "" {
+		return false
+	}
+	marker = strings.ToLower(marker)
+	return strings.Contains(strings.ToLower(r.Name), marker) ||
+		strings.Contains(strings.ToLower(r.Description), marker)
+}
+
+// Notes returns the release notes cut to maxBody bytes like Normalized cuts them, for senders showing
+// shorter notes than all others get. A maxBody of 0 returns the notes as they are.
+func (r Release) Notes(maxBody int, messages Messages) string {
+	if maxBody <= 0 || len(r.Description) <= maxBody {
+		return r.Description
+	}
+	if r.FullDescription != "" {
+		r.Description = r.FullDescription
+	}
+	return r.Normalized(maxBody, messages).Description
+}
+
+// Normalized returns the release with its description cleaned up for sending:
+// control characters other than newlines and tabs are removed and descriptions
+// longer than maxBody bytes are cut with the messages' notice linking to the release.
+// A maxBody of 0 doesn't cut descriptions.
+func (r Release) Normalized(maxBody int, messages Messages) Release {
+	body := strings.Map(func(c rune) rune {
+		if c == utf8.RuneError || (unicode.IsControl(c) && c != '\n' && c != '\t') {
+			return -1
+		}
+		return c
+	}, strings.Replace(r.Description, "\r\n", "\n", -1))
+
+	notice := "\n\n" + fmt.Sprintf(messages.Truncated, r.URL.String())
+	if maxBody > 0 && len(body) > maxBody {
+		cut := maxBody - len(notice)
+		if cut < 0 {
+			cut = 0
+		}
+		// Don't cut runes in half.
+		for cut > 0 && !utf8.RuneStart(body[cut]) {
+			cut--
+		}
+		r.FullDescription = body
+		body = strings.TrimRightFunc(body[:cut], unicode.IsSpace) + notice
+	}
+
+	r.Description = body
+	return r
+}
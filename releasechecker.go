@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -11,127 +16,1141 @@ import (
 	githubql "github.com/shurcooL/githubql"
 )
 
-// Checker has a githubql client to run queries and also knows about
-// the current repositories releases to compare against.
+// Strategies to decide whether a release is newer than the last seen one.
+const (
+	// NewnessPublished compares the time releases were published.
+	NewnessPublished = "published"
+	// NewnessSemver compares the tags as semantic versions,
+	// so backports to older release lines are not considered new.
+	NewnessSemver = "semver"
+	// NewnessCreated compares the time releases were created.
+	NewnessCreated = "created"
+	// NewnessCreatedAfterLastSeen strictly compares the time releases were created:
+	// a release edited in any way, including renames, is never new, and neither is
+	// a release compared to a last seen one of unknown creation time.
+	NewnessCreatedAfterLastSeen = "created_after_last_seen"
+)
+
+// releaseLineLookback is how many recent releases are searched
+// for the latest one on a repository's release line.
+const releaseLineLookback = 20
+
+var errNoReleaseOnLine = errors.New("no recent release on the release line")
+
+// errGitHubUnavailable is the cause of a check whose repositories all failed because GitHub couldn't be reached.
+var errGitHubUnavailable = errors.New("GitHub couldn't be reached")
+
+// Checker has a githubql client to run queries, the sources of the repositories on other forges,
+// and also knows about the current repositories releases to compare against.
 type Checker struct {
 	logger   log.Logger
 	client   *githubql.Client
+	clients  map[string]*githubql.Client
+	sources  map[string]Source
 	releases map[string]Repository
+	store    Store
+	newness  string
+	// discussions maps repositories to the discussion category
+	// whose posts are announced like releases.
+	discussions map[string]string
+	// categories caches the IDs of the categories, it is guarded by categoriesMu as workers look them up at the same time.
+	categories   map[string]githubql.ID
+	categoriesMu sync.Mutex
+	// releaseLines limits repositories to the releases of a version line.
+	releaseLines map[string]ReleaseLine
+	// catchUp also notifies the releases before the latest one that were published since the last seen one,
+	// e.g. while the notifier was down, the newest catchUpLimit of them if it is set.
+	catchUp      bool
+	catchUpLimit int
+	// backfillSince notifies the releases published since then when a repository is checked for the first time.
+	backfillSince Since
+	// initialNotify returns true for repositories whose current release
+	// is notified when they are checked for the first time.
+	initialNotify func(repoName string) bool
+	// overrides fetches the repositories' own notification preferences for new releases.
+	overrides      bool
+	overridesCache map[string]cachedOverrides
+	// expansions are the repositories of the last successful expansion by entry.
+	expansions map[string][]string
+	// searchLimit caps the repositories of a search expansion.
+	searchLimit int
+	// includeForks watches forks found by an expansion, too. Listed repositories are watched either way.
+	includeForks bool
+	// rateLimitReserve is the quota of GitHub's rate limit left for other clients of the token, queries are paused
+	// until the quota is reset once only that much is left.
+	rateLimitReserve int
+	// concurrency is how many workers query the keys of a check at the same time, each one waiting
+	// a random time up to jitter before its queries. Up to 1 the keys are queried one after the other.
+	concurrency int
+	jitter      time.Duration
+	// spread spreads the queries of a check over the time until the next one of schedule.
+	spread   bool
+	schedule *Schedule
+	// triggers tells that webhook events were received, to be checked between the scheduled checks, see Receive.
+	// Events whose check failed are retried webhookRetries times before they are written to the deadLetters file.
+	triggers       chan struct{}
+	webhookRetries int
+	deadLetters    string
+	// pushOnly only checks the repositories of received events after the first check.
+	pushOnly bool
+	// hangups ask to reload the watched repositories between two checks with reload, which returns them.
+	hangups <-chan os.Signal
+	reload  func(repositories []string) []string
+	// skipArchived skips archived repositories found by an expansion.
+	skipArchived bool
+	// filter decides which of the repositories found by an expansion are watched.
+	filter RepositoryFilter
+	// paths returns the paths of the repository whose changes releases are notified for, none for all releases.
+	paths func(repoName string) []string
+	// checks returns how the repository takes the status checks of its releases into account, if at all.
+	checks func(repoName string) string
+	// assets returns the globs of the assets the repository's releases are held back for until they were uploaded.
+	assets func(repoName string) []string
+	// intervals returns how long to wait between checks of the repository, 0 to check it every time.
+	intervals func(repoName string) time.Duration
+	// newnessFor returns the newness strategy of the repository, see NEWNESS_STRATEGY.
+	newnessFor func(repoName string) string
+	// modes returns whether the repository's releases, tags or both are watched, see MODE.
+	modes     func(repoName string) string
+	checkedAt map[string]time.Time
+	// queryTimeout abandons queries taking longer, 0 uses the default timeout of each query.
+	queryTimeout time.Duration
+	// batchSize is how many repositories are queried together, 1 queries them one by one.
+	batchSize   int
+	notifyDelay time.Duration
+	reporter    *Sentry
+	ops         *Ops
+	tracer      *Tracer
+	pending     sync.WaitGroup
+	// secondary pauses all queries while GitHub's secondary rate limit is hit.
+	secondary *SecondaryRateLimit
+	// metadata caches the repositories' details so checks mostly query their releases only.
+	metadata *MetadataCache
+	// prereleases are the last pre-releases seen by base version, see rememberPrerelease.
+	prereleases map[string]string
+	// lifecycles are the repositories' archived states and new names, see noticeChanges.
+	lifecycles map[string]storedLifecycle
+	// notices is told about repositories that got archived or renamed, if set.
+	notices chan<- Notice
+
+	// maxPerCycle caps the notifications of a single cycle, 0 means no cap.
+	// Releases over the cap are marked as seen unless deferSuppressed is set,
+	// in which case they are detected again in the next cycle.
+	maxPerCycle     int
+	deferSuppressed bool
+
+	// notifyRenamed also notifies about releases whose name changed after they were published.
+	notifyRenamed bool
+
+	// cycles is told about the end of every check, if set.
+	cycles chan<- struct{}
+
+	// cycleTimeout bounds how long a check may take, 0 means no bound.
+	// Repositories not checked in time are checked again in the next one.
+	cycleTimeout time.Duration
+}
+
+// Run the queries and comparisons for the given repositories on a schedule until ctx is done,
+// finishing the check running by then as far as ctx allows.
+// With a fixed interval the first check runs right away, with a cron expression at its first time.
+func (c *Checker) Run(ctx context.Context, schedule Schedule, repositories []string, releases chan<- Repository) {
+	if schedule.cron != nil && !c.pushOnly {
+		repositories = c.wait(ctx, time.Until(schedule.Next(time.Now())), repositories, releases)
+	}
+	for ctx.Err() == nil {
+		_ = c.checkRecovered(ctx, repositories, releases)
+		if c.pushOnly {
+			// The first check knows the current releases, the events do the rest.
+			repositories = c.wait(ctx, -1, repositories, releases)
+			continue
+		}
+		next := schedule.Next(time.Now())
+		level.Debug(c.logger).Log("msg", "next check", "at", next)
+		repositories = c.wait(ctx, time.Until(next), repositories, releases)
+	}
+}
+
+// checkRecovered runs a check, logging a panic instead of exiting, so the next check runs as scheduled.
+// It returns the check's error.
+func (c *Checker) checkRecovered(ctx context.Context, repositories []string, releases chan<- Repository) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			level.Error(c.logger).Log("msg", "check failed unexpectedly, retrying with the next one", "panic", r)
+			err = fmt.Errorf("check failed unexpectedly: %v", r)
+		}
+	}()
+	_, err = c.Check(ctx, repositories, releases)
+	return err
 }
 
-// Run the queries and comparisons for the given repositories in a given interval.
-func (c *Checker) Run(interval time.Duration, repositories []string, releases chan<- Repository) {
+// Check runs the queries and comparisons for the given repositories once,
+// leaving the repositories not checked before ctx is done for the next one.
+// It returns the number of new releases found and
+// an error if not all repositories could be checked.
+func (c *Checker) Check(ctx context.Context, repositories []string, releases chan<- Repository) (int, error) {
+	defer c.reporter.Recover(map[string]string{"component": "checker"})
+
 	if c.releases == nil {
 		c.releases = make(map[string]Repository)
 	}
 
-	for {
-		for _, repoName := range repositories {
-			s := strings.Split(repoName, "/")
-			owner, name := s[0], s[1]
+	// Entries like stars:octocat or search:… are expanded every cycle to pick up changes.
+	// Failures are logged and the last expansion is used.
+	repositories, _ = c.expand(repositories)
+
+	cycle := c.tracer.Start(nil, "check")
+	cycle.SetAttribute("repositories", len(repositories))
+	defer cycle.End(nil)
+
+	if c.cycleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cycleTimeout)
+		defer cancel()
+	}
+
+	keys := c.dueKeys(c.keys(repositories), time.Now())
 
-			nextRepo, err := c.query(owner, name)
+	// Releases held back until their checks passed are notified once they did.
+	notified := c.notifyChecked(ctx, releases, 0)
+	notified = c.notifyAttached(ctx, releases, notified)
+	var suppressed, failed int
+	// rejected and unavailable are the keys that failed because of a rejected token or because GitHub couldn't be reached.
+	var rejected, unavailable int
+	// incomplete are the keys not checked before the cycle timed out.
+	var incomplete []string
+	// batch are the results of the last batched query, see queryBatch.
+	var batch map[string]batchResult
+	// pace pauses before every query but the first to spread them over the time until the next check, if the checker does.
+	pause := c.spreadPause(keys)
+	var queried int
+	pace := func() {
+		if queried++; queried == 1 || pause <= 0 {
+			return
+		}
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+		}
+	}
+	// With several workers the keys are queried ahead, all at once, and then processed one after the other.
+	var prefetched map[string]batchResult
+	if c.concurrency > 1 {
+		prefetched = c.prefetch(ctx, cycle, keys)
+	}
+	for i, key := range keys {
+		if ctx.Err() != nil {
+			incomplete = append(incomplete, keys[i:]...)
+			break
+		}
+		repoName := keyRepository(key)
+		owner, name := splitRepoName(repoName)
+
+		span := c.tracer.Start(cycle, "check repository")
+		span.SetAttribute("repository", repoName)
+
+		var nextRepo Repository
+		var err error
+		if result, ok := prefetched[key]; ok {
+			nextRepo, err = result.repository, result.err
+		} else if c.waitForRateLimits(ctx); c.batched(key) {
+			if _, ok := batch[key]; !ok {
+				pace()
+				batch = c.queryBatch(ctx, span, c.nextBatch(keys[i:]))
+			}
+			nextRepo, err = batch[key].repository, batch[key].err
+		} else {
+			pace()
+			nextRepo, err = c.queryKey(ctx, span, key)
+		}
+		if err == errNoReleaseOnLine {
+			span.End(nil)
+			level.Debug(c.logger).Log(
+				"msg", "no recent release on the repository's release line",
+				"owner", owner,
+				"name", name,
+				"line", c.releaseLines[repoName],
+			)
+			continue
+		}
+		if err != nil && ctx.Err() != nil {
+			span.End(err)
+			incomplete = append(incomplete, key)
+			continue
+		}
+		if err != nil && isSecondaryRateLimit(err.Error()) {
+			span.End(err)
+			// The limit may also be reported in a response the transport didn't recognize.
+			if c.secondary != nil && c.secondary.Remaining() == 0 {
+				c.secondary.hit(0)
+			}
+			level.Warn(c.logger).Log(
+				"msg", "hit GitHub's secondary rate limit, backing off",
+				"owner", owner,
+				"name", name,
+				"retry_after", c.secondary.Remaining(),
+				"err", err,
+			)
+			githubErrors.Add("secondary_rate_limit", 1)
+			c.ops.Notify(OpsRateLimited, "secondary", fmt.Sprintf("hit GitHub's secondary rate limit, pausing queries for %s", c.secondary.Remaining()))
+			failed++
+			continue
+		}
+		if err != nil && isPrimaryRateLimit(err.Error()) {
+			span.End(err)
+			primaryRateLimit.exhausted()
+			_, resetAt, _ := primaryRateLimit.Quota()
+			level.Warn(c.logger).Log(
+				"msg", "GitHub's rate limit is exhausted, pausing queries until it is reset",
+				"owner", owner,
+				"name", name,
+				"reset_at", resetAt,
+				"err", err,
+			)
+			githubErrors.Add("rate_limit", 1)
+			c.ops.Notify(OpsRateLimited, "primary", fmt.Sprintf("GitHub's rate limit is exhausted, pausing queries until %s", resetAt.Format(time.RFC3339)))
+			failed++
+			continue
+		}
+		if isUnauthorized(err) {
+			span.End(err)
+			level.Error(c.logger).Log(
+				"msg", "GitHub rejected the token for the repository, it may have expired or been revoked",
+				"owner", owner,
+				"name", name,
+				"err", err,
+			)
+			c.reporter.Repeated("query "+key, errTokenRejected, map[string]string{"repository": repoName})
+			// Repositories sharing GITHUB_TOKEN are notified about once.
+			token := "GITHUB_TOKEN"
+			if _, ok := c.clients[repoName]; ok {
+				token = "token of " + repoName
+			}
+			c.ops.Notify(OpsTokenRejected, token, fmt.Sprintf("GitHub rejected %s for %s, it may have expired or been revoked", token, repoName))
+			githubErrors.Add("token_rejected", 1)
+			failed++
+			rejected++
+			continue
+		}
+		if err != nil {
+			span.End(err)
+			level.Warn(c.logger).Log(
+				"msg", "failed to query the repository's releases",
+				"owner", owner,
+				"name", name,
+				"err", err,
+			)
+			c.reporter.Repeated("query "+key, err, map[string]string{"repository": repoName})
+			githubErrors.Add(errorClass(err), 1)
+			failed++
+			if isUnavailable(err) {
+				unavailable++
+			}
+			continue
+		}
+		c.reporter.Reset("query " + key)
+		if nextRepo.status != nil {
+			c.noticeChanges(repoName, nextRepo, *nextRepo.status)
+		}
+
+		// For debugging uncomment this next line
+		//releases <- nextRepo
+
+		currRepo, ok, err := c.lastSeen(key)
+		if err != nil {
+			level.Warn(c.logger).Log(
+				"msg", "failed to load the repository's last seen release",
+				"owner", owner,
+				"name", name,
+				"err", err,
+			)
+		}
+
+		// We've queried the repository for the first time.
+		// Saving the current state to compare with the next iteration,
+		// notifying about its current release only if asked to.
+		if !ok && !c.backfillSince.IsZero() && key == repoName && c.sources[repoName] == nil {
+			backfilled, err := c.backfill(ctx, owner, name, c.backfillSince.Time(time.Now()))
 			if err != nil {
+				span.End(err)
 				level.Warn(c.logger).Log(
-					"msg", "failed to query the repository's releases",
+					"msg", "failed to query the repository's releases to backfill",
 					"owner", owner,
 					"name", name,
 					"err", err,
 				)
+				failed++
+				continue
+			}
+			span.SetAttribute("releases.found", len(backfilled))
+			span.End(nil)
+			if c.overrides && len(backfilled) > 0 {
+				nextRepo.Overrides = c.overridesFor(owner, name)
+			}
+			var previous *Release
+			sent := len(backfilled)
+			for i := range backfilled {
+				if c.capped(notified) && c.deferSuppressed {
+					suppressed += len(backfilled) - i
+					sent = i
+					break
+				}
+				if c.capped(notified) {
+					suppressed++
+					previous = &backfilled[i]
+					continue
+				}
+				repository := nextRepo
+				repository.span = span
+				repository.Release = backfilled[i]
+				repository.Previous = previous
+				previous = &backfilled[i]
+				c.queryRemainingAssets(ctx, repoName, &repository.Release)
+				notified++
+				releases <- repository
+			}
+			// Deferring the releases over the cap, the last one sent is remembered so the others are found again,
+			// without any sent the repository is backfilled again.
+			if sent < len(backfilled) {
+				if sent > 0 {
+					repository := nextRepo
+					repository.Release = backfilled[sent-1]
+					c.remember(key, repository)
+				}
+				continue
+			}
+			c.remember(key, nextRepo)
+			c.rememberPrerelease(key, nextRepo.Release)
+			continue
+		}
+		if !ok {
+			notify := c.initialNotify != nil && c.initialNotify(repoName)
+			if notify && c.capped(notified) {
+				suppressed++
+				if c.deferSuppressed {
+					span.End(nil)
+					continue
+				}
+				notify = false
+			}
+			c.remember(key, nextRepo)
+			c.rememberPrerelease(key, nextRepo.Release)
+			if notify {
+				span.SetAttribute("releases.found", 1)
+				span.End(nil)
+				nextRepo.span = span
+				if c.overrides {
+					nextRepo.Overrides = c.overridesFor(owner, name)
+				}
+				c.queryRemainingAssets(ctx, repoName, &nextRepo.Release)
+				notified++
+				releases <- nextRepo
 				continue
 			}
+			span.End(nil)
+			continue
+		}
 
-			// For debugging uncomment this next line
-			//releases <- nextRepo
+		isNewer := c.isNewer(repoName, nextRepo.Release, currRepo.Release)
+		if isNewer {
+			span.SetAttribute("releases.found", 1)
+		} else {
+			span.SetAttribute("releases.found", 0)
+		}
+		span.End(nil)
+		nextRepo.span = span
+		previous := currRepo.Release
+		nextRepo.Previous = &previous
 
-			currRepo, ok := c.releases[repoName]
+		if isNewer {
+			// Watching both, the release of a tag was notified already, its key is checked first.
+			if key == repoName+tagsSuffix {
+				if release, ok := c.releases[repoName]; ok && release.Release.TagName == nextRepo.Release.TagName {
+					c.remember(key, nextRepo)
+					continue
+				}
+			}
+			if c.overrides {
+				nextRepo.Overrides = c.overridesFor(owner, name)
+			}
 
-			// We've queried the repository for the first time.
-			// Saving the current state to compare with the next iteration.
-			if !ok {
-				c.releases[repoName] = nextRepo
+			// Catching up, the releases published since the last seen one are notified before it, the oldest first,
+			// each one held back and skipped like the latest one.
+			pending := []Repository{nextRepo}
+			if c.catchUp && key == repoName && c.sources[repoName] == nil && !(c.capped(notified) && c.deferSuppressed) {
+				missed := c.missedReleases(ctx, owner, name, nextRepo.Release, currRepo.Release)
+				pending = make([]Repository, 0, len(missed)+1)
+				for _, release := range missed {
+					repository := nextRepo
+					repository.Release = release
+					repository.caughtUp = true
+					pending = append(pending, repository)
+				}
+				pending = append(pending, nextRepo)
+			}
+			// seen is the last of them notified or, over the cap and not deferring, skipped.
+			var seen *Repository
+			previous := currRepo.Release
+			for i := range pending {
+				repository := pending[i]
+				last := previous
+				repository.Previous = &last
+				previous = repository.Release
+				latest := i == len(pending)-1
+				if key == repoName && !c.changesWatchedPaths(ctx, repoName, repository.Release, last) {
+					if latest {
+						c.rememberPrerelease(key, repository.Release)
+					}
+					seen = &repository
+					continue
+				}
+				if c.capped(notified) && c.deferSuppressed {
+					suppressed += len(pending) - i
+					break
+				}
+				seen = &repository
+				if c.capped(notified) {
+					suppressed++
+					continue
+				}
+				notified++
+				if latest {
+					repository.PromotedFrom = c.promotedFrom(key, repository.Release, currRepo.Release)
+					c.rememberPrerelease(key, repository.Release)
+				}
+				c.queryRemainingAssets(ctx, repoName, &repository.Release)
+				c.countCommits(ctx, repoName, &repository)
+				switch {
+				case !c.assetsAttached(key, &repository):
+				case !c.readyToNotify(ctx, key, &repository):
+				case c.notifyDelay > 0:
+					c.notifyLater(repository, releases)
+				default:
+					releases <- repository
+				}
+			}
+			if seen != nil {
+				c.remember(key, *seen)
+			}
+		} else if renamed(nextRepo.Release, currRepo.Release) {
+			level.Debug(c.logger).Log(
+				"msg", "release was renamed",
+				"owner", owner,
+				"name", name,
+				"release", nextRepo.Release.Key(),
+				"from", currRepo.Release.Name,
+				"to", nextRepo.Release.Name,
+			)
+			notify := c.notifyRenamed && c.strategy(repoName) != NewnessCreatedAfterLastSeen
+			if notify && c.capped(notified) {
+				suppressed++
+				if c.deferSuppressed {
+					continue
+				}
+				notify = false
+			}
+			// The name is remembered either way, unless deferred, so a rename is only seen once.
+			c.remember(key, nextRepo)
+			if !notify {
 				continue
 			}
-
-			if nextRepo.Release.PublishedAt.After(currRepo.Release.PublishedAt) {
-				releases <- nextRepo
-				c.releases[repoName] = nextRepo
-			} else {
-				level.Debug(c.logger).Log(
-					"msg", "no new release for repository",
-					"owner", owner,
-					"name", name,
-				)
+			c.queryRemainingAssets(ctx, repoName, &nextRepo.Release)
+			notified++
+			nextRepo.Renamed = true
+			if c.overrides {
+				nextRepo.Overrides = c.overridesFor(owner, name)
 			}
+			releases <- nextRepo
+		} else if c.strategy(repoName) == NewnessCreatedAfterLastSeen && currRepo.Release.CreatedAt.IsZero() {
+			// Last seen releases stored without their creation time get it, so later releases can be compared.
+			c.remember(key, nextRepo)
+			level.Debug(c.logger).Log(
+				"msg", "last seen release has no creation time, not notifying",
+				"owner", owner,
+				"name", name,
+				"release", nextRepo.Release.Key(),
+			)
+		} else {
+			level.Debug(c.logger).Log(
+				"msg", "no new release for repository",
+				"owner", owner,
+				"name", name,
+			)
+		}
+	}
+	if suppressed > 0 {
+		level.Warn(c.logger).Log(
+			"msg", "too many new releases in one cycle, suppressed notifications",
+			"max", c.maxPerCycle,
+			"suppressed", suppressed,
+			"deferred", c.deferSuppressed,
+		)
+	}
+
+	if len(incomplete) > 0 && errors.Is(ctx.Err(), context.Canceled) {
+		level.Info(c.logger).Log(
+			"msg", "check stopped, repositories are checked in the next one",
+			"incomplete", strings.Join(incomplete, ","),
+		)
+	} else if len(incomplete) > 0 {
+		level.Warn(c.logger).Log(
+			"msg", "check timed out, repositories are checked in the next one",
+			"timeout", c.cycleTimeout,
+			"incomplete", strings.Join(incomplete, ","),
+		)
+	}
+
+	// With batched writes the state of the whole cycle is written at once.
+	if c.store != nil {
+		if err := c.store.Flush(); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to write state", "err", err)
+		}
+	}
+
+	checksPerformed.Add(1)
+	releasesDetected.Add(int64(notified))
+	if remaining, resetAt, ok := primaryRateLimit.Quota(); ok {
+		level.Debug(c.logger).Log("msg", "check done", "releases", notified, "rate_limit_remaining", remaining, "rate_limit_reset_at", resetAt)
+	}
+
+	if c.cycles != nil {
+		c.cycles <- struct{}{}
+	}
+
+	if failed += len(incomplete); failed > 0 {
+		// The cause is kept if it is the same for all failed repositories, see the exit codes.
+		switch failed {
+		case rejected:
+			return notified, fmt.Errorf("failed to check %d of %d repositories: %w", failed, len(keys), errTokenRejected)
+		case unavailable:
+			return notified, fmt.Errorf("failed to check %d of %d repositories: %w", failed, len(keys), errGitHubUnavailable)
 		}
-		time.Sleep(interval)
+		return notified, fmt.Errorf("failed to check %d of %d repositories", failed, len(keys))
 	}
+	return notified, nil
 }
 
-// This should be improved in the future to make batch requests for all watched repositories at once
-// TODO: https://github.com/shurcooL/githubql/issues/17
+// waitForRateLimits pauses while GitHub's secondary rate limit lasts or its primary rate limit's quota is used up.
+func (c *Checker) waitForRateLimits(ctx context.Context) {
+	if wait := c.secondary.Remaining(); wait > 0 {
+		level.Warn(c.logger).Log(
+			"msg", "pausing queries because of GitHub's secondary rate limit",
+			"wait", wait,
+		)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+	if wait := primaryRateLimit.Wait(c.rateLimitReserve); wait > 0 {
+		remaining, resetAt, _ := primaryRateLimit.Quota()
+		level.Warn(c.logger).Log(
+			"msg", "pausing queries until GitHub's rate limit is reset",
+			"remaining", remaining,
+			"reset_at", resetAt,
+		)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// spreadPause returns the pause between two queries of the keys to spread them over 90% of the time
+// until the next check, 0 if the checker doesn't spread them. Repositories are estimated to be queried in full batches.
+func (c *Checker) spreadPause(keys []string) time.Duration {
+	if !c.spread || c.schedule == nil {
+		return 0
+	}
+	var batched, queries int
+	for _, key := range keys {
+		if key == keyRepository(key) && c.batchSize > 1 {
+			batched++
+		} else {
+			queries++
+		}
+	}
+	if batched > 0 {
+		queries += (batched + c.batchSize - 1) / c.batchSize
+	}
+	if queries <= 1 {
+		return 0
+	}
+	window := time.Until(c.schedule.Next(time.Now())) * 9 / 10
+	return window / time.Duration(queries-1)
+}
+
+// keys returns the keys to check of the expanded repositories.
+// Discussions announcements are checked like the releases of
+// another repository, remembered under their own key.
+// Tags of actions come with their own key from expanding.
+func (c *Checker) keys(repositories []string) []string {
+	keys := make([]string, 0, len(repositories))
+	for _, repoName := range repositories {
+		mode := ModeReleases
+		if c.modes != nil && !strings.Contains(repoName, "#") {
+			mode = c.modes(repoName)
+		}
+		if mode != ModeTags {
+			keys = append(keys, repoName)
+		}
+		if mode != ModeReleases {
+			keys = append(keys, repoName+tagsSuffix)
+		}
+		if _, ok := c.discussions[repoName]; ok {
+			keys = append(keys, repoName+discussionsSuffix)
+		}
+	}
+	return keys
+}
+
+// dueKeys returns the keys whose repositories are due to be checked at now,
+// those with an interval of their own only once it passed since their last check.
+func (c *Checker) dueKeys(keys []string, now time.Time) []string {
+	if c.intervals == nil {
+		return keys
+	}
+	if c.checkedAt == nil {
+		c.checkedAt = make(map[string]time.Time)
+	}
+
+	due := keys[:0:0]
+	for _, key := range keys {
+		interval := c.intervals(keyRepository(key))
+		if interval > 0 && now.Sub(c.checkedAt[key]) < interval {
+			continue
+		}
+		c.checkedAt[key] = now
+		due = append(due, key)
+	}
+	return due
+}
+
+// queryKey queries the latest release, tag or discussions announcement of the key on its own.
+func (c *Checker) queryKey(ctx context.Context, span *Span, key string) (Repository, error) {
+	repoName := keyRepository(key)
+	if source, ok := c.sources[repoName]; ok {
+		return c.querySource(ctx, span, source, key)
+	}
+	owner, name := splitRepoName(repoName)
+
+	switch key {
+	case repoName:
+		return c.query(ctx, span, owner, name)
+	case repoName + tagsSuffix:
+		span.SetAttribute("tags", true)
+		return c.queryTags(ctx, span, owner, name)
+	default:
+		span.SetAttribute("discussions", c.discussions[repoName])
+		return c.queryDiscussions(ctx, span, owner, name, c.discussions[repoName])
+	}
+}
+
+// keyRepository returns the repository's owner/name of a key like owner/name#discussions.
+func keyRepository(key string) string {
+	if i := strings.Index(key, "#"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// renamed returns true if next is the same release as curr under a new name.
+// Releases remembered without a name weren't renamed as far as we know.
+func renamed(next, curr Release) bool {
+	return next.Key() == curr.Key() && curr.Name != "" && next.Name != curr.Name
+}
+
+// strategy returns the newness strategy of the repository given as owner/name.
+func (c *Checker) strategy(repoName string) string {
+	if c.newnessFor != nil {
+		return c.newnessFor(repoName)
+	}
+	return c.newness
+}
+
+// isNewer returns true if next is newer than curr according to the repository's newness strategy.
+func (c *Checker) isNewer(repoName string, next, curr Release) bool {
+	switch c.strategy(repoName) {
+	case NewnessSemver:
+		nextVersion, nextErr := next.Version()
+		currVersion, currErr := curr.Version()
+		if nextErr == nil && currErr == nil {
+			return nextVersion.Compare(currVersion) > 0
+		}
+		// Without semantic versions we can only go by publish time.
+		level.Debug(c.logger).Log(
+			"msg", "can't compare releases as semantic versions, comparing publish time",
+			"next", next.TagName,
+			"current", curr.TagName,
+		)
+	case NewnessCreated:
+		return next.CreatedAt.After(curr.CreatedAt)
+	case NewnessCreatedAfterLastSeen:
+		return next.Key() != curr.Key() && !curr.CreatedAt.IsZero() && next.CreatedAt.After(curr.CreatedAt)
+	}
+	return next.PublishedAt.After(curr.PublishedAt)
+}
+
+// Wait blocks until all releases held back for the notify delay were sent.
+func (c *Checker) Wait() {
+	c.pending.Wait()
+}
+
+// lastSeen returns the repository with the release seen last,
+// falling back to the store for repositories not seen since the start.
+func (c *Checker) lastSeen(key string) (Repository, bool, error) {
+	if repository, ok := c.releases[key]; ok {
+		return repository, true, nil
+	}
+	if c.store == nil {
+		return Repository{}, false, nil
+	}
+
+	var stored storedRelease
+	ok, err := c.store.Get(releaseKey(key), &stored)
+	if !ok || err != nil {
+		return Repository{}, false, err
+	}
+
+	repository := Repository{
+		Release: Release{
+			ID:          stored.ID,
+			Name:        stored.Name,
+			TagName:     stored.TagName,
+			PublishedAt: stored.PublishedAt,
+			CreatedAt:   stored.CreatedAt,
+		},
+	}
+	c.releases[key] = repository
+	return repository, true, nil
+}
+
+// remember the repository's current release as the last seen one.
+func (c *Checker) remember(key string, repository Repository) {
+	c.releases[key] = repository
+	if c.store == nil {
+		return
+	}
+
+	err := c.store.Put(releaseKey(key), storedRelease{
+		ID:          repository.Release.ID,
+		Name:        repository.Release.Name,
+		TagName:     repository.Release.TagName,
+		PublishedAt: repository.Release.PublishedAt,
+		CreatedAt:   repository.Release.CreatedAt,
+	})
+	if err != nil {
+		level.Warn(c.logger).Log(
+			"msg", "failed to store the repository's last seen release",
+			"repository", key,
+			"err", err,
+		)
+	}
+}
+
+// capped returns true if the cycle's cap is reached with the releases notified in it so far, see maxPerCycle.
+func (c *Checker) capped(notified int) bool {
+	return c.maxPerCycle > 0 && notified >= c.maxPerCycle
+}
+
+// notifyLater holds back a newly detected release for the notify delay
+// and only sends it if it still exists afterwards.
+// This way releases that get published and deleted right away are never notified.
+func (c *Checker) notifyLater(repository Repository, releases chan<- Repository) {
+	level.Debug(c.logger).Log(
+		"msg", "holding back release until notify delay passed",
+		"owner", repository.Owner,
+		"name", repository.Name,
+		"release", repository.Release.TagName,
+		"delay", c.notifyDelay,
+	)
+
+	c.pending.Add(1)
+	time.AfterFunc(c.notifyDelay, func() {
+		defer c.pending.Done()
+
+		exists, err := c.releaseExists(repository.Owner, repository.Name, repository.Release)
+		if err != nil {
+			level.Warn(c.logger).Log(
+				"msg", "failed to confirm held back release, notifying anyway",
+				"owner", repository.Owner,
+				"name", repository.Name,
+				"release", repository.Release.TagName,
+				"err", err,
+			)
+		} else if !exists {
+			level.Info(c.logger).Log(
+				"msg", "release disappeared during notify delay, not notifying",
+				"owner", repository.Owner,
+				"name", repository.Name,
+				"release", repository.Release.TagName,
+			)
+			return
+		}
+		releases <- repository
+	})
+}
+
+// releaseExists returns true if the release still exists.
+func (c *Checker) releaseExists(owner, name string, release Release) (bool, error) {
+	if source, ok := c.sources[owner+"/"+name]; ok {
+		return sourceReleaseExists(source, owner, name, release)
+	}
 
-func (c *Checker) query(owner, name string) (Repository, error) {
 	var query struct {
-		Repository struct {
-			ID          githubql.ID
-			Name        githubql.String
-			Description githubql.String
-			URL         githubql.URI
-
-			Releases struct {
-				Edges []struct {
-					Node struct {
-						ID          githubql.ID
-						Name        githubql.String
-						Description githubql.String
-						URL         githubql.URI
-						PublishedAt githubql.DateTime
-					}
-				}
-			} `graphql:"releases(last: 1)"`
-		} `graphql:"repository(owner: $owner, name: $name)"`
+		Node *struct {
+			ID githubql.ID
+		} `graphql:"node(id: $id)"`
 	}
 
 	variables := map[string]interface{}{
-		"owner": githubql.String(owner),
-		"name":  githubql.String(name),
+		"id": githubql.ID(release.ID),
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := c.client.Query(ctx, &query, variables); err != nil {
-		return Repository{}, err
+	if err := c.clientFor(owner+"/"+name).Query(ctx, &query, variables); err != nil {
+		return false, err
 	}
 
-	repositoryID, ok := query.Repository.ID.(string)
-	if !ok {
-		return Repository{}, fmt.Errorf("can't convert repository id to string: %v", query.Repository.ID)
+	return query.Node != nil, nil
+}
+
+// clientFor returns the client with access to the repository,
+// falling back to the client with the global token.
+func (c *Checker) clientFor(repoName string) *githubql.Client {
+	if client, ok := c.clients[repoName]; ok {
+		return client
+	}
+	return c.client
+}
+
+// timeout returns how long a query may take, the configured query timeout if there is one,
+// otherwise the default d of the query.
+func (c *Checker) timeout(d time.Duration) time.Duration {
+	if c.queryTimeout > 0 {
+		return c.queryTimeout
+	}
+	return d
+}
+
+// tolerate returns nil for the errors GitHub returned alongside the data of the repository
+// if decoded says that data is there, logging them instead, and returns other errors as they are.
+func (c *Checker) tolerate(err error, repoName string, decoded bool) error {
+	if err == nil || !decoded || !isQueryErrors(err) {
+		return err
 	}
+	level.Warn(c.logger).Log(
+		"msg", "query returned errors alongside the releases, using the partial result",
+		"repository", repoName,
+		"err", err,
+	)
+	return nil
+}
+
+// isUnavailable returns true if the query failed because GitHub couldn't be reached or didn't answer in time.
+func isUnavailable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isQueryErrors returns true if err is the list of errors in a GraphQL response,
+// rather than one of the request, e.g. a timeout.
+func isQueryErrors(err error) bool {
+	// The client's type of the errors isn't exported, see batchError.
+	return reflect.ValueOf(err).Kind() == reflect.Slice
+}
+
+// releaseAuthor is who published a release or discussion, null for tags and deleted users.
+type releaseAuthor struct {
+	Login     githubql.String
+	AvatarURL githubql.URI
+	URL       githubql.URI
+}
+
+// set sets the release's author, if there is one.
+func (a *releaseAuthor) set(release *Release) {
+	if a == nil {
+		return
+	}
+	release.Author = string(a.Login)
+	if a.AvatarURL.URL != nil {
+		release.AuthorAvatarURL = a.AvatarURL.String()
+	}
+	if a.URL.URL != nil {
+		release.AuthorURL = a.URL.String()
+	}
+}
+
+// releaseEdges are the most recent releases of a repository, the latest one last.
+type releaseEdges struct {
+	Edges []struct {
+		Node releaseNode
+	}
+}
+
+// releaseNode is a release as queried.
+type releaseNode struct {
+	ID            githubql.ID
+	Name          githubql.String
+	TagName       githubql.String
+	IsPrerelease  githubql.Boolean
+	Description   githubql.String
+	URL           githubql.URI
+	PublishedAt   githubql.DateTime
+	CreatedAt     githubql.DateTime
+	Author        *releaseAuthor
+	ReleaseAssets releaseAssets `graphql:"releaseAssets(first: 20)"`
+}
+
+// releaseAssets are a page of a release's assets as queried.
+type releaseAssets struct {
+	Nodes []struct {
+		Name          githubql.String
+		DownloadURL   githubql.URI
+		DownloadCount githubql.Int
+	}
+	PageInfo struct {
+		EndCursor   githubql.String
+		HasNextPage githubql.Boolean
+	}
+}
+
+// add appends the page's assets to the release's, keeping where the page ends if there are more.
+func (a releaseAssets) add(release *Release) {
+	for _, asset := range a.Nodes {
+		release.Assets = append(release.Assets, Asset{
+			Name:      string(asset.Name),
+			URL:       *asset.DownloadURL.URL,
+			Downloads: int(asset.DownloadCount),
+		})
+	}
+	release.assetsCursor = ""
+	if a.PageInfo.HasNextPage {
+		release.assetsCursor = string(a.PageInfo.EndCursor)
+	}
+}
+
+func (c *Checker) query(ctx context.Context, span *Span, owner, name string) (Repository, error) {
+	repoName := owner + "/" + name
+	currentOwner, currentName := c.currentName(repoName)
+
+	// With a release line the latest release may be on another one,
+	// so look at the recent releases for the latest on the line.
+	count := 1
+	if _, hasLine := c.releaseLines[repoName]; hasLine {
+		count = releaseLineLookback
+	}
+
+	variables := map[string]interface{}{
+		"owner":    githubql.String(currentOwner),
+		"name":     githubql.String(currentName),
+		"releases": githubql.Int(count),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout(5*time.Second))
+	defer cancel()
 
-	if len(query.Repository.Releases.Edges) == 0 {
+	// The repository's own details are only queried until they are cached.
+	var releases releaseEdges
+	var status repositoryStatus
+	var limit rateLimit
+	metadata, cached := c.metadata.Get(repoName)
+	if cached {
+		var query struct {
+			RateLimit  rateLimit
+			Repository struct {
+				repositoryStatus
+				Releases releaseEdges `graphql:"releases(last: $releases)"`
+			} `graphql:"repository(owner: $owner, name: $name)"`
+		}
+		err := c.clientFor(repoName).Query(ctx, &query, variables)
+		releases, status, limit = query.Repository.Releases, query.Repository.repositoryStatus, query.RateLimit
+		if err = c.tolerate(err, repoName, len(releases.Edges) > 0); err != nil {
+			return Repository{}, err
+		}
+	} else {
+		var query struct {
+			RateLimit  rateLimit
+			Repository struct {
+				repositoryFields
+				repositoryStatus
+				Releases releaseEdges `graphql:"releases(last: $releases)"`
+			} `graphql:"repository(owner: $owner, name: $name)"`
+		}
+		err := c.clientFor(repoName).Query(ctx, &query, variables)
+		releases, status, limit = query.Repository.Releases, query.Repository.repositoryStatus, query.RateLimit
+		if err = c.tolerate(err, repoName, len(releases.Edges) > 0 && query.Repository.URL.URL != nil); err != nil {
+			return Repository{}, err
+		}
+
+		if metadata, err = newRepositoryMetadata(query.Repository.repositoryFields); err != nil {
+			return Repository{}, err
+		}
+		c.metadata.Put(repoName, metadata)
+	}
+	limit.record(span)
+	span.SetAttribute("metadata.cached", cached)
+
+	return c.latestRelease(owner, name, metadata, status, releases)
+}
+
+// latestRelease returns the repository with its latest release among the queried ones,
+// the latest on its release line if it has one.
+func (c *Checker) latestRelease(owner, name string, metadata RepositoryMetadata, status repositoryStatus, releases releaseEdges) (Repository, error) {
+	line, hasLine := c.releaseLines[owner+"/"+name]
+	edges := releases.Edges
+	if len(edges) == 0 {
 		return Repository{}, fmt.Errorf("can't find any releases for %s/%s", owner, name)
 	}
-	latestRelease := query.Repository.Releases.Edges[0].Node
+	latestRelease := edges[len(edges)-1].Node
+	if hasLine {
+		found := false
+		for i := len(edges) - 1; i >= 0 && !found; i-- {
+			version, err := ParseVersion(string(edges[i].Node.TagName))
+			if err == nil && line.Contains(version) {
+				latestRelease, found = edges[i].Node, true
+			}
+		}
+		if !found {
+			return Repository{}, errNoReleaseOnLine
+		}
+	}
 
-	releaseID, ok := latestRelease.ID.(string)
-	if !ok {
-		return Repository{}, fmt.Errorf("can't convert release id to string: %v", query.Repository.ID)
+	release, err := newRelease(latestRelease)
+	if err != nil {
+		return Repository{}, err
 	}
 
 	return Repository{
-		ID:          repositoryID,
-		Name:        string(query.Repository.Name),
-		Owner:       owner,
-		Description: string(query.Repository.Description),
-		URL:         *query.Repository.URL.URL,
-
-		Release: Release{
-			ID:          releaseID,
-			Name:        string(latestRelease.Name),
-			Description: string(latestRelease.Description),
-			URL:         *latestRelease.URL.URL,
-			PublishedAt: latestRelease.PublishedAt.Time,
-		},
+		ID:            metadata.ID,
+		Name:          metadata.Name,
+		Owner:         owner,
+		Description:   metadata.Description,
+		URL:           metadata.URL,
+		DefaultBranch: metadata.DefaultBranch,
+		Release:       release,
+		status:        &status,
 	}, nil
 }
+
+// newRelease converts the queried release.
+func newRelease(node releaseNode) (Release, error) {
+	releaseID, ok := node.ID.(string)
+	if !ok {
+		return Release{}, fmt.Errorf("can't convert release id to string: %v", node.ID)
+	}
+
+	release := Release{
+		ID:           releaseID,
+		Name:         string(node.Name),
+		TagName:      string(node.TagName),
+		IsPrerelease: bool(node.IsPrerelease),
+		Description:  string(node.Description),
+		URL:          *node.URL.URL,
+		PublishedAt:  node.PublishedAt.Time,
+		CreatedAt:    node.CreatedAt.Time,
+	}
+	node.ReleaseAssets.add(&release)
+	node.Author.set(&release)
+	return release, nil
+}
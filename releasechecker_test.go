@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// releasesPublished is when the first of the test releases was published, the others follow an hour apart.
+var releasesPublished = time.Date(2020, 2, 25, 12, 0, 0, 0, time.UTC)
+
+func releaseNodeJSON(tag string, i int) map[string]interface{} {
+	published := releasesPublished.Add(time.Duration(i) * time.Hour).Format(time.RFC3339)
+	return map[string]interface{}{
+		"id":            "release-" + tag,
+		"name":          tag,
+		"tagName":       tag,
+		"url":           "https://github.com/octocat/hello/releases/tag/" + tag,
+		"publishedAt":   published,
+		"createdAt":     published,
+		"releaseAssets": map[string]interface{}{"nodes": []interface{}{}},
+	}
+}
+
+// newReleasesChecker returns a checker whose queries are answered with the releases of the tags for every repository,
+// the oldest first: the latest release, or all of them for queries of the releases published since some time.
+func newReleasesChecker(t *testing.T, tags []string) *Checker {
+	t.Helper()
+	return newInboxChecker(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string
+			Variables struct{ Owner, Name string }
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var repository map[string]interface{}
+		switch {
+		case strings.Contains(body.Query, "releases(first:"):
+			var nodes []interface{}
+			for i := len(tags) - 1; i >= 0; i-- {
+				nodes = append(nodes, releaseNodeJSON(tags[i], i))
+			}
+			repository = map[string]interface{}{
+				"releases": map[string]interface{}{"nodes": nodes, "pageInfo": map[string]interface{}{"hasNextPage": false}},
+			}
+		case strings.Contains(body.Query, "releases(last:"):
+			repoName := body.Variables.Owner + "/" + body.Variables.Name
+			latest := len(tags) - 1
+			repository = map[string]interface{}{
+				"id":               repoName,
+				"name":             body.Variables.Name,
+				"url":              "https://github.com/" + repoName,
+				"defaultBranchRef": map[string]interface{}{"name": "main"},
+				"nameWithOwner":    repoName,
+				"releases": map[string]interface{}{"edges": []interface{}{
+					map[string]interface{}{"node": releaseNodeJSON(tags[latest], latest)},
+				}},
+			}
+		default:
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"repository": repository}})
+	})
+}
+
+// checkTags runs a check of the repositories, octocat/hello without any, and returns the tags of the releases it notified.
+func checkTags(t *testing.T, c *Checker, repositories ...string) []string {
+	t.Helper()
+	if len(repositories) == 0 {
+		repositories = []string{"octocat/hello"}
+	}
+	releases := make(chan Repository, 10)
+	if _, err := c.Check(context.Background(), repositories, releases); err != nil {
+		t.Fatal(err)
+	}
+	close(releases)
+	var tags []string
+	for repository := range releases {
+		tags = append(tags, repository.Release.TagName)
+	}
+	return tags
+}
+
+func TestCheckCapsNotifications(t *testing.T) {
+	tags := []string{"v1.0.0", "v1.1.0", "v1.2.0", "v1.3.0"}
+	tests := []struct {
+		name        string
+		maxPerCycle int
+		deferred    bool
+		backfill    bool
+		// want are the tags notified in the first cycle and then the second.
+		want [2][]string
+	}{
+		{"catching up", 0, false, false, [2][]string{{"v1.1.0", "v1.2.0", "v1.3.0"}, nil}},
+		{"catching up over the cap", 2, false, false, [2][]string{{"v1.1.0", "v1.2.0"}, nil}},
+		{"catching up over the cap deferred", 2, true, false, [2][]string{{"v1.1.0", "v1.2.0"}, {"v1.3.0"}}},
+		{"backfilling", 0, false, true, [2][]string{tags, nil}},
+		{"backfilling over the cap", 2, false, true, [2][]string{{"v1.0.0", "v1.1.0"}, nil}},
+		{"backfilling over the cap deferred", 2, true, true, [2][]string{{"v1.0.0", "v1.1.0"}, {"v1.2.0", "v1.3.0"}}},
+		{"backfilling deferred all", 1, true, true, [2][]string{{"v1.0.0"}, {"v1.1.0"}}},
+	}
+	for _, tt := range tests {
+		c := newReleasesChecker(t, tags)
+		c.catchUp = true
+		c.maxPerCycle = tt.maxPerCycle
+		c.deferSuppressed = tt.deferred
+		if tt.backfill {
+			c.backfillSince = Since{at: releasesPublished.Add(-time.Minute)}
+		} else {
+			c.releases = map[string]Repository{}
+			c.remember("octocat/hello", Repository{Release: Release{TagName: "v1.0.0", PublishedAt: releasesPublished}})
+		}
+
+		for cycle, want := range tt.want {
+			if got := checkTags(t, c); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%s: cycle %d notified %v, want %v", tt.name, cycle+1, got, want)
+			}
+		}
+	}
+}
+
+func TestCheckCapsInitialNotifications(t *testing.T) {
+	for _, deferred := range []bool{false, true} {
+		c := newReleasesChecker(t, []string{"v1.0.0"})
+		c.initialNotify = func(string) bool { return true }
+		c.maxPerCycle = 1
+		c.deferSuppressed = deferred
+		repositories := []string{"octocat/hello", "octocat/world"}
+
+		if got := checkTags(t, c, repositories...); len(got) != 1 {
+			t.Errorf("deferred %t: first cycle notified %v, want one release", deferred, got)
+		}
+		want := 0
+		if deferred {
+			want = 1
+		}
+		if got := checkTags(t, c, repositories...); len(got) != want {
+			t.Errorf("deferred %t: second cycle notified %v, want %d releases", deferred, got, want)
+		}
+	}
+}
+
+func TestCheckHoldsBackCaughtUpReleases(t *testing.T) {
+	c := newReleasesChecker(t, []string{"v1.0.0", "v1.1.0", "v1.2.0", "v1.3.0"})
+	c.catchUp = true
+	c.maxPerCycle = 2
+	c.assets = func(string) []string { return []string{"*.tar.gz"} }
+	c.releases = map[string]Repository{}
+	c.remember("octocat/hello", Repository{Release: Release{TagName: "v1.0.0", PublishedAt: releasesPublished}})
+
+	if got := checkTags(t, c); len(got) != 0 {
+		t.Errorf("notified %v, want all releases held back for their assets", got)
+	}
+	// Held back releases count towards the cap, the latest one is over it.
+	want := []string{assetsKey("octocat/hello#v1.1.0"), assetsKey("octocat/hello#v1.2.0")}
+	if got := mustKeys(t, c.store, assetsKeyPrefix); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("held back %v, want %v", got, want)
+	}
+	if seen := c.releases["octocat/hello"].Release.TagName; seen != "v1.3.0" {
+		t.Errorf("last seen %s, want v1.3.0", seen)
+	}
+}
+
+func TestCheckAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "state.json")
+
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{"first run", []string{"v1.0.0"}, nil},
+		{"restart without releases", []string{"v1.0.0"}, nil},
+		{"restart after releases", []string{"v1.0.0", "v1.1.0", "v1.2.0"}, []string{"v1.1.0", "v1.2.0"}},
+	}
+	for _, tt := range tests {
+		c := newReleasesChecker(t, tt.tags)
+		c.catchUp = true
+		if c.store, err = NewFileStore(path, ""); err != nil {
+			t.Fatal(err)
+		}
+		if got := checkTags(t, c); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: notified %v, want %v", tt.name, got, tt.want)
+		}
+		if err := c.store.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
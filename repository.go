@@ -1,6 +1,9 @@
 package main
 
-import "net/url"
+import (
+	"net/url"
+	"strings"
+)
 
 // Repository on GitHub.
 type Repository struct {
@@ -9,5 +12,62 @@ type Repository struct {
 	Owner       string
 	Description string
 	URL         url.URL
-	Release     Release
+	// DefaultBranch is only known for repositories checked for their releases.
+	DefaultBranch string
+	Release       Release
+	// Previous is the release seen before Release, if known.
+	Previous *Release
+	// Commits is the number of commits from Previous's tag to Release's, 0 if unknown.
+	Commits int
+	// Renamed is true if the release was seen before under the name of Previous
+	// and only its name changed since.
+	Renamed bool
+	// PromotedFrom is the tag of the pre-release seen before of the release's stable version,
+	// like v2.0.0-rc.3 of v2.0.0.
+	PromotedFrom string
+	// Overrides are the repository's own notification preferences, if it has any.
+	Overrides *RepoOverrides
+
+	// span of the check that found the release, to trace sending it.
+	span *Span
+	// status of the repository when the release was found, if known.
+	status *repositoryStatus
+	// delivered are the senders and their destinations, like slack:team-a, that delivered the release
+	// in earlier attempts, see DeliveryLog.
+	delivered []string
+	// caughtUp is true for releases published before the latest one, notified catching up, see heldKey.
+	caughtUp bool
+}
+
+// ChangeLevel returns the semantic version change level from the previous release, see ChangeLevel.
+// It returns an empty string if there is no previous release or the versions aren't semantic.
+func (r Repository) ChangeLevel() string {
+	if r.Previous == nil {
+		return ""
+	}
+	prev, err := r.Previous.Version()
+	if err != nil {
+		return ""
+	}
+	next, err := r.Release.Version()
+	if err != nil {
+		return ""
+	}
+	return ChangeLevel(prev, next)
+}
+
+// CompareURL returns the link to the comparison of the previous release's tag with the release's,
+// an empty string if there is no previous release or either has no tag.
+func (r Repository) CompareURL() string {
+	if r.Previous == nil || r.Previous.TagName == "" || r.Release.TagName == "" || r.Previous.TagName == r.Release.TagName {
+		return ""
+	}
+	page := "/compare/"
+	// GitLab's pages of a project are below /-/.
+	if strings.HasPrefix(r.ID, gitlabPrefix) {
+		page = "/-/compare/"
+	}
+	compare := r.URL
+	compare.Path = strings.TrimSuffix(compare.Path, "/") + page + r.Previous.TagName + "..." + r.Release.TagName
+	return compare.String()
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"foo * * * *",
+		"@fortnightly",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2021-03-10 is a Wednesday.
+	from := time.Date(2021, 3, 10, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2021, 3, 10, 10, 31, 0, 0, time.UTC)},
+		// A check finishing right at a matching time runs at the next one.
+		{"* * * * *", time.Date(2021, 3, 10, 10, 31, 0, 0, time.UTC), time.Date(2021, 3, 10, 10, 32, 0, 0, time.UTC)},
+		{"0 * * * *", from, time.Date(2021, 3, 10, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", from, time.Date(2021, 3, 10, 11, 0, 0, 0, time.UTC)},
+		{"@daily", from, time.Date(2021, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", from, time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", from, time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"@YEARLY", from, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2021, 3, 10, 10, 45, 0, 0, time.UTC)},
+		// 5/15 runs from 5 to the end of the range in steps: 5, 20, 35, 50.
+		{"5/15 * * * *", from, time.Date(2021, 3, 10, 10, 35, 0, 0, time.UTC)},
+		{"5/15 * * * *", time.Date(2021, 3, 10, 10, 50, 0, 0, time.UTC), time.Date(2021, 3, 10, 11, 5, 0, 0, time.UTC)},
+		{"0-30/10 * * * *", from, time.Date(2021, 3, 10, 11, 0, 0, 0, time.UTC)},
+		{"0,45 9,17 * * *", from, time.Date(2021, 3, 10, 17, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", from, time.Date(2021, 3, 11, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2021, 3, 12, 9, 0, 0, 0, time.UTC), time.Date(2021, 3, 15, 9, 0, 0, 0, time.UTC)},
+		// Sunday is 0, 7 or sun.
+		{"0 0 * * 0", from, time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", from, time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * SUN", from, time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 5-7", from, time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan,jul *", from, time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)},
+		// With both days restricted, a day matching either one matches: the 1st or any Friday.
+		{"0 0 1 * 5", from, time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 11 * 5", from, time.Date(2021, 3, 11, 0, 0, 0, 0, time.UTC)},
+		// With only one of them restricted, only that one counts.
+		{"0 0 1 * *", from, time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 5", from, time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC)},
+		// Days given in steps of * are unrestricted as well: an odd day that is a Friday, not any Friday.
+		{"0 0 */2 * 5", from, time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */2 * *", from, time.Date(2021, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * */2", from, time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 5, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Days that never come are given up after five years.
+		{"0 0 30 2 *", from, time.Time{}},
+		{"0 0 31 4 *", from, time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q after %v = %v, want %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextKeepsLocation(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	s, err := parseCron("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2021-03-28 is the switch to summer time in Berlin.
+	got := s.next(time.Date(2021, 3, 27, 12, 0, 0, 0, berlin))
+	if want := time.Date(2021, 3, 28, 9, 0, 0, 0, berlin); !got.Equal(want) || got.Location() != berlin {
+		t.Errorf("next = %v, want %v", got, want)
+	}
+}
+
+func TestScheduleUnmarshalText(t *testing.T) {
+	from := time.Date(2021, 3, 10, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		text  string
+		want  time.Time
+		shown string
+	}{
+		{"1h", from.Add(time.Hour), "1h0m0s"},
+		{"90s", from.Add(90 * time.Second), "1m30s"},
+		{"0 12 * * *", time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC), "0 12 * * *"},
+	}
+	for _, tt := range tests {
+		var s Schedule
+		if err := s.UnmarshalText([]byte(tt.text)); err != nil {
+			t.Errorf("UnmarshalText(%q): %v", tt.text, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v, want %v", tt.text, got, tt.want)
+		}
+		if s.String() != tt.shown {
+			t.Errorf("String() = %q, want %q", s.String(), tt.shown)
+		}
+	}
+
+	var s Schedule
+	if err := s.UnmarshalText([]byte("every hour")); err == nil {
+		t.Error("UnmarshalText(\"every hour\") succeeded, want an error")
+	}
+}
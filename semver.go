@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version, see https://semver.org.
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease []string
+	Build      string
+}
+
+// ParseVersion parses versions like v1.2.3-rc.1+build.5.
+// The leading v is optional, missing minor and patch numbers default to 0.
+func ParseVersion(s string) (Version, error) {
+	var v Version
+
+	rest := strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	if i := strings.Index(rest, "+"); i >= 0 {
+		rest, v.Build = rest[:i], rest[i+1:]
+	}
+	if i := strings.Index(rest, "-"); i >= 0 {
+		var prerelease string
+		rest, prerelease = rest[:i], rest[i+1:]
+		if prerelease == "" {
+			return Version{}, fmt.Errorf("invalid version %q: empty pre-release", s)
+		}
+		v.Prerelease = strings.Split(prerelease, ".")
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q: too many parts", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q: %q is not a number", s, part)
+		}
+		*numbers[i] = n
+	}
+
+	return v, nil
+}
+
+// IsPrerelease returns true for versions like 1.0.0-rc.1.
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or greater than o.
+// Build metadata is ignored, as the precedence rules of semver require.
+func (v Version) Compare(o Version) int {
+	if c := compareInt(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	// A pre-release is lower than the release itself.
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		a, b := v.Prerelease[i], o.Prerelease[i]
+		an, aErr := strconv.Atoi(a)
+		bn, bErr := strconv.Atoi(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInt(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			// Numeric identifiers are lower than alphanumeric ones.
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(a, b); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(len(v.Prerelease), len(o.Prerelease))
+}
+
+// String returns the version without a leading v.
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Levels of change between two versions.
+const (
+	ChangeMajor      = "major"
+	ChangeMinor      = "minor"
+	ChangePatch      = "patch"
+	ChangePrerelease = "prerelease"
+)
+
+// ChangeLevel returns which part changed from prev to next,
+// or an empty string if the versions are equal.
+func ChangeLevel(prev, next Version) string {
+	switch {
+	case prev.Major != next.Major:
+		return ChangeMajor
+	case prev.Minor != next.Minor:
+		return ChangeMinor
+	case prev.Patch != next.Patch:
+		return ChangePatch
+	case prev.Compare(next) != 0:
+		return ChangePrerelease
+	}
+	return ""
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// ReleaseLine is a major or major.minor version line like 2.x or 1.4.x.
+type ReleaseLine struct {
+	Major int
+	// Minor is -1 for any minor version.
+	Minor int
+}
+
+// ParseReleaseLine parses release lines like 2, v2.x or 1.4.x.
+func ParseReleaseLine(s string) (ReleaseLine, error) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V"), ".")
+	for len(parts) > 1 && (parts[len(parts)-1] == "x" || parts[len(parts)-1] == "*") {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) > 2 {
+		return ReleaseLine{}, fmt.Errorf("invalid release line %q: only major and minor versions can be given", s)
+	}
+
+	line := ReleaseLine{Minor: -1}
+	numbers := []*int{&line.Major, &line.Minor}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return ReleaseLine{}, fmt.Errorf("invalid release line %q: %q is not a number", s, part)
+		}
+		*numbers[i] = n
+	}
+	return line, nil
+}
+
+// Contains returns true if the version is on the line.
+func (l ReleaseLine) Contains(v Version) bool {
+	return v.Major == l.Major && (l.Minor < 0 || v.Minor == l.Minor)
+}
+
+func (l ReleaseLine) String() string {
+	if l.Minor < 0 {
+		return fmt.Sprintf("%d.x", l.Major)
+	}
+	return fmt.Sprintf("%d.%d.x", l.Major, l.Minor)
+}
@@ -0,0 +1,135 @@
+package main
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"1.2.3", "1.2.3"},
+		{"v1.2.3", "1.2.3"},
+		{"V2", "2.0.0"},
+		{"1.4", "1.4.0"},
+		{"1.0.0-rc.1", "1.0.0-rc.1"},
+		{"v1.0.0-rc.1+build.5", "1.0.0-rc.1+build.5"},
+		{"1.0.0+20210310", "1.0.0+20210310"},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.in)
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %v", tt.in, err)
+			continue
+		}
+		if v.String() != tt.want {
+			t.Errorf("ParseVersion(%q) = %s, want %s", tt.in, v, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "latest", "1.2.3.4", "1.x", "1.-2", "1.0.0-", "release-1.0"} {
+		if v, err := ParseVersion(in); err == nil {
+			t.Errorf("ParseVersion(%q) = %s, want an error", in, v)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// In ascending precedence, as in the example of https://semver.org/#spec-item-11.
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.1.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			want := compareInt(i, j)
+			if got := mustParseVersion(t, a).Compare(mustParseVersion(t, b)); got != want {
+				t.Errorf("%s compared to %s = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+
+	// Build metadata doesn't count.
+	if got := mustParseVersion(t, "1.0.0+a").Compare(mustParseVersion(t, "1.0.0+b")); got != 0 {
+		t.Errorf("1.0.0+a compared to 1.0.0+b = %d, want 0", got)
+	}
+}
+
+func TestChangeLevel(t *testing.T) {
+	tests := []struct {
+		prev, next string
+		want       string
+	}{
+		{"1.2.3", "2.0.0", ChangeMajor},
+		{"1.2.3", "1.3.0", ChangeMinor},
+		{"1.2.3", "1.2.4", ChangePatch},
+		{"1.3.0-rc.1", "1.3.0", ChangePrerelease},
+		{"1.3.0-rc.1", "1.3.0-rc.2", ChangePrerelease},
+		{"1.2.3", "v1.2.3+build.1", ""},
+	}
+	for _, tt := range tests {
+		if got := ChangeLevel(mustParseVersion(t, tt.prev), mustParseVersion(t, tt.next)); got != tt.want {
+			t.Errorf("ChangeLevel(%s, %s) = %q, want %q", tt.prev, tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestParseReleaseLine(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     string
+		contains []string
+		excludes []string
+	}{
+		{"2", "2.x", []string{"2.0.0", "2.5.1", "2.0.0-rc.1"}, []string{"1.9.9", "3.0.0"}},
+		{"v2.x", "2.x", []string{"2.1.0"}, []string{"20.1.0"}},
+		{"1.4.x", "1.4.x", []string{"1.4.0", "1.4.12"}, []string{"1.5.0", "2.4.0"}},
+		{"1.4.*", "1.4.x", []string{"1.4.3"}, []string{"1.3.9"}},
+		{"1.x.x", "1.x", []string{"1.7.0"}, []string{"0.7.0"}},
+		{"1.4", "1.4.x", []string{"1.4.3"}, []string{"1.40.0"}},
+	}
+	for _, tt := range tests {
+		line, err := ParseReleaseLine(tt.in)
+		if err != nil {
+			t.Errorf("ParseReleaseLine(%q): %v", tt.in, err)
+			continue
+		}
+		if line.String() != tt.want {
+			t.Errorf("ParseReleaseLine(%q) = %s, want %s", tt.in, line, tt.want)
+		}
+		for _, v := range tt.contains {
+			if !line.Contains(mustParseVersion(t, v)) {
+				t.Errorf("%s doesn't contain %s", line, v)
+			}
+		}
+		for _, v := range tt.excludes {
+			if line.Contains(mustParseVersion(t, v)) {
+				t.Errorf("%s contains %s", line, v)
+			}
+		}
+	}
+
+	for _, in := range []string{"", "x", "1.4.5", "1.x.4", "one.x", "-1"} {
+		if line, err := ParseReleaseLine(in); err == nil {
+			t.Errorf("ParseReleaseLine(%q) = %s, want an error", in, line)
+		}
+	}
+}
+
+func mustParseVersion(t *testing.T, s string) Version {
+	t.Helper()
+	v, err := ParseVersion(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// sentryRepeatedThreshold is the number of consecutive failures
+// after which an error is reported as a repeated hard error.
+const sentryRepeatedThreshold = 3
+
+// Sentry reports errors and panics to a Sentry project.
+// A nil *Sentry is valid and does nothing, so it can be used unconditionally.
+type Sentry struct {
+	endpoint  string
+	publicKey string
+	dsn       string
+	logger    log.Logger
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+// NewSentry parses the DSN of a Sentry project, logging errors that fail to be reported.
+// It returns nil if the DSN is empty.
+func NewSentry(dsn string, logger log.Logger) (*Sentry, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry dsn: %v", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid sentry dsn: missing public key")
+	}
+
+	i := strings.LastIndex(u.Path, "/")
+	projectID := u.Path[i+1:]
+	if projectID == "" {
+		return nil, fmt.Errorf("invalid sentry dsn: missing project id")
+	}
+
+	return &Sentry{
+		endpoint:  fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, u.Path[:i], projectID),
+		publicKey: u.User.Username(),
+		dsn:       dsn,
+		logger:    logger,
+		failures:  make(map[string]int),
+	}, nil
+}
+
+// CaptureError reports the error with the given tags, e.g. the repository or sender involved.
+func (s *Sentry) CaptureError(err error, tags map[string]string) {
+	if s == nil || err == nil {
+		return
+	}
+	s.report("error", err.Error(), tags, nil)
+}
+
+// Repeated counts consecutive failures for key and reports the error once
+// they reach the threshold. Occasional errors are expected and only logged.
+func (s *Sentry) Repeated(key string, err error, tags map[string]string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.failures[key]++
+	failures := s.failures[key]
+	s.mu.Unlock()
+
+	if failures == sentryRepeatedThreshold {
+		s.report("error", fmt.Sprintf("failed %d times in a row: %v", failures, err), tags, nil)
+	}
+}
+
+// Reset clears the consecutive failures for key after it succeeded again.
+func (s *Sentry) Reset(key string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.failures, key)
+	s.mu.Unlock()
+}
+
+// Recover reports a panic and keeps it going. It has to be deferred directly.
+func (s *Sentry) Recover(tags map[string]string) {
+	if s == nil {
+		return
+	}
+	if r := recover(); r != nil {
+		s.report("fatal", fmt.Sprintf("panic: %v", r), tags, map[string]interface{}{
+			"stacktrace": string(debug.Stack()),
+		})
+		panic(r)
+	}
+}
+
+// report sends the event, logging the message if that fails so it isn't lost.
+func (s *Sentry) report(severity, message string, tags map[string]string, extra map[string]interface{}) {
+	if err := s.send(severity, message, tags, extra); err != nil && s.logger != nil {
+		level.Warn(s.logger).Log("msg", "failed to report error to sentry", "level", severity, "error", message, "err", err)
+	}
+}
+
+func (s *Sentry) send(severity, message string, tags map[string]string, extra map[string]interface{}) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	eventID := hex.EncodeToString(id)
+
+	event := map[string]interface{}{
+		"event_id":  eventID,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"platform":  "go",
+		"level":     severity,
+		"logger":    "github-releases-notifier",
+		"message":   message,
+		"tags":      tags,
+		"extra":     extra,
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	if err := enc.Encode(map[string]string{"event_id": eventID, "dsn": s.dsn}); err != nil {
+		return err
+	}
+	if err := enc.Encode(map[string]string{"type": "event"}); err != nil {
+		return err
+	}
+	if err := enc.Encode(event); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+		"Sentry sentry_version=7, sentry_client=github-releases-notifier, sentry_key=%s",
+		s.publicKey,
+	))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req = req.WithContext(ctx)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("request didn't respond with 200 OK: %s, %s", resp.Status, body)
+	}
+
+	return nil
+}
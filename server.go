@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"expvar"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Server is the optional HTTP server to check on and control a running notifier.
+type Server struct {
+	logger log.Logger
+	pause  *Pause
+	// logLevel is changed with PUT /loglevel.
+	logLevel *LevelLogger
+	// test sends a test release to all configured senders or only the given one.
+	test func(sender string) []SenderResult
+	// testToken protects sending tests and the other endpoints controlling the notifier, see authorized.
+	testToken string
+	// webhookSecret verifies the signatures of GitHub's webhook events, which are only received if it is set.
+	webhookSecret string
+	// receive puts a received event into the inbox, see Checker.Receive.
+	receive func(event inboxEvent) error
+	// history serves the Atom feeds of the releases dispatched recently if set,
+	// up to feedLimit of them titled feedTitle, with the actions in the language of messages.
+	history   *History
+	feedLimit int
+	feedTitle string
+	messages  Messages
+}
+
+// SenderResult is the result of delivering a release to a sender.
+type SenderResult struct {
+	Sender string
+	Err    error
+}
+
+// Handler returns the server's endpoints, those marked with * only for authorized requests:
+//
+//	GET  /healthz     whether the notifier is up and paused
+//	GET  /readyz      whether the first check is done
+//	GET  /metrics     the counters in Prometheus' text format
+//	POST /pause       * pauses notifications
+//	POST /resume      * resumes notifications
+//	POST /test        * sends a test release, to the sender given as ?sender= or the ones of testSenders
+//	POST /webhook     receives GitHub's release and create events, with a webhook secret
+//	GET  /loglevel    the current log level
+//	PUT  /loglevel    * changes the log level to the one in the body, like debug
+//	GET  /debug/vars  * the counters like deliveries
+//	GET  /feed.xml    the Atom feed of the releases dispatched recently, with FEED_ENABLED
+//	GET  /feeds/      the Atom feed of a single repository, e.g. /feeds/owner/name.xml
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/metrics", s.metrics)
+	mux.HandleFunc("/pause", s.post(func() bool { return s.pause.Pause() }, "paused notifications"))
+	mux.HandleFunc("/resume", s.post(func() bool { return s.pause.Resume() }, "resumed notifications"))
+	mux.HandleFunc("/test", s.sendTest)
+	if s.webhookSecret != "" {
+		mux.HandleFunc("/webhook", s.receiveWebhook)
+	}
+	mux.HandleFunc("/loglevel", s.changeLogLevel)
+	mux.HandleFunc("/debug/vars", func(w http.ResponseWriter, r *http.Request) {
+		if s.authorized(w, r) {
+			expvar.Handler().ServeHTTP(w, r)
+		}
+	})
+	if s.history != nil {
+		mux.HandleFunc("/feed.xml", s.serveFeed)
+		mux.HandleFunc("/feeds/", s.serveFeed)
+	}
+	return mux
+}
+
+// ListenAndServe serves the endpoints on addr like :8080.
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// ListenAndServeTLS serves the endpoints on addr over HTTPS with the certificate of certs.
+func (s *Server) ListenAndServeTLS(addr string, certs *CertReloader) error {
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   s.Handler(),
+		TLSConfig: &tls.Config{GetCertificate: certs.GetCertificate},
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	s.writeStatus(w)
+}
+
+// readyz fails until the first check is done, so the notifier only counts as ready once it knows the releases.
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	if checksPerformed.Value() == 0 {
+		http.Error(w, "first check not done yet", http.StatusServiceUnavailable)
+		return
+	}
+	s.writeStatus(w)
+}
+
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := WritePrometheus(w); err != nil {
+		level.Warn(s.logger).Log("msg", "failed to write metrics", "err", err)
+	}
+}
+
+// post returns a handler for POST requests changing the pause state with change,
+// logging msg if it did. Either way the current state is returned.
+func (s *Server) post(change func() bool, msg string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.authorized(w, r) {
+			return
+		}
+		if change() {
+			level.Info(s.logger).Log("msg", msg, "remote", r.RemoteAddr)
+		}
+		s.writeStatus(w)
+	}
+}
+
+// authorized returns true for requests allowed to control the notifier: with testToken those
+// with it as bearer token, otherwise only those from the same host. Others get an error response.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if s.testToken != "" {
+		token := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(token), []byte("Bearer "+s.testToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		http.Error(w, "forbidden, set TEST_TOKEN to allow requests from other hosts", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// testSenders are the senders POST /test sends to without ?sender=, the chat and alert ones.
+// The others, like the SQLite history or GitLab issues, keep the test release or hand it to other systems,
+// so they are only tested when asked for.
+var testSenders = []string{"slack", "discord", "teams", "email", "opsgenie", "desktop"}
+
+// sendTest sends a test release and responds with the senders it succeeded and failed for.
+// It fails unless all senders succeeded.
+func (s *Server) sendTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+	sender := r.URL.Query().Get("sender")
+	if sender != "" && !containsFold(senderNames, sender) {
+		http.Error(w, "unknown sender "+sender, http.StatusBadRequest)
+		return
+	}
+
+	results := s.test(sender)
+	if len(results) == 0 && sender == "" {
+		http.Error(w, "no configured chat or alert sender, give the sender to test as ?sender=", http.StatusBadRequest)
+		return
+	}
+	if len(results) == 0 {
+		http.Error(w, "no configured sender", http.StatusBadRequest)
+		return
+	}
+
+	response := struct {
+		Succeeded []string          `json:"succeeded"`
+		Failed    map[string]string `json:"failed"`
+	}{[]string{}, map[string]string{}}
+	for _, result := range results {
+		if result.Err != nil {
+			response.Failed[result.Sender] = result.Err.Error()
+		} else {
+			response.Succeeded = append(response.Succeeded, result.Sender)
+		}
+	}
+	level.Info(s.logger).Log(
+		"msg", "sent test release",
+		"remote", r.RemoteAddr,
+		"succeeded", len(response.Succeeded),
+		"failed", len(response.Failed),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(response.Failed) > 0 {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// changeLogLevel responds with the current log level after changing it for PUT requests.
+func (s *Server) changeLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if !s.authorized(w, r) {
+			return
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, 64))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		previous := s.logLevel.Level()
+		if err := s.logLevel.SetLevel(strings.TrimSpace(string(body))); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		level.Info(s.logger).Log("msg", "changed log level", "from", previous, "to", s.logLevel.Level(), "remote", r.RemoteAddr)
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Level string `json:"level"`
+	}{s.logLevel.Level()})
+}
+
+// testRepository returns a made up release to test the senders with.
+func testRepository() Repository {
+	repositoryURL, _ := url.Parse("https://github.com/marthjod/github-releases-notifier")
+	releaseURL, _ := url.Parse("https://github.com/marthjod/github-releases-notifier/releases")
+	now := time.Now()
+
+	return Repository{
+		ID:          "test",
+		Name:        "test",
+		Owner:       "github-releases-notifier",
+		Description: "Test notification",
+		URL:         *repositoryURL,
+		Release: Release{
+			ID:          "test-" + now.UTC().Format("20060102T150405Z"),
+			Name:        "Test release",
+			TagName:     "v0.0.0-test",
+			Description: "This is a test notification, sent with POST /test.",
+			URL:         *releaseURL,
+			PublishedAt: now,
+			CreatedAt:   now,
+			Author:      "github-releases-notifier",
+		},
+	}
+}
+
+func (s *Server) writeStatus(w http.ResponseWriter) {
+	status := struct {
+		Status string `json:"status"`
+		PauseStatus
+	}{"ok", s.pause.Status()}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
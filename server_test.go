@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestServerAuthorizesControl(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		remote string
+		header string
+		want   int
+	}{
+		{"same host without token", "", "127.0.0.1:4711", "", http.StatusOK},
+		{"same host over IPv6", "", "[::1]:4711", "", http.StatusOK},
+		{"other host without token", "", "192.0.2.1:4711", "", http.StatusForbidden},
+		{"other host with token", "secret", "192.0.2.1:4711", "Bearer secret", http.StatusOK},
+		{"same host missing token", "secret", "127.0.0.1:4711", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "192.0.2.1:4711", "Bearer guess", http.StatusUnauthorized},
+	}
+	store, err := NewFileStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		s := &Server{logger: log.NewNopLogger(), pause: NewPause(PauseBuffer, store), logLevel: NewLevelLogger(log.NewNopLogger(), "info"), testToken: tt.token}
+		for _, endpoint := range []struct{ method, path string }{
+			{http.MethodPost, "/pause"},
+			{http.MethodPost, "/resume"},
+			{http.MethodGet, "/debug/vars"},
+			{http.MethodPut, "/loglevel"},
+		} {
+			r := httptest.NewRequest(endpoint.method, endpoint.path, strings.NewReader("info"))
+			r.RemoteAddr = tt.remote
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.Handler().ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s: %s %s = %d, want %d", tt.name, endpoint.method, endpoint.path, w.Code, tt.want)
+			}
+		}
+	}
+
+	// Checking on the notifier stays open.
+	s := &Server{logger: log.NewNopLogger(), pause: NewPause(PauseBuffer, store), testToken: "secret"}
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	r.RemoteAddr = "192.0.2.1:4711"
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -5,43 +5,507 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 )
 
+// slackAPIURL is where the methods of Slack's Web API are.
+const slackAPIURL = "https://slack.com/api/"
+
 // SlackSender has the hook to send slack notifications.
 type SlackSender struct {
 	Hook string
+	// BotToken and Channel, the channel's ID, post release notes longer than UploadThreshold bytes
+	// through the Web API as a file with the message, instead of cutting them.
+	BotToken        string
+	Channel         string
+	UploadThreshold int
+	// NotesLength cuts the release notes in messages to that many bytes if set, see Release.Notes.
+	NotesLength int
+	// Colors decide the color of the message's attachment, the first matching rule wins.
+	Colors []ColorRule
+	// Emoji decide the emoji in front of the message, or its icon with EmojiAsIcon, the first matching rule wins.
+	Emoji       []ColorRule
+	EmojiAsIcon bool
+	// Mentions of all matching rules are added to the message.
+	Mentions []MentionRule
+	// Channels returns the channel of the repository's notifications if it has one of its own,
+	// overriding the hook's channel and, if set, Channel.
+	Channels func(repoName string) string
+	// Routes returns the destinations of the repository's notifications if they aren't sent through Hook.
+	Routes func(repoName string) []SlackDestination
+	// Fields of the release to include, only its linked name by default.
+	Fields   NotificationFields
+	Messages Messages
+	// Template, if set, renders the message's text instead of Fields, see MessageData.
+	Template *template.Template
+	// DigestSort and DigestLimit order and cut off the releases of grouped messages, see Digest.
+	DigestSort  string
+	DigestLimit int
 }
 
 type slackPayload struct {
-	Username  string `json:"username"`
-	IconEmoji string `json:"icon_emoji"`
-	Text      string `json:"text"`
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username"`
+	IconEmoji   string            `json:"icon_emoji"`
+	Text        string            `json:"text,omitempty"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Fallback   string `json:"fallback"`
+	Color      string `json:"color,omitempty"`
+	Text       string `json:"text"`
+	Footer     string `json:"footer,omitempty"`
+	FooterIcon string `json:"footer_icon,omitempty"`
+}
+
+// DefaultColorRules color security releases red, major bumps purple,
+// minor bumps blue and patches green.
+var DefaultColorRules = []string{
+	"security=#e01e5a",
+	"prerelease=#ecb22e",
+	"major=#8e44ad",
+	"minor=#36c5f0",
+	"patch=#2eb67d",
+}
+
+// DefaultEmojiRules mark security releases with a lock, pre-releases with a test tube,
+// major bumps with a rocket, minor bumps with sparkles and patches with a wrench.
+var DefaultEmojiRules = []string{
+	"security=:lock:",
+	"prerelease=:test_tube:",
+	"major=:rocket:",
+	"minor=:sparkles:",
+	"patch=:wrench:",
+}
+
+// ColorRule colors releases matching its condition.
+type ColorRule struct {
+	// Condition is one of security, prerelease, major, minor, patch or default,
+	// or tag:<regexp> to match the release's tag.
+	Condition string
+	Color     string
+
+	tag *regexp.Regexp
+}
+
+// ParseColorRules parses rules given as condition=color, e.g. major=#8e44ad or tag:^nightly-=#cccccc.
+func ParseColorRules(rules []string) ([]ColorRule, error) {
+	return parseRules("color", rules)
+}
+
+// ParseEmojiRules parses rules given as condition=emoji, e.g. major=:rocket:, with the conditions of colors.
+// The single rule none turns emoji off.
+func ParseEmojiRules(rules []string) ([]ColorRule, error) {
+	if len(rules) == 1 && rules[0] == "none" {
+		return nil, nil
+	}
+	return parseRules("emoji", rules)
+}
+
+func parseRules(kind string, rules []string) ([]ColorRule, error) {
+	parsed := make([]ColorRule, 0, len(rules))
+	for _, rule := range rules {
+		i := strings.LastIndex(rule, "=")
+		if i <= 0 || i == len(rule)-1 {
+			return nil, fmt.Errorf("%s rule %q is not of the form condition=%s", kind, rule, kind)
+		}
+		r, err := newColorRule(rule[:i], rule[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s rule %q %v", kind, rule, err)
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+func newColorRule(condition, color string) (ColorRule, error) {
+	r := ColorRule{Condition: condition, Color: color}
+
+	switch {
+	case strings.HasPrefix(r.Condition, "tag:"):
+		tag, err := regexp.Compile(strings.TrimPrefix(r.Condition, "tag:"))
+		if err != nil {
+			return r, fmt.Errorf("has an invalid tag pattern: %v", err)
+		}
+		r.tag = tag
+	case r.Condition == "security", r.Condition == "prerelease", r.Condition == "default",
+		r.Condition == ChangeMajor, r.Condition == ChangeMinor, r.Condition == ChangePatch:
+	default:
+		return r, fmt.Errorf("has an unknown condition")
+	}
+	return r, nil
+}
+
+// Matches returns true if the rule applies to the repository's release.
+func (r ColorRule) Matches(repository Repository) bool {
+	switch r.Condition {
+	case "security":
+		return repository.Release.IsSecurity()
+	case "prerelease":
+		return repository.Release.IsPrerelease || repository.Release.IsNonstable()
+	case "default":
+		return true
+	case ChangeMajor, ChangeMinor, ChangePatch:
+		return repository.ChangeLevel() == r.Condition
+	}
+	return r.tag != nil && r.tag.MatchString(repository.Release.TagName)
+}
+
+// MentionRule mentions Slack users or user groups for releases of a repository,
+// releases matching a condition like for colors or both.
+type MentionRule struct {
+	Repository string `yaml:"repository"`
+	Condition  string `yaml:"condition"`
+	// Mentions are Slack IDs, U… or W… for users and S… for user groups,
+	// as display names aren't resolved in messages.
+	Mentions []string `yaml:"mentions"`
+
+	condition *ColorRule
+}
+
+// compile validates the rule and parses its condition.
+func (r *MentionRule) compile() error {
+	for _, id := range r.Mentions {
+		if !strings.HasPrefix(id, "U") && !strings.HasPrefix(id, "W") && !strings.HasPrefix(id, "S") {
+			return fmt.Errorf("mention %q is not a Slack user or user group ID", id)
+		}
+	}
+	if r.Condition == "" {
+		return nil
+	}
+	condition, err := newColorRule(r.Condition, "")
+	if err != nil {
+		return fmt.Errorf("mention condition %q %v", r.Condition, err)
+	}
+	r.condition = &condition
+	return nil
+}
+
+// Matches returns true if the rule applies to the repository's release.
+func (r MentionRule) Matches(repository Repository) bool {
+	if r.Repository != "" && !strings.EqualFold(r.Repository, repository.Owner+"/"+repository.Name) {
+		return false
+	}
+	return r.condition == nil || r.condition.Matches(repository)
+}
+
+// emoji returns the emoji of the first rule matching the repository's release, if any.
+func (s *SlackSender) emoji(repository Repository) string {
+	for _, rule := range s.Emoji {
+		if rule.Matches(repository) {
+			return rule.Color
+		}
+	}
+	return ""
+}
+
+// mentions returns the mentions of all rules matching the repository's release in Slack's syntax.
+func (s *SlackSender) mentions(repository Repository) string {
+	var mentions []string
+	for _, rule := range s.Mentions {
+		if !rule.Matches(repository) {
+			continue
+		}
+		for _, id := range rule.Mentions {
+			mention := "<@" + id + ">"
+			if strings.HasPrefix(id, "S") {
+				mention = "<!subteam^" + id + ">"
+			}
+			if !containsFold(mentions, mention) {
+				mentions = append(mentions, mention)
+			}
+		}
+	}
+	return strings.Join(mentions, " ")
 }
 
 // Send a notification with a formatted message build from the repository.
 func (s *SlackSender) Send(repository Repository) error {
+	fields := s.Fields.Or(FieldURL)
+
+	name := repository.Release.Name
+	if fields.Has(FieldURL) {
+		name = fmt.Sprintf("<%s|%s>", repository.Release.URL.String(), name)
+	}
+	if s.Template != nil {
+		text, err := renderMessage(s.Template, repository, s.Messages)
+		if err != nil {
+			return err
+		}
+		return s.send(repository, s.payload(repository, fields, text, s.emoji(repository)))
+	}
+	action := s.Messages.Action(repository)
+	text := fmt.Sprintf(
+		"<%s|%s/%s>: %s %s",
+		repository.URL.String(),
+		repository.Owner,
+		repository.Name,
+		name,
+		action,
+	)
+	emoji := s.emoji(repository)
+	if emoji != "" && !s.EmojiAsIcon {
+		text = emoji + " " + text
+	}
+	if details := fields.Details(repository.Release, s.Messages); len(details) > 0 {
+		text += "\n" + strings.Join(details, "\n")
+	}
+	if compare := repository.CompareURL(); compare != "" && fields.Has(FieldURL) {
+		text += fmt.Sprintf("\n<%s|%s>", compare, s.Messages.ChangesSince(repository))
+	}
+	notes := repository.Release.Description
+	if repository.Release.FullDescription != "" {
+		notes = repository.Release.FullDescription
+	}
+	if fields.Has(FieldBody) && s.BotToken != "" && len(notes) > s.UploadThreshold && len(s.destinations(repository)) == 0 {
+		message := text
+		if mentions := s.mentions(repository); mentions != "" {
+			message = mentions + " " + text
+		}
+		return s.upload(repository, message, notes)
+	}
+	if fields.Has(FieldBody) && repository.Release.Description != "" {
+		text += "\n\n" + markdownToMrkdwn(repository.Release.Notes(s.NotesLength, s.Messages))
+	}
+	return s.send(repository, s.payload(repository, fields, text, emoji))
+}
+
+// destinations returns where the repository's notifications are routed to, nothing for Hook.
+func (s *SlackSender) destinations(repository Repository) []SlackDestination {
+	if s.Routes == nil {
+		return nil
+	}
+	return s.Routes(repository.Owner + "/" + repository.Name)
+}
+
+// send posts the message about the repository's release through Hook or to each destination it is routed to,
+// but the ones that delivered it in an earlier attempt. The repository's own channel still wins over the destinations' ones.
+// If some destinations fail, the error tells which ones delivered it, so retries only go to the others.
+func (s *SlackSender) send(repository Repository, payload slackPayload) error {
+	destinations := s.destinations(repository)
+	if len(destinations) == 0 {
+		return s.post(payload)
+	}
+	var delivered, errs []string
+	for _, destination := range destinations {
+		name := "slack:" + destination.Name
+		if containsFold(repository.delivered, name) {
+			continue
+		}
+		routed := payload
+		if routed.Channel == "" {
+			routed.Channel = destination.Channel
+		}
+		if err := s.postTo(destination.Hook, routed); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		delivered = append(delivered, name)
+	}
+	if len(errs) > 0 {
+		return &partialDelivery{
+			Delivered: delivered,
+			err:       fmt.Errorf("failed to send to %d of %d slack destinations: %s", len(errs), len(destinations), strings.Join(errs, "; ")),
+		}
+	}
+	return nil
+}
+
+// payload returns the message with the text, adding the emoji as its icon, the mentions and
+// the attachment colored by the rules.
+func (s *SlackSender) payload(repository Repository, fields NotificationFields, text, emoji string) slackPayload {
 	payload := slackPayload{
+		Channel:   s.channel(repository),
 		Username:  "GitHub Releases",
 		IconEmoji: ":github:",
-		Text: fmt.Sprintf(
-			"<%s|%s/%s>: <%s|%s> released",
+		Text:      text,
+	}
+	if emoji != "" && s.EmojiAsIcon {
+		payload.IconEmoji = emoji
+	}
+	mentions := s.mentions(repository)
+	if mentions != "" {
+		payload.Text = mentions + " " + text
+	}
+	var attachment *slackAttachment
+	for _, rule := range s.Colors {
+		if rule.Matches(repository) {
+			attachment = &slackAttachment{Fallback: text, Color: rule.Color, Text: text}
+			break
+		}
+	}
+	// The author links to their profile in the footer, next to their avatar.
+	// Releases without an author, like those of deleted users, go without.
+	if release := repository.Release; fields.Has(FieldAvatar) && release.AuthorURL != "" {
+		if attachment == nil {
+			attachment = &slackAttachment{Fallback: text, Text: text}
+		}
+		attachment.Footer = fmt.Sprintf("<%s|%s>", release.AuthorURL, release.Author)
+		attachment.FooterIcon = release.AuthorAvatarURL
+	}
+	if attachment != nil {
+		// Mentions in attachments don't notify anyone, so they stay in the text.
+		payload.Text = mentions
+		payload.Attachments = []slackAttachment{*attachment}
+	}
+	return payload
+}
+
+// channel returns the repository's own channel, if any.
+func (s *SlackSender) channel(repository Repository) string {
+	if s.Channels == nil {
+		return ""
+	}
+	return s.Channels(repository.Owner + "/" + repository.Name)
+}
+
+// uploadChannel returns the channel to upload the repository's release notes to.
+func (s *SlackSender) uploadChannel(repository Repository) string {
+	if channel := s.channel(repository); channel != "" {
+		return channel
+	}
+	return s.Channel
+}
+
+// SendGroup sends a single notification listing the releases of the owner's repositories.
+func (s *SlackSender) SendGroup(owner string, repositories []Repository) error {
+	heading := fmt.Sprintf(s.Messages.OwnerReleased, owner)
+	return s.sendRouted(repositories, func(listed []Repository) slackPayload {
+		return s.summary(heading, listed, false)
+	})
+}
+
+// SendDigest sends a single notification listing the releases collected for the scheduled digest.
+func (s *SlackSender) SendDigest(repositories []Repository) error {
+	return s.sendRouted(repositories, func(listed []Repository) slackPayload {
+		return s.summary("*"+s.Messages.Digest+"*", listed, true)
+	})
+}
+
+// sendRouted posts the message of payload to every destination the repositories are routed to,
+// listing only the releases routed to it, and the others' through Hook. Without Hook those aren't sent,
+// like they aren't on their own.
+func (s *SlackSender) sendRouted(repositories []Repository, payload func(listed []Repository) slackPayload) error {
+	var destinations []SlackDestination
+	routed := make(map[SlackDestination][]Repository)
+	for _, repository := range repositories {
+		to := s.destinations(repository)
+		if len(to) == 0 {
+			if s.Hook == "" {
+				continue
+			}
+			to = []SlackDestination{{Hook: s.Hook}}
+		}
+		for _, destination := range to {
+			if _, ok := routed[destination]; !ok {
+				destinations = append(destinations, destination)
+			}
+			routed[destination] = append(routed[destination], repository)
+		}
+	}
+
+	var errs []string
+	for _, destination := range destinations {
+		message := payload(routed[destination])
+		message.Channel = destination.Channel
+		if err := s.postTo(destination.Hook, message); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send to %d of %d slack destinations: %s", len(errs), len(destinations), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// summary lists the releases under the heading, ordered and cut off like a digest,
+// with the repositories' owners if fullNames is set.
+func (s *SlackSender) summary(heading string, repositories []Repository, fullNames bool) slackPayload {
+	var mentions []string
+	for _, repository := range repositories {
+		for _, mention := range strings.Fields(s.mentions(repository)) {
+			if !containsFold(mentions, mention) {
+				mentions = append(mentions, mention)
+			}
+		}
+	}
+
+	listed, more := Digest(repositories, s.DigestSort, s.DigestLimit)
+	lines := []string{heading}
+	for _, repository := range listed {
+		// The emoji stand in for the bullets, the message's icon is the same for all of them.
+		bullet := "•"
+		if emoji := s.emoji(repository); emoji != "" && !s.EmojiAsIcon {
+			bullet = emoji
+		}
+		name := repository.Name
+		if fullNames {
+			name = repository.Owner + "/" + repository.Name
+		}
+		lines = append(lines, fmt.Sprintf(
+			"%s <%s|%s>: <%s|%s>",
+			bullet,
 			repository.URL.String(),
-			repository.Owner,
-			repository.Name,
+			name,
 			repository.Release.URL.String(),
 			repository.Release.Name,
-		),
+		))
+	}
+	if more > 0 {
+		lines = append(lines, fmt.Sprintf(s.Messages.AndMore, more))
+	}
+	if len(mentions) > 0 {
+		lines[0] = strings.Join(mentions, " ") + " " + lines[0]
 	}
 
+	return slackPayload{
+		Username:  "GitHub Releases",
+		IconEmoji: ":github:",
+		Text:      strings.Join(lines, "\n"),
+	}
+}
+
+// SendNotice sends a notification about a change of a watched repository.
+func (s *SlackSender) SendNotice(notice Notice) error {
+	repository := fmt.Sprintf("<%s|%s>", notice.URL, notice.Repository)
+	text := fmt.Sprintf(s.Messages.Archived, repository)
+	if notice.Kind == NoticeRenamed {
+		text = fmt.Sprintf(s.Messages.RenamedTo, repository, notice.NewName)
+	}
+	payload := slackPayload{
+		Username:  "GitHub Releases",
+		IconEmoji: ":github:",
+		Text:      ":information_source: " + text,
+	}
+	// The notice goes where the repository's releases go.
+	owner, name := splitRepoName(notice.Repository)
+	return s.sendRouted([]Repository{{Owner: owner, Name: name}}, func([]Repository) slackPayload {
+		return payload
+	})
+}
+
+// post posts the payload to Hook.
+func (s *SlackSender) post(payload slackPayload) error {
+	return s.postTo(s.Hook, payload)
+}
+
+// postTo posts the payload to the hook.
+func (s *SlackSender) postTo(hook string, payload slackPayload) error {
 	payloadData, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, s.Hook, bytes.NewReader(payloadData))
+	req, err := http.NewRequest(http.MethodPost, hook, bytes.NewReader(payloadData))
 	if err != nil {
 		return err
 	}
@@ -57,8 +521,99 @@ func (s *SlackSender) Send(repository Repository) error {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf("request didn't respond with 200 OK: %s, %s", resp.Status, body)
+		return &statusError{Code: resp.StatusCode, Message: fmt.Sprintf("request didn't respond with 200 OK: %s, %s", resp.Status, body)}
 	}
 
 	return nil
 }
+
+// upload posts the message to the channel with the release notes attached as a Markdown file.
+// Files are uploaded in three steps: getting an upload URL, uploading to it and sharing the file.
+func (s *SlackSender) upload(repository Repository, message, notes string) error {
+	filename := fmt.Sprintf("%s-%s.md", repository.Name, strings.Replace(repository.Release.Key(), "/", "-", -1))
+	form := url.Values{"filename": {filename}, "length": {strconv.Itoa(len(notes))}}
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	err := s.call("files.getUploadURLExternal", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), &upload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, upload.UploadURL, strings.NewReader(notes))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{Code: resp.StatusCode, Message: fmt.Sprintf("file upload didn't respond with 200 OK: %s", resp.Status)}
+	}
+
+	type file struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	}
+	complete, err := json.Marshal(struct {
+		Files          []file `json:"files"`
+		ChannelID      string `json:"channel_id"`
+		InitialComment string `json:"initial_comment"`
+	}{
+		Files:          []file{{ID: upload.FileID, Title: repository.Owner + "/" + repository.Name + " " + repository.Release.Name}},
+		ChannelID:      s.uploadChannel(repository),
+		InitialComment: message,
+	})
+	if err != nil {
+		return err
+	}
+	return s.call("files.completeUploadExternal", "application/json; charset=utf-8", bytes.NewReader(complete), nil)
+}
+
+// call calls a method of the Web API, decoding its result into result unless it's nil.
+// Slack responds with 200 OK to failed calls, too, with the error in the result.
+func (s *SlackSender) call(method, contentType string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, slackAPIURL+method, body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+s.BotToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{Code: resp.StatusCode, Message: fmt.Sprintf("%s didn't respond with 200 OK: %s, %s", method, resp.Status, data)}
+	}
+
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return err
+	}
+	if !status.OK {
+		return fmt.Errorf("%s failed: %s", method, status.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// slackHooks records the messages posted to hooks under /<name>, failing for the names in fail.
+type slackHooks struct {
+	mu     sync.Mutex
+	posted map[string][]slackPayload
+	fail   map[string]bool
+}
+
+func newSlackHooks(t *testing.T) (*slackHooks, *httptest.Server) {
+	t.Helper()
+	hooks := &slackHooks{posted: make(map[string][]slackPayload), fail: make(map[string]bool)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		var payload slackPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		if hooks.fail[name] {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		hooks.posted[name] = append(hooks.posted[name], payload)
+	}))
+	t.Cleanup(server.Close)
+	return hooks, server
+}
+
+func slackRepository(owner, name string) Repository {
+	return Repository{Owner: owner, Name: name, Release: Release{Name: "v1.0.0", TagName: "v1.0.0"}}
+}
+
+func TestSlackSendGroupRoutesReleases(t *testing.T) {
+	hooks, server := newSlackHooks(t)
+	routes := map[string][]SlackDestination{
+		"kubernetes/kubernetes": {{Hook: server.URL + "/platform", Channel: "#platform"}},
+		"kubernetes/minikube": {
+			{Hook: server.URL + "/platform", Channel: "#platform"},
+			{Hook: server.URL + "/tools"},
+		},
+	}
+	s := &SlackSender{
+		Hook:     server.URL + "/default",
+		Messages: locales["en"],
+		Routes:   func(repoName string) []SlackDestination { return routes[repoName] },
+	}
+
+	err := s.SendGroup("kubernetes", []Repository{
+		slackRepository("kubernetes", "kubernetes"),
+		slackRepository("kubernetes", "minikube"),
+		slackRepository("kubernetes", "kompose"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string][]string{
+		"platform": {"|kubernetes>", "|minikube>"},
+		"tools":    {"|minikube>"},
+		"default":  {"|kompose>"},
+	} {
+		posted := hooks.posted[name]
+		if len(posted) != 1 {
+			t.Fatalf("%s got %d messages, want 1", name, len(posted))
+		}
+		if lines := strings.Split(posted[0].Text, "\n")[1:]; len(lines) != len(want) {
+			t.Errorf("%s got %q, want %d releases", name, posted[0].Text, len(want))
+		}
+		for _, release := range want {
+			if !strings.Contains(posted[0].Text, release) {
+				t.Errorf("%s got %q, want it to list %s", name, posted[0].Text, release)
+			}
+		}
+	}
+	if channel := hooks.posted["platform"][0].Channel; channel != "#platform" {
+		t.Errorf("channel = %q, want the destination's", channel)
+	}
+}
+
+func TestSlackSendNoticeWithoutHook(t *testing.T) {
+	hooks, server := newSlackHooks(t)
+	s := &SlackSender{
+		Messages: locales["en"],
+		Routes: func(repoName string) []SlackDestination {
+			if repoName == "kubernetes/kubernetes" {
+				return []SlackDestination{{Hook: server.URL + "/platform"}}
+			}
+			return nil
+		},
+	}
+
+	for _, repoName := range []string{"kubernetes/kubernetes", "octocat/hello"} {
+		if err := s.SendNotice(Notice{Kind: NoticeArchived, Repository: repoName}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(hooks.posted) != 1 || len(hooks.posted["platform"]) != 1 {
+		t.Errorf("posted %v, want only the routed repository's notice", hooks.posted)
+	}
+}
+
+func TestSlackRetriesOnlyFailedDestinations(t *testing.T) {
+	hooks, server := newSlackHooks(t)
+	destinations := []SlackDestination{
+		{Name: "platform", Hook: server.URL + "/platform"},
+		{Name: "storage", Hook: server.URL + "/storage"},
+	}
+	s := &SlackSender{
+		Messages: locales["en"],
+		Routes:   func(string) []SlackDestination { return destinations },
+	}
+	store, err := NewFileStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &DeliveryLog{store: store}
+	repository := slackRepository("minio", "minio")
+
+	attempt := func() bool {
+		t.Helper()
+		delivered, err := log.Delivered(repository)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repository.delivered = delivered
+		retried, err := log.Record(repository, []SenderResult{{Sender: "slack", Err: s.Send(repository)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return retried
+	}
+
+	hooks.fail["storage"] = true
+	if !attempt() {
+		t.Fatal("release isn't retried after a destination failed")
+	}
+	if delivered, _ := log.Delivered(repository); len(delivered) != 1 || delivered[0] != "slack:platform" {
+		t.Errorf("delivered = %v, want slack:platform", delivered)
+	}
+
+	hooks.fail["storage"] = false
+	if attempt() {
+		t.Fatal("release is retried after all destinations delivered it")
+	}
+	if n := len(hooks.posted["platform"]); n != 1 {
+		t.Errorf("platform got %d messages, want 1", n)
+	}
+	if n := len(hooks.posted["storage"]); n != 1 {
+		t.Errorf("storage got %d messages, want 1", n)
+	}
+	if keys := mustKeys(t, store, deliveryKeyPrefix); len(keys) != 0 {
+		t.Errorf("deliveries = %v, want the release forgotten", keys)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// DefaultSlackDestination is the destination of the releases no route matches, if defined,
+// instead of SLACK_HOOK.
+const DefaultSlackDestination = "default"
+
+// SlackDestination is a Slack hook, posting to its own channel or, if set, to Channel.
+type SlackDestination struct {
+	Hook    string `yaml:"hook"`
+	Channel string `yaml:"channel"`
+	// Name is the destination's key in slack_destinations.
+	Name string `yaml:"-"`
+}
+
+// SlackRoute sends the releases of the repositories matching any of its patterns,
+// globs and regular expressions like the ones of INCLUDE, to its destinations.
+type SlackRoute struct {
+	Repositories []string `yaml:"repositories"`
+	Destinations []string `yaml:"destinations"`
+
+	patterns []repositoryPattern
+}
+
+// compile checks the route's destinations are defined and parses its patterns.
+func (r *SlackRoute) compile(destinations map[string]SlackDestination) error {
+	if len(r.Repositories) == 0 || len(r.Destinations) == 0 {
+		return fmt.Errorf("slack route needs repositories and destinations")
+	}
+	for _, name := range r.Destinations {
+		if _, ok := destinations[name]; !ok {
+			return fmt.Errorf("slack route uses unknown destination %q", name)
+		}
+	}
+	var err error
+	r.patterns, err = parseRepositoryPatterns(r.Repositories)
+	return err
+}
+
+// compileSlackRoutes expands environment variables like ${TEAM_A_SLACK_HOOK} in the destinations' hooks,
+// so hooks don't have to be in the file, and compiles the routes.
+func (f *FileConfig) compileSlackRoutes() error {
+	for name, destination := range f.SlackDestinations {
+		destination.Hook = os.ExpandEnv(destination.Hook)
+		if destination.Hook == "" {
+			return fmt.Errorf("slack destination %s has no hook", name)
+		}
+		destination.Name = name
+		f.SlackDestinations[name] = destination
+	}
+	for i := range f.SlackRoutes {
+		if err := f.SlackRoutes[i].compile(f.SlackDestinations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SlackDestinationsFor returns the destinations of the first route matching the repository given as owner/name,
+// the default destination if none does or, without one, nothing for SLACK_HOOK.
+func (f *FileConfig) SlackDestinationsFor(repoName string) []SlackDestination {
+	for _, route := range f.SlackRoutes {
+		for _, pattern := range route.patterns {
+			if !pattern.matches(repoName) {
+				continue
+			}
+			destinations := make([]SlackDestination, 0, len(route.Destinations))
+			for _, name := range route.Destinations {
+				destinations = append(destinations, f.SlackDestinations[name])
+			}
+			return destinations
+		}
+	}
+	if destination, ok := f.SlackDestinations[DefaultSlackDestination]; ok {
+		return []SlackDestination{destination}
+	}
+	return nil
+}
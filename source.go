@@ -0,0 +1,513 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// gitlabPrefix watches a project on a GitLab instance, e.g. gitlab:gitlab.com/gitlab-org/cli.
+	gitlabPrefix = "gitlab:"
+	// giteaPrefix watches a repository on a Gitea or Forgejo instance, e.g. gitea:codeberg.org/forgejo/forgejo.
+	giteaPrefix = "gitea:"
+)
+
+// Source is a forge other than GitHub whose repositories are watched, queried by the Checker
+// for the same Repository and Release as GitHub's.
+type Source interface {
+	// Repository returns the details of the repository, cached between checks like GitHub's.
+	Repository(ctx context.Context, owner, name string) (RepositoryMetadata, error)
+	// Releases returns up to count of the repository's most recent releases, the latest first.
+	Releases(ctx context.Context, owner, name string, count int) ([]Release, error)
+	// Tags returns the repository's most recently created tags as releases.
+	Tags(ctx context.Context, owner, name string, count int) ([]Release, error)
+}
+
+// splitSource returns the kind, host and owner/name of a repository given as gitlab:host/namespace/project
+// or gitea:host/owner/name. The owner of GitLab projects in subgroups is their whole namespace, like group/subgroup.
+func splitSource(entry string) (kind, host, repoName string, err error) {
+	switch {
+	case strings.HasPrefix(entry, gitlabPrefix):
+		kind = gitlabPrefix
+	case strings.HasPrefix(entry, giteaPrefix):
+		kind = giteaPrefix
+	default:
+		return "", "", entry, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(entry, kind), "/")
+	if !validRepoName(strings.TrimPrefix(entry, kind)) || len(parts) < 3 || kind == giteaPrefix && len(parts) != 3 {
+		return "", "", "", fmt.Errorf("repository %q is not of the form %shost/owner/name", entry, kind)
+	}
+	return kind, strings.ToLower(parts[0]), strings.Join(parts[1:], "/"), nil
+}
+
+// NewSource returns the source of the kind, gitlab: or gitea:, for the instance at host.
+// The token is optional for public repositories.
+func NewSource(kind, host, token string) Source {
+	if kind == gitlabPrefix {
+		return &GitlabSource{URL: "https://" + host, Token: token}
+	}
+	return &GiteaSource{URL: "https://" + host, Token: token}
+}
+
+// validRepoName returns true for repositories given as owner/name without empty parts,
+// where the owner may be a GitLab namespace like group/subgroup.
+func validRepoName(repoName string) bool {
+	parts := strings.Split(repoName, "/")
+	for _, part := range parts {
+		if part == "" {
+			return false
+		}
+	}
+	return len(parts) >= 2
+}
+
+// splitRepoName returns the owner and name of a repository given as owner/name.
+// The owner of a GitLab project may have slashes itself, the name never does.
+func splitRepoName(repoName string) (owner, name string) {
+	i := strings.LastIndex(repoName, "/")
+	return repoName[:i], repoName[i+1:]
+}
+
+// sourceError is returned for unexpected responses of a source's API.
+type sourceError struct {
+	URL  string
+	Code int
+	Body []byte
+}
+
+func (e *sourceError) Error() string {
+	// The status is given as code only, "401 Unauthorized" would be taken for GitHub rejecting the token.
+	switch e.Code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Sprintf("%s rejected the token, check FORGE_TOKENS: %d, %s", e.URL, e.Code, e.Body)
+	case http.StatusNotFound:
+		return fmt.Sprintf("%s wasn't found, the repository may not exist or be private: %d", e.URL, e.Code)
+	}
+	return fmt.Sprintf("%s didn't respond with 200 OK: %d, %s", e.URL, e.Code, e.Body)
+}
+
+// StatusCode returns the response's HTTP status code.
+func (e *sourceError) StatusCode() int {
+	return e.Code
+}
+
+// getJSON decodes the response to a GET of endpoint with the header, if set, into result.
+func getJSON(ctx context.Context, endpoint, header, value string, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if value != "" {
+		req.Header.Set(header, value)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		u := *req.URL
+		u.RawQuery = ""
+		return &sourceError{URL: u.String(), Code: resp.StatusCode, Body: body}
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// sourcePage returns how many releases to request for count of them,
+// a few more as some of them may be left out, like drafts.
+func sourcePage(count int) int {
+	if count < 10 {
+		return 10
+	}
+	return count
+}
+
+// sourceURL parses the web URL of a repository, release or asset returned by a source.
+func sourceURL(raw string) url.URL {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return url.URL{}
+	}
+	return *u
+}
+
+// GitlabSource watches the releases and tags of projects on a GitLab instance through its REST API.
+type GitlabSource struct {
+	URL   string
+	Token string
+}
+
+type gitlabUser struct {
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatar_url"`
+	WebURL    string `json:"web_url"`
+}
+
+// project returns the API endpoint of the project's path with the query.
+func (s *GitlabSource) project(owner, name, path string, query url.Values) string {
+	endpoint := strings.TrimSuffix(s.URL, "/") + "/api/v4/projects/" + url.PathEscape(owner+"/"+name) + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	return endpoint
+}
+
+// Repository returns the details of the project.
+func (s *GitlabSource) Repository(ctx context.Context, owner, name string) (RepositoryMetadata, error) {
+	var project struct {
+		ID            int    `json:"id"`
+		Path          string `json:"path"`
+		Description   string `json:"description"`
+		WebURL        string `json:"web_url"`
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := getJSON(ctx, s.project(owner, name, "", nil), "PRIVATE-TOKEN", s.Token, &project); err != nil {
+		return RepositoryMetadata{}, err
+	}
+	return RepositoryMetadata{
+		ID:            "gitlab:" + strings.TrimPrefix(s.URL, "https://") + "/" + strconv.Itoa(project.ID),
+		Name:          project.Path,
+		Description:   project.Description,
+		URL:           sourceURL(project.WebURL),
+		DefaultBranch: project.DefaultBranch,
+	}, nil
+}
+
+// Releases returns the project's most recently released releases, upcoming ones are left out.
+func (s *GitlabSource) Releases(ctx context.Context, owner, name string, count int) ([]Release, error) {
+	var releases []struct {
+		Name            string     `json:"name"`
+		TagName         string     `json:"tag_name"`
+		Description     string     `json:"description"`
+		CreatedAt       time.Time  `json:"created_at"`
+		ReleasedAt      time.Time  `json:"released_at"`
+		UpcomingRelease bool       `json:"upcoming_release"`
+		Author          gitlabUser `json:"author"`
+		Assets          struct {
+			Links []struct {
+				Name string `json:"name"`
+				URL  string `json:"url"`
+			} `json:"links"`
+		} `json:"assets"`
+		Links struct {
+			Self string `json:"self"`
+		} `json:"_links"`
+	}
+	query := url.Values{"per_page": {strconv.Itoa(sourcePage(count))}, "order_by": {"released_at"}}
+	if err := getJSON(ctx, s.project(owner, name, "/releases", query), "PRIVATE-TOKEN", s.Token, &releases); err != nil {
+		return nil, err
+	}
+
+	var result []Release
+	for _, r := range releases {
+		if r.UpcomingRelease {
+			continue
+		}
+		release := Release{
+			ID:              r.TagName,
+			Name:            r.Name,
+			TagName:         r.TagName,
+			Description:     r.Description,
+			URL:             sourceURL(r.Links.Self),
+			PublishedAt:     r.ReleasedAt,
+			CreatedAt:       r.CreatedAt,
+			Author:          r.Author.Username,
+			AuthorAvatarURL: r.Author.AvatarURL,
+			AuthorURL:       r.Author.WebURL,
+		}
+		// GitLab has no pre-releases, a version's pre-release part tells them apart.
+		if version, err := release.Version(); err == nil {
+			release.IsPrerelease = version.IsPrerelease()
+		}
+		for _, link := range r.Assets.Links {
+			release.Assets = append(release.Assets, Asset{Name: link.Name, URL: sourceURL(link.URL)})
+		}
+		if result = append(result, release); len(result) == count {
+			break
+		}
+	}
+	return result, nil
+}
+
+// Tags returns the project's most recently updated tags.
+func (s *GitlabSource) Tags(ctx context.Context, owner, name string, count int) ([]Release, error) {
+	var tags []struct {
+		Name      string     `json:"name"`
+		Message   string     `json:"message"`
+		CreatedAt *time.Time `json:"created_at"`
+		Commit    struct {
+			ID            string    `json:"id"`
+			CommittedDate time.Time `json:"committed_date"`
+		} `json:"commit"`
+	}
+	query := url.Values{"per_page": {strconv.Itoa(count)}, "order_by": {"updated"}}
+	if err := getJSON(ctx, s.project(owner, name, "/repository/tags", query), "PRIVATE-TOKEN", s.Token, &tags); err != nil {
+		return nil, err
+	}
+
+	web := strings.TrimSuffix(s.URL, "/") + "/" + owner + "/" + name + "/-/tags/"
+	var result []Release
+	for _, tag := range tags {
+		// Annotated tags were tagged when they were created, lightweight ones when their commit was committed.
+		published := tag.Commit.CommittedDate
+		if tag.CreatedAt != nil {
+			published = *tag.CreatedAt
+		}
+		result = append(result, Release{
+			ID:          tag.Name,
+			Name:        tag.Name,
+			TagName:     tag.Name,
+			Description: tag.Message,
+			URL:         sourceURL(web + url.PathEscape(tag.Name)),
+			PublishedAt: published,
+			CreatedAt:   published,
+		})
+	}
+	return result, nil
+}
+
+// GiteaSource watches the releases and tags of repositories on a Gitea or Forgejo instance through its REST API.
+type GiteaSource struct {
+	URL   string
+	Token string
+}
+
+// repository returns the API endpoint of the repository's path with the query.
+func (s *GiteaSource) repository(owner, name, path string, query url.Values) string {
+	endpoint := strings.TrimSuffix(s.URL, "/") + "/api/v1/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name) + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	return endpoint
+}
+
+// authorization returns the value of the Authorization header with the token, if there is one.
+func (s *GiteaSource) authorization() string {
+	if s.Token == "" {
+		return ""
+	}
+	return "token " + s.Token
+}
+
+// Repository returns the details of the repository.
+func (s *GiteaSource) Repository(ctx context.Context, owner, name string) (RepositoryMetadata, error) {
+	var repository struct {
+		ID            int    `json:"id"`
+		Name          string `json:"name"`
+		Description   string `json:"description"`
+		HTMLURL       string `json:"html_url"`
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := getJSON(ctx, s.repository(owner, name, "", nil), "Authorization", s.authorization(), &repository); err != nil {
+		return RepositoryMetadata{}, err
+	}
+	return RepositoryMetadata{
+		ID:            "gitea:" + strings.TrimPrefix(s.URL, "https://") + "/" + strconv.Itoa(repository.ID),
+		Name:          repository.Name,
+		Description:   repository.Description,
+		URL:           sourceURL(repository.HTMLURL),
+		DefaultBranch: repository.DefaultBranch,
+	}, nil
+}
+
+// Releases returns the repository's most recent published releases, drafts are left out.
+func (s *GiteaSource) Releases(ctx context.Context, owner, name string, count int) ([]Release, error) {
+	var releases []struct {
+		ID          int       `json:"id"`
+		TagName     string    `json:"tag_name"`
+		Name        string    `json:"name"`
+		Body        string    `json:"body"`
+		Draft       bool      `json:"draft"`
+		Prerelease  bool      `json:"prerelease"`
+		CreatedAt   time.Time `json:"created_at"`
+		PublishedAt time.Time `json:"published_at"`
+		HTMLURL     string    `json:"html_url"`
+		Author      struct {
+			Login     string `json:"login"`
+			AvatarURL string `json:"avatar_url"`
+			HTMLURL   string `json:"html_url"`
+		} `json:"author"`
+		Assets []struct {
+			Name          string `json:"name"`
+			DownloadCount int    `json:"download_count"`
+			DownloadURL   string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	query := url.Values{"limit": {strconv.Itoa(sourcePage(count))}, "draft": {"false"}}
+	if err := getJSON(ctx, s.repository(owner, name, "/releases", query), "Authorization", s.authorization(), &releases); err != nil {
+		return nil, err
+	}
+
+	var result []Release
+	for _, r := range releases {
+		// Older versions ignore the draft parameter.
+		if r.Draft {
+			continue
+		}
+		release := Release{
+			ID:              strconv.Itoa(r.ID),
+			Name:            r.Name,
+			TagName:         r.TagName,
+			IsPrerelease:    r.Prerelease,
+			Description:     r.Body,
+			URL:             sourceURL(r.HTMLURL),
+			PublishedAt:     r.PublishedAt,
+			CreatedAt:       r.CreatedAt,
+			Author:          r.Author.Login,
+			AuthorAvatarURL: r.Author.AvatarURL,
+			AuthorURL:       r.Author.HTMLURL,
+		}
+		for _, asset := range r.Assets {
+			release.Assets = append(release.Assets, Asset{
+				Name:      asset.Name,
+				URL:       sourceURL(asset.DownloadURL),
+				Downloads: asset.DownloadCount,
+			})
+		}
+		if result = append(result, release); len(result) == count {
+			break
+		}
+	}
+	return result, nil
+}
+
+// Tags returns the repository's most recent tags.
+func (s *GiteaSource) Tags(ctx context.Context, owner, name string, count int) ([]Release, error) {
+	var tags []struct {
+		Name    string `json:"name"`
+		Message string `json:"message"`
+		Commit  struct {
+			SHA     string    `json:"sha"`
+			Created time.Time `json:"created"`
+		} `json:"commit"`
+	}
+	query := url.Values{"limit": {strconv.Itoa(count)}}
+	if err := getJSON(ctx, s.repository(owner, name, "/tags", query), "Authorization", s.authorization(), &tags); err != nil {
+		return nil, err
+	}
+
+	web := strings.TrimSuffix(s.URL, "/") + "/" + owner + "/" + name + "/releases/tag/"
+	var result []Release
+	for _, tag := range tags {
+		result = append(result, Release{
+			ID:          tag.Name,
+			Name:        tag.Name,
+			TagName:     tag.Name,
+			Description: strings.TrimSpace(tag.Message),
+			URL:         sourceURL(web + url.PathEscape(tag.Name)),
+			PublishedAt: tag.Commit.Created,
+			CreatedAt:   tag.Commit.Created,
+		})
+	}
+	return result, nil
+}
+
+// querySource queries the latest release or tag of the key on its source.
+func (c *Checker) querySource(ctx context.Context, span *Span, source Source, key string) (Repository, error) {
+	repoName := keyRepository(key)
+	owner, name := splitRepoName(repoName)
+	span.SetAttribute("source", true)
+	if key != repoName && key != repoName+tagsSuffix {
+		return Repository{}, fmt.Errorf("discussions are only watched on GitHub, not for %s", repoName)
+	}
+
+	metadata, cached := c.metadata.Get(repoName)
+	if !cached {
+		var err error
+		if metadata, err = source.Repository(ctx, owner, name); err != nil {
+			return Repository{}, err
+		}
+		c.metadata.Put(repoName, metadata)
+	}
+	span.SetAttribute("metadata.cached", cached)
+	repository := Repository{
+		ID:            metadata.ID,
+		Name:          name,
+		Owner:         owner,
+		Description:   metadata.Description,
+		URL:           metadata.URL,
+		DefaultBranch: metadata.DefaultBranch,
+	}
+
+	if key == repoName {
+		// With a release line the latest release may be on another one,
+		// so look at the recent releases for the latest on the line.
+		count := 1
+		line, hasLine := c.releaseLines[repoName]
+		if hasLine {
+			count = releaseLineLookback
+		}
+		releases, err := source.Releases(ctx, owner, name, count)
+		if err != nil {
+			return Repository{}, err
+		}
+		for _, release := range releases {
+			if !hasLine {
+				repository.Release = release
+				return repository, nil
+			}
+			if version, err := ParseVersion(release.TagName); err == nil && line.Contains(version) {
+				repository.Release = release
+				return repository, nil
+			}
+		}
+		if hasLine && len(releases) > 0 {
+			return Repository{}, errNoReleaseOnLine
+		}
+		return Repository{}, fmt.Errorf("can't find any releases for %s", repoName)
+	}
+
+	span.SetAttribute("tags", true)
+	tags, err := source.Tags(ctx, owner, name, tagsLookback)
+	if err != nil {
+		return Repository{}, err
+	}
+	var latestVersion Version
+	found := false
+	for _, tag := range tags {
+		version, err := ParseVersion(tag.TagName)
+		if !isFullVersion(tag.TagName) || err != nil || found && version.Compare(latestVersion) <= 0 {
+			continue
+		}
+		tag.IsPrerelease = version.IsPrerelease()
+		repository.Release, latestVersion, found = tag, version, true
+	}
+	if !found {
+		return Repository{}, fmt.Errorf("can't find any version tags for %s", repoName)
+	}
+	return repository, nil
+}
+
+// sourceReleaseExists returns true if the release is still among the repository's recent releases or tags on the source.
+func sourceReleaseExists(source Source, owner, name string, release Release) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	releases, err := source.Releases(ctx, owner, name, releaseLineLookback)
+	if err != nil {
+		return false, err
+	}
+	tags, err := source.Tags(ctx, owner, name, tagsLookback)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range append(releases, tags...) {
+		if r.Key() == release.Key() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS releases (
+	owner        TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	tag          TEXT NOT NULL,
+	url          TEXT NOT NULL,
+	published_at TEXT NOT NULL,
+	prerelease   INTEGER NOT NULL,
+	body         TEXT NOT NULL,
+	detected_at  TEXT NOT NULL,
+	PRIMARY KEY (owner, name, tag)
+);
+`
+
+// SQLiteSender records every release in a SQLite database.
+// It uses the sqlite3 command line tool so the binary can stay statically linked.
+type SQLiteSender struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Send inserts a row for the repository's release, creating the schema if needed.
+// Rows are keyed on owner, name and tag, so seeing a release again updates its row.
+func (s *SQLiteSender) Send(repository Repository) error {
+	release := repository.Release
+
+	prerelease := 0
+	if release.IsPrerelease {
+		prerelease = 1
+	}
+
+	var stmt strings.Builder
+	stmt.WriteString(".bail on\n.timeout 5000\n")
+	stmt.WriteString(sqliteSchema)
+	fmt.Fprintf(&stmt,
+		`INSERT INTO releases (owner, name, tag, url, published_at, prerelease, body, detected_at)
+VALUES (%s, %s, %s, %s, %s, %d, %s, %s)
+ON CONFLICT (owner, name, tag) DO UPDATE SET
+	url = excluded.url,
+	published_at = excluded.published_at,
+	prerelease = excluded.prerelease,
+	body = excluded.body;
+`,
+		sqliteQuote(repository.Owner),
+		sqliteQuote(repository.Name),
+		sqliteQuote(release.Key()),
+		sqliteQuote(release.URL.String()),
+		sqliteQuote(release.PublishedAt.UTC().Format(time.RFC3339)),
+		prerelease,
+		sqliteQuote(release.Description),
+		sqliteQuote(time.Now().UTC().Format(time.RFC3339)),
+	)
+
+	// Different repositories are delivered in parallel,
+	// but the database only takes one writer at a time.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sqlite3", s.Path)
+	cmd.Stdin = strings.NewReader(stmt.String())
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write release to %s: %v: %s", s.Path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// sqliteQuote returns s as a SQL string literal.
+func sqliteQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
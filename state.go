@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store persists state between runs as JSON values under string keys.
+type Store interface {
+	// Get decodes the value stored under key into value.
+	// It returns false if there is no such key.
+	Get(key string, value interface{}) (bool, error)
+	// Put stores value under key.
+	Put(key string, value interface{}) error
+	// Keys returns all keys starting with prefix.
+	Keys(prefix string) ([]string, error)
+	// Delete removes the keys.
+	Delete(keys ...string) error
+	// Flush persists changes held back, if the store batches them.
+	Flush() error
+}
+
+// When changes of the state are written to the file.
+const (
+	// StateWritesCycle writes them once at the end of every check cycle and on shutdown.
+	StateWritesCycle = "cycle"
+	// StateWritesImmediate writes them right away.
+	StateWritesImmediate = "immediate"
+)
+
+// FileStore keeps all state in a single JSON file.
+// With an empty path it only keeps the state in memory.
+//
+// Instances sharing the file keep their keys apart by namespace, prefixed to
+// the keys in the file like team-a:release/owner/name. A store only sees the keys
+// of its own namespace and keeps the others' when writing.
+type FileStore struct {
+	path   string
+	prefix string
+
+	mu     sync.Mutex
+	values map[string]json.RawMessage
+	// batch holds back writing changes until Flush, dirty tells if there are any.
+	batch bool
+	dirty bool
+}
+
+// stateWriteLockTimeout is how long to wait for other instances sharing the state file to finish writing it.
+const stateWriteLockTimeout = 10 * time.Second
+
+// NewFileStore loads the state of the namespace from the file at path, if it exists.
+// The empty namespace has the keys without one.
+func NewFileStore(path, namespace string) (*FileStore, error) {
+	s := &FileStore{
+		path:   path,
+		values: make(map[string]json.RawMessage),
+	}
+	if namespace != "" {
+		s.prefix = namespace + ":"
+	}
+
+	values, err := readState(path)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range values {
+		if own, ok := s.own(key); ok {
+			s.values[own] = value
+		}
+	}
+	return s, nil
+}
+
+// ReadOnly keeps all changes from now on in memory only, e.g. for a dry run.
+func (s *FileStore) ReadOnly() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = ""
+}
+
+// ValidateStateNamespace returns an error for namespaces unfit for keys and lock file names.
+func ValidateStateNamespace(namespace string) error {
+	for _, c := range namespace {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return fmt.Errorf("state namespace %q may only contain letters, digits, '-', '_' and '.'", namespace)
+		}
+	}
+	return nil
+}
+
+// readState reads all keys in the state file at path, if it exists.
+func readState(path string) (map[string]json.RawMessage, error) {
+	values := make(map[string]json.RawMessage)
+	if path == "" {
+		return values, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("can't read state from %s: %v", path, err)
+	}
+	return values, nil
+}
+
+// own returns the key without the store's namespace and true
+// if a key of the file is in the namespace.
+func (s *FileStore) own(key string) (string, bool) {
+	if s.prefix != "" {
+		if strings.HasPrefix(key, s.prefix) {
+			return strings.TrimPrefix(key, s.prefix), true
+		}
+		return "", false
+	}
+	// Keys without a namespace start with a prefix like release/.
+	i := strings.Index(key, ":")
+	return key, i < 0 || strings.Contains(key[:i], "/")
+}
+
+// Get implements Store.
+func (s *FileStore) Get(key string, value interface{}) (bool, error) {
+	s.mu.Lock()
+	data, ok := s.values[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+// Keys implements Store.
+func (s *FileStore) Keys(prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for key := range s.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Put implements Store and writes the whole file, unless writes are batched.
+func (s *FileStore) Put(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = data
+	return s.changed()
+}
+
+// Delete implements Store and writes the whole file, unless writes are batched.
+func (s *FileStore) Delete(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.values, key)
+	}
+	return s.changed()
+}
+
+// Batch holds back writing changes until Flush, so busy cycles don't write the file for every release.
+func (s *FileStore) Batch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batch = true
+}
+
+// Flush implements Store and writes the file if there are changes held back.
+func (s *FileStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	if err := s.write(s.path); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// changed writes the file or, with batched writes, remembers to on Flush.
+// It must be called with mu held.
+func (s *FileStore) changed() error {
+	if s.batch {
+		s.dirty = true
+		return nil
+	}
+	return s.write(s.path)
+}
+
+// Backup writes the current state next to the file, with a .bak suffix,
+// replacing any older backup.
+func (s *FileStore) Backup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "" {
+		return nil
+	}
+	return s.write(s.path + ".bak")
+}
+
+// write writes the state to path along with the other namespaces' keys in the file.
+// It must be called with mu held.
+func (s *FileStore) write(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	// Other instances sharing the file may write it at the same time,
+	// their keys must not get lost in between reading and writing it.
+	lock, err := AcquireLockWait(s.path+".write.lock", stateWriteLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	values, err := readState(s.path)
+	if err != nil {
+		return err
+	}
+	for key := range values {
+		if _, ok := s.own(key); ok {
+			delete(values, key)
+		}
+	}
+	for key, value := range s.values {
+		values[s.prefix+key] = value
+	}
+
+	state, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, state, 0600)
+}
+
+// writeFileAtomic writes data to a temporary file first and renames it to path,
+// so a crash while writing doesn't leave a truncated file behind.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// storedRelease is the part of a release that is remembered between runs.
+type storedRelease struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	TagName     string    `json:"tag_name"`
+	PublishedAt time.Time `json:"published_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const releaseKeyPrefix = "release/"
+
+func releaseKey(repoName string) string {
+	return releaseKeyPrefix + repoName
+}
+
+// CompactState removes the state of repositories that aren't watched anymore.
+// It returns the removed keys.
+func CompactState(store Store, repositories []string) ([]string, error) {
+	watched := make([]string, 0, len(repositories))
+	for _, key := range repositories {
+		watched = append(watched, keyRepository(key))
+	}
+
+	var stale []string
+	for _, prefix := range []string{releaseKeyPrefix, gitlabIssueKeyPrefix, prereleaseKeyPrefix, cooldownKeyPrefix, lifecycleKeyPrefix, historyKeyPrefix, checksKeyPrefix, assetsKeyPrefix, deliveryKeyPrefix, digestKeyPrefix, pausedKeyPrefix} {
+		keys, err := store.Keys(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			repoName := keyRepository(strings.TrimPrefix(key, prefix))
+			if !containsFold(watched, repoName) {
+				stale = append(stale, key)
+			}
+		}
+	}
+
+	if len(stale) == 0 {
+		return nil, nil
+	}
+	return stale, store.Delete(stale...)
+}
+
+// stateExportVersion is bumped whenever the export format changes incompatibly.
+const stateExportVersion = 1
+
+// stateExport is the format of --export-state and --import-state.
+type stateExport struct {
+	Version int `json:"version"`
+	// Releases are the last seen releases by owner/name.
+	Releases map[string]storedRelease `json:"releases"`
+}
+
+// ExportState writes the last seen releases as JSON.
+func ExportState(store Store, w io.Writer) error {
+	keys, err := store.Keys(releaseKeyPrefix)
+	if err != nil {
+		return err
+	}
+
+	export := stateExport{
+		Version:  stateExportVersion,
+		Releases: make(map[string]storedRelease, len(keys)),
+	}
+	for _, key := range keys {
+		var release storedRelease
+		if _, err := store.Get(key, &release); err != nil {
+			return err
+		}
+		export.Releases[strings.TrimPrefix(key, releaseKeyPrefix)] = release
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(export)
+}
+
+// ImportState reads last seen releases written by ExportState,
+// replacing the ones of the same repositories. It returns the number of releases imported.
+func ImportState(store Store, r io.Reader) (int, error) {
+	var export stateExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return 0, err
+	}
+	if export.Version != stateExportVersion {
+		return 0, fmt.Errorf("unsupported state version %d, expected %d", export.Version, stateExportVersion)
+	}
+
+	for repoName, release := range export.Releases {
+		if !validRepoName(keyRepository(repoName)) {
+			return 0, fmt.Errorf("repository %q is not of the form owner/name", repoName)
+		}
+		if err := store.Put(releaseKey(repoName), release); err != nil {
+			return 0, err
+		}
+	}
+	return len(export.Releases), nil
+}
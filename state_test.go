@@ -0,0 +1,380 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func tempStateDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// dirEntries returns the names of the files in dir.
+func dirEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := tempStateDir(t)
+	path := filepath.Join(dir, "state.json")
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new" {
+		t.Errorf("file = %q, want %q", data, "new")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("file mode = %v, want %v", perm, os.FileMode(0600))
+	}
+	if names := dirEntries(t, dir); len(names) != 1 {
+		t.Errorf("files = %v, want only the state file", names)
+	}
+}
+
+func TestWriteFileAtomicKeepsFileOnError(t *testing.T) {
+	dir := tempStateDir(t)
+	// Renaming onto a directory that isn't empty fails after the data was written.
+	path := filepath.Join(dir, "state.json")
+	if err := os.Mkdir(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, "keep"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new"), 0600); err == nil {
+		t.Fatal("writeFileAtomic succeeded, want an error")
+	}
+	if names := dirEntries(t, dir); len(names) != 1 || names[0] != "state.json" {
+		t.Errorf("files = %v, want the temporary file removed", names)
+	}
+	if names := dirEntries(t, path); len(names) != 1 {
+		t.Errorf("files = %v, want the existing one kept", names)
+	}
+}
+
+func TestFileStorePersists(t *testing.T) {
+	path := filepath.Join(tempStateDir(t), "state.json")
+	store, err := NewFileStore(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := storedRelease{ID: "1", TagName: "v1.0.0"}
+	if err := store.Put(releaseKey("octocat/hello"), release); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(releaseKey("octocat/gone"), release); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(releaseKey("octocat/gone")); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := NewFileStore(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := mustKeys(t, loaded, releaseKeyPrefix); len(keys) != 1 || keys[0] != releaseKey("octocat/hello") {
+		t.Fatalf("keys = %v, want only %s", keys, releaseKey("octocat/hello"))
+	}
+	var got storedRelease
+	if ok, err := loaded.Get(releaseKey("octocat/hello"), &got); !ok || err != nil {
+		t.Fatalf("Get() = %v, %v", ok, err)
+	}
+	if got != release {
+		t.Errorf("release = %+v, want %+v", got, release)
+	}
+}
+
+func TestFileStoreBatch(t *testing.T) {
+	path := filepath.Join(tempStateDir(t), "state.json")
+	store, err := NewFileStore(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Batch()
+	if err := store.Put(releaseKey("octocat/hello"), storedRelease{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("state written before flushing: %v", err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewFileStore(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := mustKeys(t, loaded, releaseKeyPrefix); len(keys) != 1 {
+		t.Errorf("keys after flushing = %v, want the release", keys)
+	}
+}
+
+func TestFileStoreBackup(t *testing.T) {
+	path := filepath.Join(tempStateDir(t), "state.json")
+	store, err := NewFileStore(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(releaseKey("octocat/hello"), storedRelease{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Backup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(releaseKey("octocat/hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := NewFileStore(path+".bak", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := mustKeys(t, backup, releaseKeyPrefix); len(keys) != 1 {
+		t.Errorf("keys of the backup = %v, want the release from before deleting it", keys)
+	}
+}
+
+func TestFileStoreRejectsCorruptState(t *testing.T) {
+	path := filepath.Join(tempStateDir(t), "state.json")
+	if err := ioutil.WriteFile(path, []byte(`{"release/octocat/hello": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path, ""); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("NewFileStore() = %v, want an error naming the file", err)
+	}
+}
+
+func TestCompactState(t *testing.T) {
+	store, err := NewFileStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{
+		releaseKey("octocat/hello"),
+		releaseKey("octocat/hello#assets"),
+		historyKeyPrefix + "octocat/hello",
+		deliveryKeyPrefix + "octocat/hello#v1.0.0",
+		digestKeyPrefix + "octocat/hello#v1.0.0",
+		releaseKey("octocat/gone"),
+		cooldownKeyPrefix + "octocat/gone",
+		deliveryKeyPrefix + "octocat/gone#v1.0.0",
+		gitlabIssueKeyPrefix + "platform/tools/cli",
+		// Keys of other kinds are left alone.
+		inboxKeyPrefix + "00000000000000000001",
+	}
+	for _, key := range keys {
+		if err := store.Put(key, struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := CompactState(store, []string{"OctoCat/Hello", "platform/tools/cli"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		releaseKey("octocat/gone"),
+		cooldownKeyPrefix + "octocat/gone",
+		deliveryKeyPrefix + "octocat/gone#v1.0.0",
+	}
+	if strings.Join(sortedCopy(removed), ",") != strings.Join(sortedCopy(want), ",") {
+		t.Errorf("removed %v, want %v", removed, want)
+	}
+	for _, key := range want {
+		if ok, _ := store.Get(key, &struct{}{}); ok {
+			t.Errorf("%s wasn't removed", key)
+		}
+	}
+	if left := mustKeys(t, store, ""); len(left) != len(keys)-len(want) {
+		t.Errorf("keys left = %v, want %d", left, len(keys)-len(want))
+	}
+
+	if removed, err := CompactState(store, []string{"octocat/hello", "platform/tools/cli"}); err != nil || len(removed) != 0 {
+		t.Errorf("compacting again = %v, %v, want nothing removed", removed, err)
+	}
+}
+
+func sortedCopy(list []string) []string {
+	sorted := append([]string(nil), list...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func TestFileStoreNamespaces(t *testing.T) {
+	path := filepath.Join(tempStateDir(t), "state.json")
+	stores := make(map[string]*FileStore)
+	for _, namespace := range []string{"", "team-a", "team-b"} {
+		store, err := NewFileStore(path, namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores[namespace] = store
+	}
+	// Every instance writes the same key, none of them overwrites the others'.
+	for namespace, store := range stores {
+		if err := store.Put(releaseKey("octocat/hello"), storedRelease{ID: namespace}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stores["team-b"].Delete(releaseKey("octocat/hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := readState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	if want := "release/octocat/hello,team-a:release/octocat/hello"; strings.Join(sortedCopy(keys), ",") != want {
+		t.Errorf("keys in the file = %v, want %s", keys, want)
+	}
+
+	for namespace, want := range map[string]string{"": "", "team-a": "team-a", "team-b": "none"} {
+		store, err := NewFileStore(path, namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var release storedRelease
+		ok, err := store.Get(releaseKey("octocat/hello"), &release)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case want == "none" && ok:
+			t.Errorf("namespace %q: found %+v after deleting it", namespace, release)
+		case want != "none" && (!ok || release.ID != want):
+			t.Errorf("namespace %q: release = %+v, %v, want its own", namespace, release, ok)
+		}
+		if keys := mustKeys(t, store, ""); len(keys) > 1 {
+			t.Errorf("namespace %q sees %v, want only its own key", namespace, keys)
+		}
+	}
+}
+
+func TestFileStoreOwnKeys(t *testing.T) {
+	tests := []struct {
+		namespace string
+		key       string
+		own       string
+		ok        bool
+	}{
+		{"", "release/octocat/hello", "release/octocat/hello", true},
+		// Colons after the key's prefix aren't namespaces.
+		{"", "checks/octocat/hello#ci:build", "checks/octocat/hello#ci:build", true},
+		{"", "team-a:release/octocat/hello", "", false},
+		{"team-a", "team-a:release/octocat/hello", "release/octocat/hello", true},
+		{"team-a", "team-ab:release/octocat/hello", "", false},
+		{"team-a", "release/octocat/hello", "", false},
+	}
+	for _, tt := range tests {
+		store, err := NewFileStore("", tt.namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if own, ok := store.own(tt.key); ok != tt.ok || ok && own != tt.own {
+			t.Errorf("namespace %q: own(%q) = %q, %v, want %q, %v", tt.namespace, tt.key, own, ok, tt.own, tt.ok)
+		}
+	}
+}
+
+func TestValidateStateNamespace(t *testing.T) {
+	for _, namespace := range []string{"", "team-a", "Team_B.1"} {
+		if err := ValidateStateNamespace(namespace); err != nil {
+			t.Errorf("ValidateStateNamespace(%q) = %v", namespace, err)
+		}
+	}
+	for _, namespace := range []string{"team:a", "team/a", "team a", "../state"} {
+		if err := ValidateStateNamespace(namespace); err == nil {
+			t.Errorf("ValidateStateNamespace(%q) succeeded, want an error", namespace)
+		}
+	}
+}
+
+func TestExportImportState(t *testing.T) {
+	exported, err := NewFileStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releases := map[string]storedRelease{
+		"octocat/hello":       {ID: "1", TagName: "v1.0.0"},
+		"octocat/hello#tags":  {ID: "2", TagName: "v1.1.0"},
+		"platform/tools/cli":  {ID: "3", TagName: "v2.0.0"},
+		"gitea-org/some-repo": {ID: "4", TagName: "v0.1.0"},
+	}
+	for repoName, release := range releases {
+		if err := exported.Put(releaseKey(repoName), release); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf strings.Builder
+	if err := ExportState(exported, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := NewFileStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := ImportState(imported, strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(releases) {
+		t.Errorf("imported %d releases, want %d", n, len(releases))
+	}
+	for repoName, want := range releases {
+		var got storedRelease
+		if ok, err := imported.Get(releaseKey(repoName), &got); !ok || err != nil || got != want {
+			t.Errorf("%s: imported %+v, %v, %v, want %+v", repoName, got, ok, err, want)
+		}
+	}
+}
+
+func TestImportStateRejectsInvalidRepositories(t *testing.T) {
+	for _, repoName := range []string{"hello", "octocat/", "/hello", "platform//cli", "#tags"} {
+		store, err := NewFileStore("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := `{"version": 1, "releases": {"` + repoName + `": {"id": "1"}}}`
+		if _, err := ImportState(store, strings.NewReader(state)); err == nil {
+			t.Errorf("importing %q succeeded, want an error", repoName)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	githubql "github.com/shurcooL/githubql"
+)
+
+const (
+	// actionPrefix watches the tags of the repository behind a GitHub Action,
+	// e.g. action:actions/checkout or action:github/codeql-action/analyze.
+	actionPrefix = "action:"
+	// tagsSuffix is appended to a repository's name to keep track of
+	// its tags separately from its releases.
+	tagsSuffix = "#tags"
+	// tagsLookback is how many of the most recent tags are searched for the highest version.
+	tagsLookback = 30
+)
+
+// The modes of watching repositories, see MODE.
+const (
+	// ModeReleases watches the repositories' GitHub Releases.
+	ModeReleases = "releases"
+	// ModeTags watches the repositories' version tags instead, for projects that only push tags.
+	ModeTags = "tags"
+	// ModeBoth watches both, tags without a release of their own are notified, too.
+	ModeBoth = "both"
+)
+
+// validMode returns true if mode is one of the modes of watching repositories.
+func validMode(mode string) bool {
+	return mode == ModeReleases || mode == ModeTags || mode == ModeBoth
+}
+
+// actionRepository returns the owner/name of the repository behind an action given as owner/name[/path].
+func actionRepository(action string) (string, error) {
+	parts := strings.Split(action, "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("action %q is not of the form owner/name", action)
+	}
+	return parts[0] + "/" + parts[1], nil
+}
+
+// isFullVersion returns true for tags like v4.1.2, but not for the major and minor tags
+// like v4 or v4.1 that actions move along to their latest release.
+func isFullVersion(tag string) bool {
+	core := strings.TrimPrefix(strings.TrimPrefix(tag, "v"), "V")
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+	if strings.Count(core, ".") != 2 {
+		return false
+	}
+	_, err := ParseVersion(tag)
+	return err == nil
+}
+
+// queryTags returns the repository with its highest full version tag as its release.
+// Tags are published when their commit was committed or, for annotated tags, when they were tagged.
+func (c *Checker) queryTags(ctx context.Context, span *Span, owner, name string) (Repository, error) {
+	var query struct {
+		RateLimit  rateLimit
+		Repository struct {
+			ID          githubql.ID
+			Name        githubql.String
+			Description githubql.String
+			URL         githubql.URI
+
+			Refs struct {
+				Nodes []struct {
+					ID     githubql.ID
+					Name   githubql.String
+					Target struct {
+						Commit struct {
+							CommittedDate githubql.DateTime
+						} `graphql:"... on Commit"`
+						Tag struct {
+							Message githubql.String
+							Tagger  *struct {
+								Date githubql.GitTimestamp
+							}
+						} `graphql:"... on Tag"`
+					}
+				}
+			} `graphql:"refs(refPrefix: \"refs/tags/\", first: $tags, orderBy: {field: TAG_COMMIT_DATE, direction: DESC})"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner": githubql.String(owner),
+		"name":  githubql.String(name),
+		"tags":  githubql.Int(tagsLookback),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout(5*time.Second))
+	defer cancel()
+	if err := c.clientFor(owner+"/"+name).Query(ctx, &query, variables); err != nil {
+		return Repository{}, err
+	}
+	query.RateLimit.record(span)
+
+	repositoryID, ok := query.Repository.ID.(string)
+	if !ok {
+		return Repository{}, fmt.Errorf("can't convert repository id to string: %v", query.Repository.ID)
+	}
+
+	var latest *Release
+	var latestVersion Version
+	for _, node := range query.Repository.Refs.Nodes {
+		tag := string(node.Name)
+		if !isFullVersion(tag) {
+			continue
+		}
+		version, _ := ParseVersion(tag)
+		if latest != nil && version.Compare(latestVersion) <= 0 {
+			continue
+		}
+
+		refID, ok := node.ID.(string)
+		if !ok {
+			return Repository{}, fmt.Errorf("can't convert ref id to string: %v", node.ID)
+		}
+		published := node.Target.Commit.CommittedDate.Time
+		if node.Target.Tag.Tagger != nil {
+			published = node.Target.Tag.Tagger.Date.Time
+		}
+		releaseURL := *query.Repository.URL.URL
+		releaseURL.Path += "/releases/tag/" + url.PathEscape(tag)
+
+		latest = &Release{
+			ID:           refID,
+			Name:         tag,
+			TagName:      tag,
+			IsPrerelease: version.IsPrerelease(),
+			Description:  string(node.Target.Tag.Message),
+			URL:          releaseURL,
+			PublishedAt:  published,
+			CreatedAt:    published,
+		}
+		latestVersion = version
+	}
+	if latest == nil {
+		return Repository{}, fmt.Errorf("can't find any version tags for %s/%s", owner, name)
+	}
+
+	return Repository{
+		ID:          repositoryID,
+		Name:        string(query.Repository.Name),
+		Owner:       owner,
+		Description: string(query.Repository.Description),
+		URL:         *query.Repository.URL.URL,
+		Release:     *latest,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// teamsMaxText keeps a card's text well below the 28 KB Microsoft Teams accepts for a whole message.
+const teamsMaxText = 20000
+
+// TeamsSender posts releases to a Microsoft Teams channel through its incoming webhook, as message cards.
+type TeamsSender struct {
+	Hook string
+	// Fields of the release to include, its linked name and notes by default.
+	Fields   NotificationFields
+	Messages Messages
+	// Template, if set, renders the card's text instead of Fields, see MessageData.
+	Template *template.Template
+}
+
+type teamsMessageCard struct {
+	Type            string        `json:"@type"`
+	Context         string        `json:"@context"`
+	Summary         string        `json:"summary"`
+	Title           string        `json:"title"`
+	Text            string        `json:"text,omitempty"`
+	PotentialAction []teamsAction `json:"potentialAction,omitempty"`
+}
+
+type teamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []teamsTarget `json:"targets"`
+}
+
+type teamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+// Send posts the repository's release as a card linking to the repository and the release.
+func (s *TeamsSender) Send(repository Repository) error {
+	fields := s.Fields.Or(FieldURL, FieldBody)
+	release := repository.Release
+
+	summary := fmt.Sprintf("%s/%s: %s %s", repository.Owner, repository.Name, release.Name, s.Messages.Action(repository))
+	name := release.Name
+	if fields.Has(FieldURL) {
+		name = fmt.Sprintf("[%s](%s)", name, release.URL.String())
+	}
+	card := teamsMessageCard{
+		Type:    "MessageCard",
+		Context: "https://schema.org/extensions",
+		Summary: summary,
+		Title:   summary,
+		Text:    fmt.Sprintf("[%s/%s](%s): %s %s", repository.Owner, repository.Name, repository.URL.String(), name, s.Messages.Action(repository)),
+	}
+
+	// Teams' Markdown needs an empty line to break lines.
+	text := []string{card.Text}
+	if s.Template != nil {
+		rendered, err := renderMessage(s.Template, repository, s.Messages)
+		if err != nil {
+			return err
+		}
+		text = []string{truncate(teamsMaxText, rendered)}
+	} else {
+		text = append(text, fields.Details(release, s.Messages)...)
+		if fields.Has(FieldBody) && release.Description != "" {
+			if release.FullDescription != "" {
+				release.Description = release.FullDescription
+			}
+			text = append(text, release.Normalized(teamsMaxText, s.Messages).Description)
+		}
+	}
+	card.Text = strings.Join(text, "\n\n")
+
+	if fields.Has(FieldURL) {
+		card.PotentialAction = []teamsAction{{
+			Type:    "OpenUri",
+			Name:    release.Name,
+			Targets: []teamsTarget{{OS: "default", URI: release.URL.String()}},
+		}}
+	}
+
+	return postJSON(s.Hook, card)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// templateFuncs are the functions of message and webhook templates besides those of text/template.
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. {{json .Release.Body}}.
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// mrkdwn converts Markdown, like release notes, to Slack's mrkdwn, e.g. {{mrkdwn .Release.Description}}.
+	"mrkdwn": markdownToMrkdwn,
+	// truncate cuts a text to at most n bytes, e.g. {{truncate 500 .Release.Description}}.
+	"truncate": truncate,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"join":     strings.Join,
+}
+
+// MessageData is what message templates render: the repository with its release, e.g. {{.Release.TagName}},
+// and the action in the message's language, e.g. released.
+type MessageData struct {
+	Repository
+	Action string
+}
+
+// LoadMessageTemplate parses the template of a sender's messages from the file at path.
+func LoadMessageTemplate(sender, path string) (*template.Template, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s template: %v", sender, err)
+	}
+	t, err := template.New(sender).Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("%s template: %v", sender, err)
+	}
+	return t, nil
+}
+
+// truncate cuts the text to at most n bytes, marking the cut with an ellipsis, without cutting runes in half.
+func truncate(n int, text string) string {
+	const ellipsis = "…"
+	if len(text) <= n {
+		return text
+	}
+	cut := n - len(ellipsis)
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return strings.TrimRight(text[:cut], " \t\n") + ellipsis
+}
+
+// renderMessage renders the message about the repository's release with the template.
+func renderMessage(t *template.Template, repository Repository, messages Messages) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, &MessageData{Repository: repository, Action: messages.Action(repository)}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	githubql "github.com/shurcooL/githubql"
+)
+
+// errTokenRejected is returned for a GitHub token that is invalid, expired or revoked.
+var errTokenRejected = errors.New("GitHub rejected the token as invalid, expired or revoked")
+
+// isUnauthorized returns true if the error is GitHub's response to a rejected token.
+func isUnauthorized(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "401 Unauthorized")
+}
+
+// verifyToken runs the smallest query there is to find out if GitHub accepts the client's token.
+// It returns errTokenRejected if it doesn't, other errors like network failures as they are.
+func verifyToken(client *githubql.Client) error {
+	var query struct {
+		Viewer struct {
+			Login githubql.String
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := client.Query(ctx, &query, nil)
+	if isUnauthorized(err) {
+		return errTokenRejected
+	}
+	return err
+}
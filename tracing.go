@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// tracerMaxSpans is how many ended spans wait for export at most, so an unreachable collector
+// doesn't hold on to more and more of them. Later ones are dropped until the next flush.
+const tracerMaxSpans = 10000
+
+// Tracer records spans and exports them to an OpenTelemetry collector via OTLP/HTTP.
+// A nil *Tracer is valid and records nothing.
+type Tracer struct {
+	endpoint string
+	service  string
+	logger   log.Logger
+
+	mu    sync.Mutex
+	spans []otlpSpan
+	// dropped counts the spans ended while tracerMaxSpans were waiting.
+	dropped int
+}
+
+// Span is a single traced operation.
+// A nil *Span is valid and records nothing.
+type Span struct {
+	tracer   *Tracer
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+
+	mu         sync.Mutex
+	attributes []otlpAttribute
+}
+
+// NewTracer returns a Tracer exporting to the OTLP/HTTP endpoint,
+// e.g. http://collector:4318, every few seconds, logging failed exports.
+// It returns nil if the endpoint is empty.
+func NewTracer(endpoint, service string, logger log.Logger) *Tracer {
+	if endpoint == "" {
+		return nil
+	}
+
+	t := &Tracer{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service:  service,
+		logger:   logger,
+	}
+	go func() {
+		for range time.Tick(5 * time.Second) {
+			if err := t.Flush(); err != nil {
+				level.Warn(logger).Log("msg", "failed to export traces", "err", err)
+			}
+		}
+	}()
+	return t
+}
+
+// Start a span. Without a parent the span starts a new trace.
+func (t *Tracer) Start(parent *Span, name string) *Span {
+	if t == nil {
+		return nil
+	}
+
+	s := &Span{
+		tracer: t,
+		spanID: randomHex(8),
+		name:   name,
+		start:  time.Now(),
+	}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		s.traceID = randomHex(16)
+	}
+	return s
+}
+
+// SetAttribute adds a string, int or bool attribute to the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	var v otlpValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case int:
+		i := strconv.Itoa(value)
+		v.IntValue = &i
+	case bool:
+		v.BoolValue = &value
+	default:
+		str := fmt.Sprint(value)
+		v.StringValue = &str
+	}
+
+	s.mu.Lock()
+	s.attributes = append(s.attributes, otlpAttribute{Key: key, Value: v})
+	s.mu.Unlock()
+}
+
+// End the span, marking it as failed if err is not nil.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	span := otlpSpan{
+		TraceID:      s.traceID,
+		SpanID:       s.spanID,
+		ParentSpanID: s.parentID,
+		Name:         s.name,
+		Kind:         1, // SPAN_KIND_INTERNAL
+		Start:        strconv.FormatInt(s.start.UnixNano(), 10),
+		End:          strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes:   s.attributes,
+		Status:       otlpStatus{Code: 1}, // STATUS_CODE_OK
+	}
+	s.mu.Unlock()
+	if err != nil {
+		span.Status = otlpStatus{Code: 2, Message: err.Error()} // STATUS_CODE_ERROR
+	}
+
+	s.tracer.mu.Lock()
+	if len(s.tracer.spans) < tracerMaxSpans {
+		s.tracer.spans = append(s.tracer.spans, span)
+	} else {
+		s.tracer.dropped++
+	}
+	s.tracer.mu.Unlock()
+}
+
+// Flush exports all ended spans. Spans failing to export are lost, the error tells how many.
+func (t *Tracer) Flush() error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	spans, dropped := t.spans, t.dropped
+	t.spans, t.dropped = nil, 0
+	t.mu.Unlock()
+
+	if dropped > 0 && t.logger != nil {
+		level.Warn(t.logger).Log("msg", "dropped spans, too many were waiting for export", "spans", dropped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	if err := t.export(spans); err != nil {
+		return fmt.Errorf("failed to export %d spans: %v", len(spans), err)
+	}
+	return nil
+}
+
+// export sends the spans to the collector.
+func (t *Tracer) export(spans []otlpSpan) error {
+	service := t.service
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: &service}}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "github-releases-notifier"},
+				"spans": spans,
+			}},
+		}},
+	}
+
+	payloadData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(payloadData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req = req.WithContext(ctx)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("request didn't respond with 200 OK: %s, %s", resp.Status, body)
+	}
+
+	return nil
+}
+
+// The OTLP/JSON encoding of spans, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
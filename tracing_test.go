@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestTracerCapsSpans(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	tracer := &Tracer{endpoint: unavailable.URL, logger: log.NewNopLogger()}
+	for i := 0; i < tracerMaxSpans+5; i++ {
+		tracer.Start(nil, "check").End(nil)
+	}
+	if len(tracer.spans) != tracerMaxSpans || tracer.dropped != 5 {
+		t.Fatalf("%d spans waiting and %d dropped, want %d and 5", len(tracer.spans), tracer.dropped, tracerMaxSpans)
+	}
+
+	err := tracer.Flush()
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%d spans", tracerMaxSpans)) {
+		t.Errorf("Flush() = %v, want an error with the lost spans", err)
+	}
+	if len(tracer.spans) != 0 || tracer.dropped != 0 {
+		t.Errorf("%d spans waiting and %d dropped after flushing, want none", len(tracer.spans), tracer.dropped)
+	}
+}
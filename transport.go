@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Connection pooling of the shared transport by default. Go keeps only 2 idle connections per host,
+// too few for the GitHub API with many repositories and for senders posting to the same host.
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// tuneTransport sets the connection pooling of http.DefaultTransport, which the GitHub clients
+// and all senders but gRPC share, so connections are reused rather than opened for every request.
+// A timeout of 0 keeps idle connections open until the server closes them.
+func tuneTransport(maxIdleConns, maxIdleConnsPerHost int, idleConnTimeout time.Duration) error {
+	if maxIdleConns < 0 || maxIdleConnsPerHost < 0 || idleConnTimeout < 0 {
+		return fmt.Errorf("connection pool settings must not be negative")
+	}
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("can't tune transport of type %T", http.DefaultTransport)
+	}
+	transport.MaxIdleConns = maxIdleConns
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.IdleConnTimeout = idleConnTimeout
+	return nil
+}
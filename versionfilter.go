@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// changeRanks orders the levels of change, see ChangeLevel.
+var changeRanks = map[string]int{ChangePrerelease: 0, ChangePatch: 1, ChangeMinor: 2, ChangeMajor: 3}
+
+// VersionFilter skips releases of a repository by their versions and tags.
+type VersionFilter struct {
+	// MinVersion skips releases lower than it and those without a semantic version, if set.
+	MinVersion *Version
+	// MinBump skips releases changing less than it from the previous release, e.g. minor for major and minor releases only.
+	MinBump string
+	// TagsInclude skips releases whose tags match none of them, if there are any.
+	TagsInclude []*regexp.Regexp
+	// TagsExclude skips releases whose tags match any of them.
+	TagsExclude []*regexp.Regexp
+}
+
+// Skips returns why the repository's release is skipped, an empty string if it isn't.
+// Releases are compared with their previous release to tell the bump, those without one or
+// without semantic versions aren't skipped because of it.
+func (f VersionFilter) Skips(repository Repository) string {
+	tag := repository.Release.TagName
+	for _, exclude := range f.TagsExclude {
+		if exclude.MatchString(tag) {
+			return fmt.Sprintf("tag matches excluded %s", exclude)
+		}
+	}
+	if len(f.TagsInclude) > 0 && !matchesAny(f.TagsInclude, tag) {
+		return "tag matches none of tags_include"
+	}
+
+	version, err := repository.Release.Version()
+	if f.MinVersion != nil {
+		if err != nil {
+			return "tag isn't a semantic version to compare with min_version"
+		}
+		if version.Compare(*f.MinVersion) < 0 {
+			return "version is lower than min_version " + f.MinVersion.String()
+		}
+	}
+	if f.MinBump != "" && err == nil && repository.Previous != nil {
+		if previous, err := repository.Previous.Version(); err == nil {
+			if change := ChangeLevel(previous, version); changeRanks[change] < changeRanks[f.MinBump] {
+				return fmt.Sprintf("%s change is less than min_bump %s", change, f.MinBump)
+			}
+		}
+	}
+	return ""
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
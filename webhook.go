@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// WebhookSender posts releases to a URL, as release events or in the body rendered by a template.
+type WebhookSender struct {
+	URL string
+	// Headers are added to every request, e.g. an Authorization header for the receiver.
+	Headers http.Header
+	// Template renders the body from the release event, the JSON encoded event is posted without one.
+	Template *template.Template
+	// FieldNames renames the fields of the JSON encoded event.
+	FieldNames EventFieldNames
+}
+
+// ParseWebhookTemplate parses the template for the bodies of webhook requests.
+// It has the functions of message templates, e.g. json encoding a value as JSON like {{json .Release.Body}}.
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(templateFuncs).Parse(text)
+}
+
+// Send posts the repository's release.
+func (s *WebhookSender) Send(repository Repository) error {
+	var body []byte
+	if s.Template == nil {
+		var err error
+		if body, err = MarshalReleaseEvent(repository, s.FieldNames); err != nil {
+			return err
+		}
+	} else {
+		var b bytes.Buffer
+		if err := s.Template.Execute(&b, NewReleaseEvent(repository)); err != nil {
+			return err
+		}
+		body = b.Bytes()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range s.Headers {
+		req.Header[name] = values
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req = req.WithContext(ctx)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return &statusError{Code: resp.StatusCode, Message: fmt.Sprintf("request didn't respond with 2xx: %s, %s", resp.Status, respBody)}
+	}
+	return nil
+}
+
+// postJSON posts the payload JSON encoded to the hook, any 2xx response counts as delivered.
+func postJSON(hook string, payload interface{}) error {
+	payloadData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook, bytes.NewReader(payloadData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req = req.WithContext(ctx)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return &statusError{Code: resp.StatusCode, Message: fmt.Sprintf("request didn't respond with 2xx: %s, %s", resp.Status, body)}
+	}
+	return nil
+}